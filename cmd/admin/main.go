@@ -0,0 +1,343 @@
+// admin command for one-off maintenance task
+//
+//	go run ./cmd/admin rotate-credential-keys
+//	go run ./cmd/admin set-role <email> <admin|operator|viewer>
+//	go run ./cmd/admin migrate-cctv-contacts
+//	go run ./cmd/admin repair-orphans [cascade | reassign <contact_id>]
+//	go run ./cmd/admin normalize-phones
+//	go run ./cmd/admin migrate-catalog [dry-run]
+//	go run ./cmd/admin normalize-ips
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/config"
+	"github.com/maulanar/gin-kecilin/database"
+	"github.com/maulanar/gin-kecilin/src/cctv"
+	"github.com/maulanar/gin-kecilin/src/contact"
+	"github.com/maulanar/gin-kecilin/src/recorder"
+	"github.com/maulanar/gin-kecilin/src/user"
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"rotate-credential-keys": rotateCredentialKeys,
+	"set-role":               setRole,
+	"migrate-cctv-contacts":  migrateCctvContacts,
+	"repair-orphans":         repairOrphans,
+	"normalize-phones":       normalizePhones,
+	"migrate-catalog":        migrateCatalog,
+	"normalize-ips":          normalizeIPs,
+}
+
+func main() {
+	if len(os.Args) < 2 || commands[os.Args[1]] == nil {
+		usage()
+		os.Exit(1)
+	}
+
+	config.Init()
+	database.Init()
+	if err := utils.SetCredentialKeys(config.CREDENTIAL_KEYS, config.CREDENTIAL_KEY_ID); err != nil {
+		log.Fatalf("Failed to load credential keys: %v", err)
+	}
+	if err := utils.SetPhoneRegion(config.PHONE_REGION); err != nil {
+		log.Fatalf("Failed to set phone region: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	if err := commands[os.Args[1]](ctx, os.Args[2:]); err != nil {
+		log.Fatalf("%s: %v", os.Args[1], err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: admin <command> [args]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  rotate-credential-keys          rewrap cctv credentials with CREDENTIAL_KEY_ID")
+	fmt.Fprintln(os.Stderr, "  set-role <email> <role>         set user role (admin, operator, viewer)")
+	fmt.Fprintln(os.Stderr, "  migrate-cctv-contacts           link every cctv contact_id as its owner contact")
+	fmt.Fprintln(os.Stderr, "  repair-orphans [policy]         list references to missing contact, repair with")
+	fmt.Fprintln(os.Stderr, "                                  cascade or reassign <contact_id>")
+	fmt.Fprintln(os.Stderr, "  normalize-phones                store E.164 phone of every contact and user")
+	fmt.Fprintln(os.Stderr, "  migrate-catalog [dry-run]       link cctv free text brand & model to the catalog")
+	fmt.Fprintln(os.Stderr, "  normalize-ips                   store canonical ip & mac address of every cctv and recorder")
+}
+
+func rotateCredentialKeys(ctx context.Context, args []string) error {
+	uc := cctv.UsecaseHandler{
+		Ctx: ctx,
+	}
+	count, err := uc.RotateCredentialKeys()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Rotated %d cctv credentials to key %s", count, utils.ActiveCredentialKeyID())
+	return nil
+}
+
+func setRole(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("need <email> <role>")
+	}
+	email, role := args[0], args[1]
+	if role != utils.RoleAdmin && role != utils.RoleOperator && role != utils.RoleViewer {
+		return fmt.Errorf("invalid role %s", role)
+	}
+
+	res, err := user.Collection().UpdateOne(ctx,
+		bson.M{"email": email},
+		bson.M{"$set": bson.M{"role": role, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("user %s is not found", email)
+	}
+
+	log.Printf("User %s role is now %s", email, role)
+	return nil
+}
+
+func migrateCctvContacts(ctx context.Context, args []string) error {
+	uc := cctv.UsecaseHandler{
+		Ctx: ctx,
+	}
+	count, err := uc.MigrateContacts()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Linked owner contact of %d cctvs", count)
+	return nil
+}
+
+// repairOrphans only report without policy, merged contact is always re-pointed to the contact it was merged into
+func repairOrphans(ctx context.Context, args []string) error {
+	uc := contact.UsecaseHandler{
+		Ctx: ctx,
+	}
+
+	var orphans *contact.Orphans
+	var err error
+	switch {
+	case len(args) == 0:
+		orphans, err = uc.FindOrphans()
+	case args[0] == contact.DeleteCascade && len(args) == 1:
+		orphans, err = uc.RepairOrphans(contact.DeleteCascade, "")
+	case args[0] == contact.DeleteReassign && len(args) == 2:
+		orphans, err = uc.RepairOrphans(contact.DeleteReassign, args[1])
+	default:
+		return fmt.Errorf("need no policy, cascade or reassign <contact_id>")
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, v := range []struct {
+		name string
+		refs map[string][]string
+	}{
+		{"cctv", orphans.Cctvs},
+		{"site", orphans.Sites},
+		{"recorder", orphans.Recorders},
+		{"cctv link", orphans.Links},
+	} {
+		for missing, ids := range v.refs {
+			note := ""
+			if target, ok := orphans.Redirects[missing]; ok {
+				note = " (merged into " + target + ")"
+			}
+			log.Printf("Contact %s%s is missing, referenced by %d %s: %v", missing, note, len(ids), v.name, ids)
+		}
+	}
+	if len(args) == 0 {
+		log.Println("Nothing is changed, run with cascade or reassign <contact_id> to repair")
+	} else {
+		log.Println("Orphans repaired")
+	}
+	return nil
+}
+
+// normalizePhones fill phone_e164 of existing contacts and users, invalid number is only reported
+func normalizePhones(ctx context.Context, args []string) error {
+	for _, v := range []struct {
+		name       string
+		collection *mongo.Collection
+		idField    string
+	}{
+		{"contact", contact.Collection(), "contact_id"},
+		{"user", user.Collection(), "user_id"},
+	} {
+		cur, err := v.collection.Find(ctx,
+			bson.M{"phone": bson.M{"$nin": bson.A{nil, ""}}},
+			options.Find().SetProjection(bson.M{v.idField: 1, "phone": 1, "phone_e164": 1}),
+		)
+		if err != nil {
+			return err
+		}
+
+		updated := 0
+		for cur.Next(ctx) {
+			var doc bson.M
+			if err := cur.Decode(&doc); err != nil {
+				cur.Close(ctx)
+				return err
+			}
+			id, _ := doc[v.idField].(string)
+			phone, _ := doc["phone"].(string)
+
+			e164, err := utils.NormalizePhone(phone)
+			if err != nil {
+				log.Printf("%s %s phone %q is not a valid number, left unchanged", v.name, id, phone)
+				continue
+			}
+			if doc["phone_e164"] == e164 {
+				continue
+			}
+			_, err = v.collection.UpdateOne(ctx, bson.M{"_id": doc["_id"]}, bson.M{"$set": bson.M{"phone_e164": e164}})
+			if err != nil {
+				cur.Close(ctx)
+				return err
+			}
+			updated++
+		}
+		err = cur.Err()
+		cur.Close(ctx)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Normalized phone of %d %ss", updated, v.name)
+	}
+	return nil
+}
+
+func migrateCatalog(ctx context.Context, args []string) error {
+	dryRun := len(args) > 0 && args[0] == "dry-run"
+	if len(args) > 0 && !dryRun {
+		return fmt.Errorf("need no argument or dry-run")
+	}
+
+	uc := cctv.UsecaseHandler{
+		Ctx: ctx,
+	}
+	rows, updated, err := uc.MigrateCatalog(dryRun)
+	if err != nil {
+		return err
+	}
+
+	unmatched := 0
+	for _, v := range rows {
+		brand, model := "", ""
+		if v.Brand != nil {
+			brand = *v.Brand
+		}
+		if v.Model != nil {
+			model = *v.Model
+		}
+		switch {
+		case v.BrandID == nil:
+			unmatched++
+			log.Printf("%q %q (%d cctv) has no catalog match", brand, model, v.Count)
+		case v.ModelID == nil:
+			log.Printf("%q %q (%d cctv) matched brand %s only", brand, model, v.Count, *v.BrandID)
+		default:
+			log.Printf("%q %q (%d cctv) matched brand %s model %s", brand, model, v.Count, *v.BrandID, *v.ModelID)
+		}
+	}
+
+	if dryRun {
+		log.Printf("Dry run, %d brand & model pair, %d without match", len(rows), unmatched)
+		return nil
+	}
+	log.Printf("Linked %d cctv to the catalog, %d brand & model pair without match", updated, unmatched)
+	return nil
+}
+
+func normalizeIPs(ctx context.Context, args []string) error {
+	for _, v := range []struct {
+		name       string
+		collection *mongo.Collection
+		idField    string
+	}{
+		{"cctv", cctv.Collection(), "cctv_id"},
+		{"recorder", recorder.Collection(), "recorder_id"},
+	} {
+		cur, err := v.collection.Find(ctx,
+			bson.M{"$or": bson.A{
+				bson.M{"ip_address": bson.M{"$nin": bson.A{nil, ""}}},
+				bson.M{"mac_address": bson.M{"$nin": bson.A{nil, ""}}},
+			}},
+			options.Find().SetProjection(bson.M{v.idField: 1, "ip_address": 1, "ip_key": 1, "mac_address": 1}),
+		)
+		if err != nil {
+			return err
+		}
+
+		updated := 0
+		for cur.Next(ctx) {
+			var doc bson.M
+			if err := cur.Decode(&doc); err != nil {
+				cur.Close(ctx)
+				return err
+			}
+			id, _ := doc[v.idField].(string)
+			set := bson.M{}
+
+			if ip, _ := doc["ip_address"].(string); ip != "" {
+				n, err := utils.NormalizeIP(ip)
+				if err != nil {
+					log.Printf("%s %s ip address %q is not valid, left unchanged", v.name, id, ip)
+				} else {
+					if n != ip {
+						set["ip_address"] = n
+					}
+					// only cctv is queried by cidr
+					if key, _ := utils.IPKey(n); v.name == "cctv" && doc["ip_key"] != key {
+						set["ip_key"] = key
+					}
+				}
+			}
+			if mac, _ := doc["mac_address"].(string); mac != "" {
+				n, err := utils.NormalizeMAC(mac)
+				if err != nil {
+					log.Printf("%s %s mac address %q is not valid, left unchanged", v.name, id, mac)
+				} else if n != mac {
+					set["mac_address"] = n
+				}
+			}
+			if len(set) == 0 {
+				continue
+			}
+
+			_, err = v.collection.UpdateOne(ctx, bson.M{"_id": doc["_id"]}, bson.M{"$set": set})
+			if err != nil {
+				cur.Close(ctx)
+				return err
+			}
+			updated++
+		}
+		err = cur.Err()
+		cur.Close(ctx)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Normalized ip address of %d %ss", updated, v.name)
+	}
+	return nil
+}
@@ -4,12 +4,46 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
 
 var (
 	PORT, DB_URL, DB_NAME, SECRETKEY string
+
+	// envelope encryption master keys "id:base64key,...", and the active key id
+	CREDENTIAL_KEYS, CREDENTIAL_KEY_ID string
+
+	// blob storage, driver "local" store to STORAGE_PATH
+	STORAGE_DRIVER, STORAGE_PATH string
+
+	// snapshot schedule in minutes (0 = disabled) and retention in days
+	SNAPSHOT_INTERVAL, SNAPSHOT_RETENTION int
+
+	// shared token for device webhook, empty = webhook disabled
+	WEBHOOK_TOKEN string
+
+	// default policy on deleting contact which still has cctv: restrict, cascade or reassign
+	CONTACT_DELETE_POLICY string
+
+	// region of phone number written without country code, e.g. ID
+	PHONE_REGION string
+
+	// notification email through smtp
+	SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM string
+
+	// notification sms & whatsapp through http gateway
+	NOTIFY_GATEWAY_URL, NOTIFY_GATEWAY_TOKEN string
+
+	// base url of this api, for link sent to outside, e.g. acknowledge alert
+	PUBLIC_URL string
+
+	// hours a customer invitation can be accepted
+	INVITATION_TTL_HOURS int
+
+	// remind contacts of warranty expiring within days (0 = disabled), at hour of day in server timezone
+	WARRANTY_REMINDER_DAYS, WARRANTY_REMINDER_HOUR int
 )
 
 func InitEnv() error {
@@ -41,9 +75,61 @@ func InitEnv() error {
 	} else {
 		SECRETKEY = v
 	}
+	CREDENTIAL_KEYS = os.Getenv("CREDENTIAL_KEYS")
+	CREDENTIAL_KEY_ID = os.Getenv("CREDENTIAL_KEY_ID")
+	if v := os.Getenv("STORAGE_DRIVER"); v == "" {
+		STORAGE_DRIVER = "local"
+	} else {
+		STORAGE_DRIVER = v
+	}
+	if v := os.Getenv("STORAGE_PATH"); v == "" {
+		STORAGE_PATH = "./data"
+	} else {
+		STORAGE_PATH = v
+	}
+	SNAPSHOT_INTERVAL = envInt("SNAPSHOT_INTERVAL", 0)
+	SNAPSHOT_RETENTION = envInt("SNAPSHOT_RETENTION", 30)
+	INVITATION_TTL_HOURS = envInt("INVITATION_TTL_HOURS", 72)
+	WARRANTY_REMINDER_DAYS = envInt("WARRANTY_REMINDER_DAYS", 30)
+	WARRANTY_REMINDER_HOUR = envInt("WARRANTY_REMINDER_HOUR", 9)
+	WEBHOOK_TOKEN = os.Getenv("WEBHOOK_TOKEN")
+	SMTP_HOST = os.Getenv("SMTP_HOST")
+	if v := os.Getenv("SMTP_PORT"); v == "" {
+		SMTP_PORT = "587"
+	} else {
+		SMTP_PORT = v
+	}
+	SMTP_USERNAME = os.Getenv("SMTP_USERNAME")
+	SMTP_PASSWORD = os.Getenv("SMTP_PASSWORD")
+	SMTP_FROM = os.Getenv("SMTP_FROM")
+	NOTIFY_GATEWAY_URL = os.Getenv("NOTIFY_GATEWAY_URL")
+	NOTIFY_GATEWAY_TOKEN = os.Getenv("NOTIFY_GATEWAY_TOKEN")
+	if v := os.Getenv("PUBLIC_URL"); v == "" {
+		PUBLIC_URL = "http://localhost:" + PORT
+	} else {
+		PUBLIC_URL = v
+	}
+	if v := os.Getenv("CONTACT_DELETE_POLICY"); v == "" {
+		CONTACT_DELETE_POLICY = "restrict"
+	} else {
+		CONTACT_DELETE_POLICY = v
+	}
+	if v := os.Getenv("PHONE_REGION"); v == "" {
+		PHONE_REGION = "ID"
+	} else {
+		PHONE_REGION = v
+	}
 	return nil
 }
 
+func envInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
 func Init() {
 	if err := InitEnv(); err != nil {
 		log.Fatal(err)
@@ -45,3 +45,17 @@ func OpenCollection(collectionName string) *mongo.Collection {
 	}
 	return DB.Database(config.DB_NAME).Collection(collectionName)
 }
+
+// WithTransaction run fn in a transaction, MongoDB must run as replica set
+func WithTransaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	session, err := DB.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
@@ -1,25 +1,96 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/maulanar/gin-kecilin/config"
 	"github.com/maulanar/gin-kecilin/database"
+	"github.com/maulanar/gin-kecilin/middleware"
 	"github.com/maulanar/gin-kecilin/routes"
+	"github.com/maulanar/gin-kecilin/src/catalog"
+	"github.com/maulanar/gin-kecilin/src/cctv"
+	"github.com/maulanar/gin-kecilin/src/contact"
+	"github.com/maulanar/gin-kecilin/src/customfield"
+	"github.com/maulanar/gin-kecilin/src/event"
+	"github.com/maulanar/gin-kecilin/src/maintenance"
+	"github.com/maulanar/gin-kecilin/src/notification"
+	"github.com/maulanar/gin-kecilin/src/recorder"
+	"github.com/maulanar/gin-kecilin/src/snapshot"
+	"github.com/maulanar/gin-kecilin/src/statushistory"
+	"github.com/maulanar/gin-kecilin/src/user"
+	"github.com/maulanar/gin-kecilin/storage"
 	"github.com/maulanar/gin-kecilin/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	r := gin.Default()
+	// access token query and link token in the path are removed before the request is logged
+	r := gin.New()
+	r.Use(
+		middleware.QueryToken("GET /api/stream"),
+		middleware.PathToken("/api/alerts/ack/:token", "/api/invitations/:token", "/api/invitations/:token/accept"),
+		gin.Logger(),
+		gin.Recovery(),
+	)
 	config.Init()
 	database.Init()
+	storage.Init()
+
+	// ensure collection indexes
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	if err := cctv.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+	if err := snapshot.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+	if err := event.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+	if err := maintenance.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+	if err := statushistory.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+	if err := contact.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+	if err := notification.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+	if err := user.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+	if err := customfield.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+	if err := catalog.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+	cancel()
 
 	//set secret key
 	utils.SetJWTKey([]byte(config.SECRETKEY))
+	if err := utils.SetCredentialKeys(config.CREDENTIAL_KEYS, config.CREDENTIAL_KEY_ID); err != nil {
+		log.Fatalf("Failed to load credential keys: %v", err)
+	}
+	if err := utils.SetPhoneRegion(config.PHONE_REGION); err != nil {
+		log.Fatalf("Failed to set phone region: %v", err)
+	}
+	// recorder cannot import cctv, the channel status follow the recorder through this hook
+	recorder.StatusCascade = cctv.CascadeRecorderStatus
 	routes.SetRouter(r)
 
+	// background jobs
+	go snapshot.RunScheduler(context.Background())
+	go maintenance.RunScheduler(context.Background())
+	go notification.RunWorker(context.Background())
+	go notification.RunWarrantyScheduler(context.Background())
+
 	// Start Server
 	r.Run(":" + config.PORT)
 	log.Println("Server is running on port:" + config.PORT)
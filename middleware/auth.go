@@ -1,10 +1,12 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"log"
 	"net/http"
 	"strings"
 
+	"github.com/maulanar/gin-kecilin/config"
 	"github.com/maulanar/gin-kecilin/utils"
 
 	"github.com/gin-gonic/gin"
@@ -43,3 +45,115 @@ func Authenticate() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// Authorize must be used after Authenticate, allow only user with given roles
+func Authorize(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := c.Get("claims")
+		tokenClaim, ok := claims.(*utils.Claims)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			c.Abort()
+			return
+		}
+
+		for _, role := range roles {
+			if tokenClaim.Role == role {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to access this resource"})
+		c.Abort()
+	}
+}
+
+// CustomerRoutes must be used after Authenticate, customer may only call the given routes,
+// written as "METHOD /path" like registered in the router. Customer without contact is always refused
+func CustomerRoutes(routes ...string) gin.HandlerFunc {
+	allowed := map[string]bool{}
+	for _, v := range routes {
+		allowed[v] = true
+	}
+	return func(c *gin.Context) {
+		if claims, ok := utils.GetClaims(c); ok && claims.Role == utils.RoleCustomer {
+			if claims.ContactID == "" || !allowed[c.Request.Method+" "+c.FullPath()] {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to access this resource"})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// WebhookAuthenticate check shared token for device webhook, from X-Webhook-Token header or token query
+func WebhookAuthenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.WEBHOOK_TOKEN == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook is disabled"})
+			c.Abort()
+			return
+		}
+
+		token := c.GetHeader("X-Webhook-Token")
+		if token == "" {
+			token = c.Query("token")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.WEBHOOK_TOKEN)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// QueryToken take the access_token query out of every request before it is logged, and use it as bearer token
+// when Authorization header is empty on the given routes only, e.g. "GET /api/stream" for browser EventSource
+// which cannot set header. Must be used before the logger
+func QueryToken(routes ...string) gin.HandlerFunc {
+	allowed := map[string]bool{}
+	for _, v := range routes {
+		allowed[v] = true
+	}
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+		if token := query.Get("access_token"); token != "" {
+			query.Del("access_token")
+			c.Request.URL.RawQuery = query.Encode()
+			if allowed[c.Request.Method+" "+c.Request.URL.Path] && c.GetHeader("Authorization") == "" {
+				c.Request.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		c.Next()
+	}
+}
+
+// PathToken hide the :token segment of the given routes before the path is logged, e.g. "/api/invitations/:token"
+// where the link token is the credential. The handler still read it with c.Param. Must be used before the logger
+func PathToken(routes ...string) gin.HandlerFunc {
+	allowed := map[string]bool{}
+	for _, v := range routes {
+		allowed[v] = true
+	}
+	return func(c *gin.Context) {
+		if allowed[c.FullPath()] {
+			route := strings.Split(c.FullPath(), "/")
+			parts := strings.Split(c.Request.URL.Path, "/")
+			if len(route) == len(parts) {
+				for k, v := range route {
+					if v == ":token" {
+						parts[k] = "xxx"
+					}
+				}
+				c.Request.URL.Path = strings.Join(parts, "/")
+				c.Request.URL.RawPath = ""
+			}
+		}
+		c.Next()
+	}
+}
@@ -4,13 +4,39 @@ import (
 	"net/http"
 
 	"github.com/maulanar/gin-kecilin/middleware"
+	"github.com/maulanar/gin-kecilin/src/audit"
+	"github.com/maulanar/gin-kecilin/src/catalog"
 	"github.com/maulanar/gin-kecilin/src/cctv"
 	"github.com/maulanar/gin-kecilin/src/contact"
+	"github.com/maulanar/gin-kecilin/src/customfield"
+	"github.com/maulanar/gin-kecilin/src/dashboard"
+	"github.com/maulanar/gin-kecilin/src/event"
+	"github.com/maulanar/gin-kecilin/src/maintenance"
+	"github.com/maulanar/gin-kecilin/src/notification"
+	"github.com/maulanar/gin-kecilin/src/recorder"
+	"github.com/maulanar/gin-kecilin/src/report"
+	"github.com/maulanar/gin-kecilin/src/site"
+	"github.com/maulanar/gin-kecilin/src/snapshot"
+	"github.com/maulanar/gin-kecilin/src/statushistory"
+	"github.com/maulanar/gin-kecilin/src/stream"
 	"github.com/maulanar/gin-kecilin/src/user"
+	"github.com/maulanar/gin-kecilin/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+// endpoints a customer may call, each scoped to the cctvs of the customer contact
+var customerRoutes = []string{
+	"GET /api/user/me",
+	"POST /api/logout",
+	"GET /api/cctvs",
+	"GET /api/cctvs/geojson",
+	"GET /api/cctvs/:id",
+	"GET /api/cctvs/:id/status-history",
+	"GET /api/dashboard/summary",
+	"GET /api/reports/availability",
+}
+
 func SetRouter(r *gin.Engine) {
 	// Server status
 	r.GET("/api/ping", func(c *gin.Context) {
@@ -20,9 +46,24 @@ func SetRouter(r *gin.Engine) {
 	r.POST("/api/signup", user.SignUp())
 	r.POST("/api/login", user.Login())
 
+	// Device webhook, authenticated by shared token
+	r.POST("/api/webhooks/events/:vendor", middleware.WebhookAuthenticate(), event.WebhookHandler())
+
+	// Alert acknowledge link sent in notification, the token is the credential.
+	// The link only show a confirmation page, its form post the token to acknowledge
+	r.GET("/api/alerts/ack/:token", notification.AckPageHandler())
+	r.POST("/api/alerts/ack", notification.AcknowledgeTokenHandler())
+
+	// Customer invitation link, the token is the credential
+	r.GET("/api/invitations/:token", user.GetInvitationHandler())
+	r.POST("/api/invitations/:token/accept", user.AcceptInvitationHandler())
+
+	// Live changes as Server-Sent Events, token may be given as access_token query, see QueryToken in main
+	r.GET("/api/stream", middleware.Authenticate(), stream.StreamHandler())
+
 	// This endpoint requires login first
 	protec := r.Group("/")
-	protec.Use(middleware.Authenticate())
+	protec.Use(middleware.Authenticate(), middleware.CustomerRoutes(customerRoutes...))
 	{
 		protec.GET("/api/user/me", user.GetUser())
 		protec.POST("/api/logout", user.Logout())
@@ -37,18 +78,132 @@ func SetRouter(r *gin.Engine) {
 
 		// Contacts
 		protec.GET("/api/contacts", contact.GetHandler())
+		protec.GET("/api/contacts/export", contact.ExportHandler())
+		protec.GET("/api/contacts/vcard", contact.ExportVCardHandler())
+		protec.GET("/api/contacts/duplicates", contact.DuplicatesHandler())
+		protec.POST("/api/contacts/vcard", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), contact.ImportVCardHandler())
 		protec.GET("/api/contacts/:id", contact.GetByIDHandler())
+		protec.GET("/api/contacts/:id/vcard", contact.VCardHandler())
+		protec.POST("/api/contacts/:id/merge", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), contact.MergeHandler())
+		protec.POST("/api/contacts/:id/invite", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), user.InviteHandler())
 		protec.POST("/api/contacts", contact.CreateHandler())
 		protec.PUT("/api/contacts/:id", contact.UpdateHandler())
 		protec.PATCH("/api/contacts/:id", contact.UpdateHandler())
 		protec.DELETE("/api/contacts/:id", contact.DeleteHandler())
 
+		// Sites
+		protec.GET("/api/sites", site.GetHandler())
+		protec.GET("/api/sites/tree", site.TreeHandler())
+		protec.GET("/api/sites/:id", site.GetByIDHandler())
+		protec.GET("/api/sites/:id/tree", site.TreeHandler())
+		protec.POST("/api/sites", site.CreateHandler())
+		protec.PUT("/api/sites/:id", site.UpdateHandler())
+		protec.PATCH("/api/sites/:id", site.UpdateHandler())
+		protec.DELETE("/api/sites/:id", site.DeleteHandler())
+		protec.POST("/api/sites/:id/zones", site.CreateZoneHandler())
+		protec.PUT("/api/sites/:id/zones/:zone_id", site.UpdateZoneHandler())
+		protec.PATCH("/api/sites/:id/zones/:zone_id", site.UpdateZoneHandler())
+		protec.DELETE("/api/sites/:id/zones/:zone_id", site.DeleteZoneHandler())
+		protec.GET("/api/sites/:id/escalation", notification.GetPolicyHandler(notification.ScopeSite))
+		protec.PUT("/api/sites/:id/escalation", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), notification.SavePolicyHandler(notification.ScopeSite))
+		protec.DELETE("/api/sites/:id/escalation", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), notification.DeletePolicyHandler(notification.ScopeSite))
+
+		// Recorders (NVR/DVR)
+		protec.GET("/api/recorders", recorder.GetHandler())
+		protec.GET("/api/recorders/:id", recorder.GetByIDHandler())
+		protec.POST("/api/recorders", recorder.CreateHandler())
+		protec.PUT("/api/recorders/:id", recorder.UpdateHandler())
+		protec.PATCH("/api/recorders/:id", recorder.UpdateHandler())
+		protec.DELETE("/api/recorders/:id", recorder.DeleteHandler())
+
 		// CCTVS
 		protec.GET("/api/cctvs", cctv.GetHandler())
+		protec.GET("/api/cctvs/geojson", cctv.GeoJSONHandler())
+		protec.GET("/api/cctvs/export", cctv.ExportHandler())
 		protec.GET("/api/cctvs/:id", cctv.GetByIDHandler())
 		protec.POST("/api/cctvs", cctv.CreateHandler())
+		protec.POST("/api/cctvs/import", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), cctv.ImportHandler())
 		protec.PUT("/api/cctvs/:id", cctv.UpdateHandler())
 		protec.PATCH("/api/cctvs/:id", cctv.UpdateHandler())
 		protec.DELETE("/api/cctvs/:id", cctv.DeleteHandler())
+		protec.GET("/api/cctvs/:id/credentials", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), cctv.CredentialsHandler())
+		protec.POST("/api/cctvs/:id/status", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), cctv.StatusHandler())
+		protec.POST("/api/cctvs/:id/heartbeat", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), cctv.HeartbeatHandler())
+		protec.GET("/api/cctvs/:id/status-history", statushistory.GetHandler())
+		protec.GET("/api/cctvs/:id/escalation", notification.GetPolicyHandler(notification.ScopeCctv))
+		protec.PUT("/api/cctvs/:id/escalation", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), notification.SavePolicyHandler(notification.ScopeCctv))
+		protec.DELETE("/api/cctvs/:id/escalation", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), notification.DeletePolicyHandler(notification.ScopeCctv))
+
+		// Snapshots
+		protec.GET("/api/cctvs/:id/snapshot", snapshot.ImageHandler())
+		protec.POST("/api/cctvs/:id/snapshot", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), snapshot.CaptureHandler())
+		protec.GET("/api/cctvs/:id/snapshots", snapshot.GetHandler())
+		protec.GET("/api/cctvs/:id/snapshots/:snapshot_id", snapshot.ImageHandler())
+
+		// Maintenance Windows
+		protec.GET("/api/maintenance-windows", maintenance.GetHandler())
+		protec.GET("/api/maintenance-windows/:id", maintenance.GetByIDHandler())
+		protec.POST("/api/maintenance-windows", maintenance.CreateHandler())
+		protec.PUT("/api/maintenance-windows/:id", maintenance.UpdateHandler())
+		protec.PATCH("/api/maintenance-windows/:id", maintenance.UpdateHandler())
+		protec.DELETE("/api/maintenance-windows/:id", maintenance.DeleteHandler())
+		protec.POST("/api/maintenance-windows/:id/cancel", maintenance.CancelHandler())
+		protec.GET("/api/cctvs/:id/maintenance-windows", maintenance.GetHandler())
+
+		// Work Orders
+		protec.GET("/api/work-orders", maintenance.GetWorkOrderHandler())
+		protec.GET("/api/work-orders/:id", maintenance.GetWorkOrderByIDHandler())
+		protec.POST("/api/work-orders", maintenance.CreateWorkOrderHandler())
+		protec.PUT("/api/work-orders/:id", maintenance.UpdateWorkOrderHandler())
+		protec.PATCH("/api/work-orders/:id", maintenance.UpdateWorkOrderHandler())
+		protec.DELETE("/api/work-orders/:id", maintenance.DeleteWorkOrderHandler())
+		protec.POST("/api/work-orders/:id/complete", maintenance.CompleteWorkOrderHandler())
+		protec.GET("/api/cctvs/:id/work-orders", maintenance.GetWorkOrderHandler())
+
+		// Events
+		protec.GET("/api/events", event.GetHandler())
+		protec.GET("/api/events/:id", event.GetByIDHandler())
+		protec.POST("/api/events", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), event.IngestHandler())
+
+		// Alerts
+		protec.GET("/api/alerts", notification.GetAlertHandler())
+		protec.GET("/api/alerts/:id", notification.GetAlertByIDHandler())
+		protec.POST("/api/alerts/:id/ack", middleware.Authorize(utils.RoleAdmin, utils.RoleOperator), notification.AcknowledgeHandler())
+
+		// Custom Fields
+		protec.GET("/api/custom-fields", customfield.GetHandler())
+		protec.GET("/api/custom-fields/:id", customfield.GetByIDHandler())
+		protec.POST("/api/custom-fields", middleware.Authorize(utils.RoleAdmin), customfield.CreateHandler())
+		protec.PUT("/api/custom-fields/:id", middleware.Authorize(utils.RoleAdmin), customfield.UpdateHandler())
+		protec.PATCH("/api/custom-fields/:id", middleware.Authorize(utils.RoleAdmin), customfield.UpdateHandler())
+		protec.DELETE("/api/custom-fields/:id", middleware.Authorize(utils.RoleAdmin), customfield.DeleteHandler())
+
+		// Catalog
+		protec.GET("/api/catalog/match", catalog.MatchHandler())
+		protec.GET("/api/catalog/brands", catalog.GetBrandsHandler())
+		protec.GET("/api/catalog/brands/:id", catalog.GetBrandByIDHandler())
+		protec.POST("/api/catalog/brands", middleware.Authorize(utils.RoleAdmin), catalog.CreateBrandHandler())
+		protec.PUT("/api/catalog/brands/:id", middleware.Authorize(utils.RoleAdmin), catalog.UpdateBrandHandler())
+		protec.PATCH("/api/catalog/brands/:id", middleware.Authorize(utils.RoleAdmin), catalog.UpdateBrandHandler())
+		protec.DELETE("/api/catalog/brands/:id", middleware.Authorize(utils.RoleAdmin), catalog.DeleteBrandHandler())
+		protec.GET("/api/catalog/models", catalog.GetModelsHandler())
+		protec.GET("/api/catalog/models/:id", catalog.GetModelByIDHandler())
+		protec.POST("/api/catalog/models", middleware.Authorize(utils.RoleAdmin), catalog.CreateModelHandler())
+		protec.PUT("/api/catalog/models/:id", middleware.Authorize(utils.RoleAdmin), catalog.UpdateModelHandler())
+		protec.PATCH("/api/catalog/models/:id", middleware.Authorize(utils.RoleAdmin), catalog.UpdateModelHandler())
+		protec.DELETE("/api/catalog/models/:id", middleware.Authorize(utils.RoleAdmin), catalog.DeleteModelHandler())
+
+		// Audit Logs
+		protec.GET("/api/audit-logs", middleware.Authorize(utils.RoleAdmin), audit.GetHandler())
+		protec.GET("/api/audit-logs/:id", middleware.Authorize(utils.RoleAdmin), audit.GetByIDHandler())
+
+		// Dashboard
+		protec.GET("/api/dashboard/summary", dashboard.SummaryHandler())
+
+		// Reports
+		protec.GET("/api/reports/availability", report.AvailabilityHandler())
+		protec.GET("/api/reports/firmware", report.FirmwareHandler())
+		protec.GET("/api/reports/lifecycle", report.LifecycleHandler())
+		protec.GET("/api/reports/subnets", report.SubnetsHandler())
 	}
 }
@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AuditLog struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	AuditID    string             `json:"audit_id"            bson:"audit_id,omitempty"`
+	UserID     string             `json:"user_id"             bson:"user_id,omitempty"`
+	Email      string             `json:"email"               bson:"email,omitempty"`
+	Role       string             `json:"role"                bson:"role,omitempty"`
+	Action     string             `json:"action"              bson:"action,omitempty"`
+	Resource   string             `json:"resource"            bson:"resource,omitempty"`
+	ResourceID string             `json:"resource_id"         bson:"resource_id,omitempty"`
+	Success    bool               `json:"success"             bson:"success"`
+	Message    string             `json:"message,omitempty"   bson:"message,omitempty"`
+	IPAddress  string             `json:"ip_address"          bson:"ip_address,omitempty"`
+	UserAgent  string             `json:"user_agent"          bson:"user_agent,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"          bson:"created_at,omitempty"`
+}
+
+// whitelist field can be sorted
+var AllowedSortFields = map[string]bool{
+	"user_id":     true,
+	"action":      true,
+	"resource":    true,
+	"resource_id": true,
+	"created_at":  true,
+}
+
+func Collection() *mongo.Collection {
+	return database.OpenCollection("audit_logs")
+}
@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// adjustable depending on usecase
+type UsecaseHandler struct {
+	Ctx           context.Context
+	Page          int64
+	Limit         int64
+	TotalData     int64
+	FilterAndSort utils.HelperUsecaseHandler
+}
+
+func (uc *UsecaseHandler) Get() ([]AuditLog, error) {
+	if uc.Page < 1 {
+		uc.Page = 1
+	}
+	if uc.Limit < 1 {
+		uc.Limit = 10
+	}
+
+	filter := uc.FilterAndSort.SetFilter() // dynamic filter by query param
+	sort := uc.FilterAndSort.SetSort()     // dynamic sort by query param
+	skip := (uc.Page - 1) * uc.Limit       // offset
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "created_at", Value: -1}}
+	}
+	opts := options.Find().
+		SetSort(sort).
+		SetSkip(skip).
+		SetLimit(uc.Limit)
+
+	// total docs
+	total, err := Collection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var datas []AuditLog
+	if err := cur.All(uc.Ctx, &datas); err != nil {
+		return nil, err
+	}
+
+	totalPages := int64(math.Ceil(float64(total) / float64(uc.Limit)))
+	if totalPages > 0 && uc.Page > totalPages {
+		datas = []AuditLog{}
+	}
+
+	uc.TotalData = total
+	return datas, nil
+}
+
+func (uc *UsecaseHandler) GetByID(id string) (*AuditLog, error) {
+	var data AuditLog
+	err := Collection().FindOne(uc.Ctx, bson.M{"audit_id": id}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + ModuleName + " with id " + id + " is not found")
+		}
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (uc *UsecaseHandler) Create(param *AuditLog) error {
+	param.ID = primitive.NewObjectID()
+	param.AuditID = param.ID.Hex()
+	param.CreatedAt = time.Now()
+
+	_, err := Collection().InsertOne(uc.Ctx, param)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Record write audit log of the current request user
+func Record(c *gin.Context, ctx context.Context, action, resource, resourceID string, success bool, message string) error {
+	param := AuditLog{
+		Action:     action,
+		Resource:   resource,
+		ResourceID: resourceID,
+		Success:    success,
+		Message:    message,
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+
+	claims, _ := c.Get("claims")
+	if tokenClaim, ok := claims.(*utils.Claims); ok {
+		param.UserID = tokenClaim.UserID
+		param.Email = tokenClaim.Email
+		param.Role = tokenClaim.Role
+	}
+
+	uc := UsecaseHandler{
+		Ctx: ctx,
+	}
+	return uc.Create(&param)
+}
@@ -0,0 +1,402 @@
+package catalog
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	BrandModuleName = "Brand"
+	ModelModuleName = "Model"
+)
+
+func GetBrandsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+		limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "10"), 10, 64)
+
+		if limit < 1 {
+			limit = 10
+		}
+		if limit > 200 {
+			limit = 200
+		}
+		if page < 1 {
+			page = 1
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		filters := map[string][]string{}
+		for key, values := range c.Request.URL.Query() {
+			if key == "page" || key == "limit" || key == "order_by" {
+				continue
+			}
+			filters[key] = values
+		}
+
+		uc := UsecaseHandler{
+			Ctx:   ctx,
+			Page:  page,
+			Limit: limit,
+			FilterAndSort: utils.HelperUsecaseHandler{
+				Filters:           filters,
+				Sort:              c.Query("order_by"),
+				AllowedSortFields: AllowedSortFields,
+			},
+		}
+
+		datas, err := uc.GetBrands()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		totalPages := int(math.Ceil(float64(uc.TotalData) / float64(limit)))
+
+		resp := utils.Response{
+			Status:  http.StatusText(http.StatusOK),
+			Message: "Successfully get all " + BrandModuleName,
+			Data:    datas,
+			Pagination: utils.Pagination{
+				Page:       int(page),
+				Limit:      int(limit),
+				TotalCount: int(uc.TotalData),
+				TotalPages: totalPages,
+				HasNext:    int(page) < totalPages,
+				HasPrev:    page > 1,
+			},
+		}
+		c.JSON(http.StatusOK, resp.BuildResponse())
+	}
+}
+
+func GetBrandByIDHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		data, err := uc.GetBrandByID(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    "Successfully get " + BrandModuleName,
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+func CreateBrandHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		param := Brand{}
+		if err := c.BindJSON(&param); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := uc.CreateBrand(&param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    BrandModuleName + " created successfully",
+			Data:       param,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+func UpdateBrandHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		param := Brand{}
+		if err := c.BindJSON(&param); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := uc.UpdateBrandByID(id, &param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    BrandModuleName + " updated successfully",
+			Data:       param,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+func DeleteBrandHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		err := uc.DeleteBrandByID(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    BrandModuleName + " deleted successfully",
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+func GetModelsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+		limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "10"), 10, 64)
+
+		if limit < 1 {
+			limit = 10
+		}
+		if limit > 200 {
+			limit = 200
+		}
+		if page < 1 {
+			page = 1
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		filters := map[string][]string{}
+		for key, values := range c.Request.URL.Query() {
+			if key == "page" || key == "limit" || key == "order_by" {
+				continue
+			}
+			filters[key] = values
+		}
+
+		uc := UsecaseHandler{
+			Ctx:   ctx,
+			Page:  page,
+			Limit: limit,
+			FilterAndSort: utils.HelperUsecaseHandler{
+				Filters:           filters,
+				Sort:              c.Query("order_by"),
+				AllowedSortFields: AllowedSortFields,
+			},
+		}
+
+		datas, err := uc.GetModels()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		totalPages := int(math.Ceil(float64(uc.TotalData) / float64(limit)))
+
+		resp := utils.Response{
+			Status:  http.StatusText(http.StatusOK),
+			Message: "Successfully get all " + ModelModuleName,
+			Data:    datas,
+			Pagination: utils.Pagination{
+				Page:       int(page),
+				Limit:      int(limit),
+				TotalCount: int(uc.TotalData),
+				TotalPages: totalPages,
+				HasNext:    int(page) < totalPages,
+				HasPrev:    page > 1,
+			},
+		}
+		c.JSON(http.StatusOK, resp.BuildResponse())
+	}
+}
+
+func GetModelByIDHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		data, err := uc.GetModelByID(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    "Successfully get " + ModelModuleName,
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+func CreateModelHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		param := Model{}
+		if err := c.BindJSON(&param); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := uc.CreateModel(&param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    ModelModuleName + " created successfully",
+			Data:       param,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+func UpdateModelHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		param := Model{}
+		if err := c.BindJSON(&param); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := uc.UpdateModelByID(id, &param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    ModelModuleName + " updated successfully",
+			Data:       param,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+func DeleteModelHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		err := uc.DeleteModelByID(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    ModelModuleName + " deleted successfully",
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// MatchHandler preview the catalog entry a free text brand & model is matched to
+func MatchHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		data, err := uc.Match(c.Query("brand"), c.Query("model"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    "Successfully match catalog",
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
@@ -0,0 +1,166 @@
+package catalog
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// lowest score to accept a match, model need to be closer as they differ by a few characters
+const (
+	minBrandScore = 0.8
+	minModelScore = 0.85
+)
+
+// default port when neither the cctv nor the model has one
+const (
+	defaultHTTPPort = 80
+	defaultRTSPPort = 554
+)
+
+// normalize keep lowercase letters & digits only, so "HIKVISION", "Hik-Vision" and "hikvision" are equal
+func normalize(v string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(v) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// score how close the text is to the name or one of its aliases.
+// Equal is 1, a prefix of at least 3 characters is 0.8 up to 1 by its length, else the levenshtein similarity
+func score(text, name string, aliases []string) float64 {
+	t := normalize(text)
+	if t == "" {
+		return 0
+	}
+
+	best := 0.0
+	for _, v := range append([]string{name}, aliases...) {
+		n := normalize(v)
+		if n == "" {
+			continue
+		}
+		short, long := t, n
+		if len(short) > len(long) {
+			short, long = long, short
+		}
+
+		var s float64
+		switch {
+		case t == n:
+			s = 1
+		case len(short) >= 3 && strings.HasPrefix(long, short):
+			s = 0.8 + 0.2*float64(len(short))/float64(len(long))
+		default:
+			s = 1 - float64(utils.Levenshtein(t, n))/float64(len([]rune(long)))
+		}
+		if s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+// Match find the catalog brand & model closest to the free text, nil when not close enough
+func (uc *UsecaseHandler) Match(brand, model string) (*MatchResult, error) {
+	res := MatchResult{}
+	if normalize(brand) == "" {
+		return &res, nil
+	}
+
+	cur, err := BrandCollection().Find(uc.Ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var brands []Brand
+	if err := cur.All(uc.Ctx, &brands); err != nil {
+		return nil, err
+	}
+
+	for k, v := range brands {
+		if s := score(brand, v.Name, v.Aliases); s >= minBrandScore && s > res.BrandScore {
+			res.Brand = &brands[k]
+			res.BrandScore = s
+		}
+	}
+	if res.Brand == nil {
+		return &res, nil
+	}
+
+	res.Model, res.ModelScore, err = uc.MatchModel(res.Brand.BrandID, model)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// MatchModel find the model of the brand closest to the free text, nil when not close enough
+func (uc *UsecaseHandler) MatchModel(brandID, model string) (*Model, float64, error) {
+	if normalize(model) == "" {
+		return nil, 0, nil
+	}
+
+	cur, err := ModelCollection().Find(uc.Ctx, bson.M{"brand_id": brandID})
+	if err != nil {
+		return nil, 0, err
+	}
+	var models []Model
+	if err := cur.All(uc.Ctx, &models); err != nil {
+		return nil, 0, err
+	}
+
+	var best *Model
+	bestScore := 0.0
+	for k, v := range models {
+		if s := score(model, v.Name, v.Aliases); s >= minModelScore && s > bestScore {
+			best = &models[k]
+			bestScore = s
+		}
+	}
+	return best, bestScore, nil
+}
+
+// StreamURLs rtsp & snapshot url of a camera of the model, empty when the model has no template.
+// Port is the http port of the camera and channel its recorder channel, model default is used when nil
+func (m *Model) StreamURLs(ip string, port, channel *int) (rtsp, snapshot string) {
+	httpPort := defaultHTTPPort
+	if m.HTTPPort != nil {
+		httpPort = *m.HTTPPort
+	}
+	if port != nil {
+		httpPort = *port
+	}
+	rtspPort := defaultRTSPPort
+	if m.RTSPPort != nil {
+		rtspPort = *m.RTSPPort
+	}
+	ch := 1
+	if channel != nil {
+		ch = *channel
+	}
+
+	host := net.JoinHostPort(ip, strconv.Itoa(httpPort))
+	r := strings.NewReplacer(
+		"{ip}", ip,
+		"{host}", host,
+		"{http_port}", strconv.Itoa(httpPort),
+		"{rtsp_port}", strconv.Itoa(rtspPort),
+		"{channel}", strconv.Itoa(ch),
+	)
+
+	if m.RTSPPathTemplate != nil && *m.RTSPPathTemplate != "" {
+		rtsp = "rtsp://" + net.JoinHostPort(ip, strconv.Itoa(rtspPort)) + r.Replace(*m.RTSPPathTemplate)
+	}
+	if m.SnapshotURLTemplate != nil && *m.SnapshotURLTemplate != "" {
+		snapshot = r.Replace(*m.SnapshotURLTemplate)
+	}
+	return rtsp, snapshot
+}
@@ -0,0 +1,97 @@
+package catalog
+
+import (
+	"context"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// camera brand, aliases are other spelling matched to the brand, e.g. hik
+type Brand struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	BrandID   string             `json:"brand_id"            bson:"brand_id,omitempty"`
+	Name      string             `json:"name"                validate:"required,max=100" bson:"name,omitempty"`
+	Key       string             `json:"-"                   bson:"key,omitempty"` // normalized name, unique
+	Aliases   []string           `json:"aliases"             validate:"dive,required,max=100" bson:"aliases"`
+	CreatedAt time.Time          `json:"created_at"          bson:"created_at,omitempty"`
+	UpdatedAt time.Time          `json:"updated_at"          bson:"updated_at,omitempty"`
+}
+
+// camera model of a brand and its capabilities.
+// Templates may use {ip}, {host} (ip:http port), {http_port}, {rtsp_port} and {channel}
+type Model struct {
+	ID                         primitive.ObjectID `bson:"_id,omitempty"`
+	ModelID                    string             `json:"model_id"              bson:"model_id,omitempty"`
+	BrandID                    string             `json:"brand_id"              validate:"required" bson:"brand_id,omitempty"`
+	Name                       string             `json:"name"                  validate:"required,max=100" bson:"name,omitempty"`
+	Key                        string             `json:"-"                     bson:"key,omitempty"` // normalized name, unique per brand
+	Aliases                    []string           `json:"aliases"               validate:"dive,required,max=100" bson:"aliases"`
+	Resolution                 *string            `json:"resolution"            validate:"omitempty,max=20" bson:"resolution,omitempty"` // e.g. 1920x1080
+	PTZ                        bool               `json:"ptz"                   bson:"ptz"`
+	HTTPPort                   *int               `json:"http_port"             validate:"omitempty,min=1,max=65535" bson:"http_port,omitempty"`
+	RTSPPort                   *int               `json:"rtsp_port"             validate:"omitempty,min=1,max=65535" bson:"rtsp_port,omitempty"`
+	SnapshotURLTemplate        *string            `json:"snapshot_url_template" bson:"snapshot_url_template,omitempty"`                                           // e.g. http://{host}/ISAPI/Streaming/channels/{channel}01/picture
+	RTSPPathTemplate           *string            `json:"rtsp_path_template"    bson:"rtsp_path_template,omitempty"`                                              // e.g. /Streaming/Channels/{channel}01
+	MinFirmwareVersion         *string            `json:"min_firmware_version"  validate:"omitempty,max=50" bson:"min_firmware_version,omitempty"`                // older firmware is not compliant
+	RecommendedFirmwareVersion *string            `json:"recommended_firmware_version" validate:"omitempty,max=50" bson:"recommended_firmware_version,omitempty"` // older firmware should be updated
+	CreatedAt                  time.Time          `json:"created_at"            bson:"created_at,omitempty"`
+	UpdatedAt                  time.Time          `json:"updated_at"            bson:"updated_at,omitempty"`
+}
+
+// best catalog entry for a free text brand & model, score is 0 to 1
+type MatchResult struct {
+	Brand      *Brand  `json:"brand"`
+	BrandScore float64 `json:"brand_score"`
+	Model      *Model  `json:"model"`
+	ModelScore float64 `json:"model_score"`
+}
+
+// whitelist field can be sorted
+var AllowedSortFields = map[string]bool{
+	"name":       true,
+	"brand_id":   true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+func BrandCollection() *mongo.Collection {
+	return database.OpenCollection("catalog_brands")
+}
+
+func ModelCollection() *mongo.Collection {
+	return database.OpenCollection("catalog_models")
+}
+
+func CctvCollection() *mongo.Collection {
+	return database.OpenCollection("cctvs")
+}
+
+func EnsureIndexes(ctx context.Context) error {
+	_, err := BrandCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = ModelCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "brand_id", Value: 1}, {Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// cctv by catalog entry, used on delete & migration
+	_, err = CctvCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "brand_id", Value: 1}}},
+		{Keys: bson.D{{Key: "model_id", Value: 1}}},
+	})
+	return err
+}
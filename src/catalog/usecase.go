@@ -0,0 +1,325 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// adjustable depending on usecase
+type UsecaseHandler struct {
+	Ctx           context.Context
+	Page          int64
+	Limit         int64
+	TotalData     int64
+	FilterAndSort utils.HelperUsecaseHandler
+}
+
+var valildator = validator.New()
+
+func (uc *UsecaseHandler) GetBrands() ([]Brand, error) {
+	datas := []Brand{}
+	err := uc.find(BrandCollection(), &datas)
+	return datas, err
+}
+
+func (uc *UsecaseHandler) GetModels() ([]Model, error) {
+	datas := []Model{}
+	err := uc.find(ModelCollection(), &datas)
+	return datas, err
+}
+
+// find one page of the collection into datas, sorted by name by default
+func (uc *UsecaseHandler) find(coll *mongo.Collection, datas interface{}) error {
+	if uc.Page < 1 {
+		uc.Page = 1
+	}
+	if uc.Limit < 1 {
+		uc.Limit = 10
+	}
+
+	filter := uc.FilterAndSort.SetFilter() // dynamic filter by query param
+	sort := uc.FilterAndSort.SetSort()     // dynamic sort by query param
+	skip := (uc.Page - 1) * uc.Limit       // offset
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "name", Value: 1}}
+	}
+	opts := options.Find().
+		SetSort(sort).
+		SetSkip(skip).
+		SetLimit(uc.Limit)
+
+	// total docs
+	total, err := coll.CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	totalPages := int64(math.Ceil(float64(total) / float64(uc.Limit)))
+	uc.TotalData = total
+	if totalPages > 0 && uc.Page > totalPages {
+		return nil
+	}
+
+	cur, err := coll.Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(uc.Ctx)
+
+	return cur.All(uc.Ctx, datas)
+}
+
+func (uc *UsecaseHandler) CreateBrand(param *Brand) error {
+	if err := uc.validateBrand(param, ""); err != nil {
+		return err
+	}
+
+	param.ID = primitive.NewObjectID()
+	param.BrandID = param.ID.Hex()
+	param.CreatedAt = time.Now()
+	param.UpdatedAt = time.Now()
+
+	_, err := BrandCollection().InsertOne(uc.Ctx, param)
+	return err
+}
+
+func (uc *UsecaseHandler) GetBrandByID(id string) (*Brand, error) {
+	var data Brand
+	err := BrandCollection().FindOne(uc.Ctx, bson.M{"brand_id": id}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + BrandModuleName + " with id " + id + " is not found")
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+// UpdateBrandByID update the brand, new name is copied to the cctvs of the brand
+func (uc *UsecaseHandler) UpdateBrandByID(id string, param *Brand) error {
+	// validate id exists
+	oldData, err := uc.GetBrandByID(id)
+	if err != nil {
+		return err
+	}
+	if err := uc.validateBrand(param, id); err != nil {
+		return err
+	}
+
+	param.ID = oldData.ID
+	param.BrandID = oldData.BrandID
+	param.CreatedAt = oldData.CreatedAt
+	param.UpdatedAt = time.Now()
+
+	_, err = BrandCollection().ReplaceOne(uc.Ctx, bson.M{"brand_id": id}, param)
+	if err != nil {
+		return err
+	}
+
+	if param.Name != oldData.Name {
+		_, err = CctvCollection().UpdateMany(uc.Ctx, bson.M{"brand_id": id}, bson.M{"$set": bson.M{"brand": param.Name}})
+	}
+	return err
+}
+
+// DeleteBrandByID delete the brand, refused while it still has models or cctvs
+func (uc *UsecaseHandler) DeleteBrandByID(id string) error {
+	// validate id exists
+	if _, err := uc.GetBrandByID(id); err != nil {
+		return err
+	}
+
+	count, err := ModelCollection().CountDocuments(uc.Ctx, bson.M{"brand_id": id})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("Brand still has models, delete them first")
+	}
+	count, err = CctvCollection().CountDocuments(uc.Ctx, bson.M{"brand_id": id})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("Brand still has CCTV assigned, move them first")
+	}
+
+	_, err = BrandCollection().DeleteOne(uc.Ctx, bson.M{"brand_id": id})
+	return err
+}
+
+func (uc *UsecaseHandler) CreateModel(param *Model) error {
+	if err := uc.validateModel(param, ""); err != nil {
+		return err
+	}
+
+	param.ID = primitive.NewObjectID()
+	param.ModelID = param.ID.Hex()
+	param.CreatedAt = time.Now()
+	param.UpdatedAt = time.Now()
+
+	_, err := ModelCollection().InsertOne(uc.Ctx, param)
+	return err
+}
+
+func (uc *UsecaseHandler) GetModelByID(id string) (*Model, error) {
+	var data Model
+	err := ModelCollection().FindOne(uc.Ctx, bson.M{"model_id": id}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + ModelModuleName + " with id " + id + " is not found")
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+// UpdateModelByID update the model, the brand cannot be changed and new name is copied to the cctvs of the model.
+// Stream urls already stored on the cctvs are kept
+func (uc *UsecaseHandler) UpdateModelByID(id string, param *Model) error {
+	// validate id exists
+	oldData, err := uc.GetModelByID(id)
+	if err != nil {
+		return err
+	}
+
+	param.BrandID = oldData.BrandID
+	if err := uc.validateModel(param, id); err != nil {
+		return err
+	}
+
+	param.ID = oldData.ID
+	param.ModelID = oldData.ModelID
+	param.CreatedAt = oldData.CreatedAt
+	param.UpdatedAt = time.Now()
+
+	_, err = ModelCollection().ReplaceOne(uc.Ctx, bson.M{"model_id": id}, param)
+	if err != nil {
+		return err
+	}
+
+	if param.Name != oldData.Name {
+		_, err = CctvCollection().UpdateMany(uc.Ctx, bson.M{"model_id": id}, bson.M{"$set": bson.M{"model": param.Name}})
+	}
+	return err
+}
+
+// DeleteModelByID delete the model, refused while cctvs still use it
+func (uc *UsecaseHandler) DeleteModelByID(id string) error {
+	// validate id exists
+	if _, err := uc.GetModelByID(id); err != nil {
+		return err
+	}
+
+	count, err := CctvCollection().CountDocuments(uc.Ctx, bson.M{"model_id": id})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("Model still has CCTV assigned, move them first")
+	}
+
+	_, err = ModelCollection().DeleteOne(uc.Ctx, bson.M{"model_id": id})
+	return err
+}
+
+func (uc *UsecaseHandler) validateBrand(param *Brand, excludeID string) error {
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+	param.Name = strings.TrimSpace(param.Name)
+	param.Key = normalize(param.Name)
+	if param.Key == "" {
+		return errors.New("Name must have a letter or digit")
+	}
+	param.Aliases = cleanAliases(param.Aliases)
+
+	filter := bson.M{"key": param.Key}
+	if excludeID != "" {
+		filter["brand_id"] = bson.M{"$ne": excludeID}
+	}
+	count, err := BrandCollection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("Brand " + param.Name + " already exists")
+	}
+	return nil
+}
+
+func (uc *UsecaseHandler) validateModel(param *Model, excludeID string) error {
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+	param.Name = strings.TrimSpace(param.Name)
+	param.Key = normalize(param.Name)
+	if param.Key == "" {
+		return errors.New("Name must have a letter or digit")
+	}
+	param.Aliases = cleanAliases(param.Aliases)
+
+	// validate brand exists
+	if _, err := uc.GetBrandByID(param.BrandID); err != nil {
+		return err
+	}
+
+	// validate templates give a valid url
+	rtsp, snapshot := param.StreamURLs("192.0.2.1", nil, nil)
+	if param.RTSPPathTemplate != nil && !strings.HasPrefix(*param.RTSPPathTemplate, "/") {
+		return errors.New("RTSP path template must start with /")
+	}
+	if u, err := url.Parse(rtsp); rtsp != "" && (err != nil || u.Host == "") {
+		return errors.New("Invalid RTSP path template")
+	}
+	if u, err := url.Parse(snapshot); snapshot != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		return errors.New("Snapshot URL template must be a http or https url")
+	}
+
+	// validate recommended firmware is not older than the minimum
+	if param.MinFirmwareVersion != nil && param.RecommendedFirmwareVersion != nil &&
+		utils.CompareVersions(*param.RecommendedFirmwareVersion, *param.MinFirmwareVersion) < 0 {
+		return errors.New("Recommended firmware must not be older than the minimum firmware")
+	}
+
+	filter := bson.M{"brand_id": param.BrandID, "key": param.Key}
+	if excludeID != "" {
+		filter["model_id"] = bson.M{"$ne": excludeID}
+	}
+	count, err := ModelCollection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("Model " + param.Name + " already exists in the brand")
+	}
+	return nil
+}
+
+// trimmed aliases without duplicate, never nil so the document always has the array
+func cleanAliases(aliases []string) []string {
+	seen := map[string]bool{}
+	res := []string{}
+	for _, v := range aliases {
+		v = strings.TrimSpace(v)
+		key := normalize(v)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		res = append(res, v)
+	}
+	return res
+}
@@ -0,0 +1,249 @@
+package cctv
+
+import (
+	"errors"
+
+	"github.com/maulanar/gin-kecilin/src/catalog"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// brand & model pair found on cctvs without catalog brand, and the catalog entry it is matched to
+type CatalogMigration struct {
+	Brand   *string `json:"brand"`
+	Model   *string `json:"model"`
+	Count   int64   `json:"count"`
+	BrandID *string `json:"brand_id"`
+	ModelID *string `json:"model_id"`
+}
+
+// applyCatalog link brand & model to the catalog: brand_id & model_id are checked and their names copied,
+// free text brand & model is matched to the catalog when close enough. Stream urls are pre-filled from the model
+func (uc *UsecaseHandler) applyCatalog(param *Cctv, oldData *Cctv) error {
+	catalogUC := catalog.UsecaseHandler{Ctx: uc.Ctx}
+	if param.BrandID != nil && *param.BrandID == "" {
+		param.BrandID = nil
+	}
+	if param.ModelID != nil && *param.ModelID == "" {
+		param.ModelID = nil
+	}
+
+	var model *catalog.Model
+	switch {
+	case param.ModelID != nil:
+		m, err := catalogUC.GetModelByID(*param.ModelID)
+		if err != nil {
+			return err
+		}
+		if param.BrandID != nil && *param.BrandID != m.BrandID {
+			return errors.New("Model " + m.Name + " is not of brand " + *param.BrandID)
+		}
+		b, err := catalogUC.GetBrandByID(m.BrandID)
+		if err != nil {
+			return err
+		}
+		param.BrandID, param.Brand, param.Model = &b.BrandID, &b.Name, &m.Name
+		model = m
+
+	case param.BrandID != nil:
+		b, err := catalogUC.GetBrandByID(*param.BrandID)
+		if err != nil {
+			return err
+		}
+		param.Brand = &b.Name
+
+		// free text model is still matched inside the brand
+		if text := pick(param.Model, oldData, func(v *Cctv) *string { return v.Model }); text != nil {
+			m, _, err := catalogUC.MatchModel(b.BrandID, *text)
+			if err != nil {
+				return err
+			}
+			if m != nil {
+				param.ModelID, param.Model = &m.ModelID, &m.Name
+				model = m
+			}
+		}
+
+	case param.Brand != nil || param.Model != nil:
+		brand := pick(param.Brand, oldData, func(v *Cctv) *string { return v.Brand })
+		text := pick(param.Model, oldData, func(v *Cctv) *string { return v.Model })
+		if brand == nil {
+			break
+		}
+		modelText := ""
+		if text != nil {
+			modelText = *text
+		}
+		res, err := catalogUC.Match(*brand, modelText)
+		if err != nil {
+			return err
+		}
+		if res.Brand != nil {
+			param.BrandID, param.Brand = &res.Brand.BrandID, &res.Brand.Name
+		}
+		if res.Model != nil {
+			param.ModelID, param.Model = &res.Model.ModelID, &res.Model.Name
+			model = res.Model
+		}
+
+	case oldData != nil && oldData.ModelID != nil:
+		// brand & model not changed, stored model still fill urls when the address change
+		m, err := catalogUC.GetModelByID(*oldData.ModelID)
+		if err != nil {
+			return err
+		}
+		model = m
+	}
+
+	prefillStreamURLs(param, oldData, model)
+	return nil
+}
+
+// pick the sent value, or the stored one on update
+func pick(v *string, oldData *Cctv, stored func(*Cctv) *string) *string {
+	if v == nil && oldData != nil {
+		return stored(oldData)
+	}
+	return v
+}
+
+// prefillStreamURLs fill the rtsp & snapshot url not sent from the templates of the catalog model.
+// Stored credentials are encrypted, so on update urls are only filled when credentials are sent or none is stored
+func prefillStreamURLs(param *Cctv, oldData *Cctv, model *catalog.Model) {
+	if model == nil {
+		return
+	}
+
+	ip, port, channel := param.IPAddress, param.Port, param.Channel
+	if oldData != nil {
+		if ip == nil {
+			ip = oldData.IPAddress
+		}
+		if port == nil {
+			port = oldData.Port
+		}
+		if channel == nil {
+			channel = oldData.Channel
+		}
+	}
+	if ip == nil || *ip == "" {
+		return
+	}
+
+	creds := param.Credentials
+	switch {
+	case creds == nil && oldData != nil && oldData.HasCredentials:
+		return
+	case creds == nil:
+		creds = &Credentials{}
+	case creds.IsEmpty() && oldData != nil:
+		// empty credentials remove the stored one
+		return
+	}
+
+	rtsp, snapshot := model.StreamURLs(*ip, port, channel)
+	if creds.RTSPURL == nil && rtsp != "" {
+		creds.RTSPURL = &rtsp
+	}
+	if creds.SnapshotURL == nil && snapshot != "" {
+		creds.SnapshotURL = &snapshot
+	}
+	if !creds.IsEmpty() {
+		param.Credentials = creds
+	}
+}
+
+// unsetCatalog remove catalog id not matched when brand or model is changed, they are skipped by $set as omitempty
+func unsetCatalog(update bson.M, param *Cctv) {
+	if param.Brand == nil && param.Model == nil {
+		return
+	}
+	unset, _ := update["$unset"].(bson.M)
+	if unset == nil {
+		unset = bson.M{}
+	}
+	if param.BrandID == nil {
+		unset["brand_id"] = ""
+	}
+	if param.ModelID == nil {
+		unset["model_id"] = ""
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+}
+
+// MigrateCatalog match the free text brand & model of every cctv without catalog brand,
+// matched cctvs get the catalog id and name. Dry run only report the matches
+func (uc *UsecaseHandler) MigrateCatalog(dryRun bool) ([]CatalogMigration, int64, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{
+			"brand_id": bson.M{"$exists": false},
+			"brand":    bson.M{"$nin": bson.A{nil, ""}},
+		}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"brand": "$brand", "model": "$model"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "_id.brand", Value: 1}, {Key: "_id.model", Value: 1}}}},
+	}
+	cur, err := Collection().Aggregate(uc.Ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var pairs []struct {
+		ID struct {
+			Brand *string `bson:"brand"`
+			Model *string `bson:"model"`
+		} `bson:"_id"`
+		Count int64 `bson:"count"`
+	}
+	if err := cur.All(uc.Ctx, &pairs); err != nil {
+		return nil, 0, err
+	}
+
+	catalogUC := catalog.UsecaseHandler{Ctx: uc.Ctx}
+	res := []CatalogMigration{}
+	var updated int64
+	for _, p := range pairs {
+		row := CatalogMigration{Brand: p.ID.Brand, Model: p.ID.Model, Count: p.Count}
+		model := ""
+		if p.ID.Model != nil {
+			model = *p.ID.Model
+		}
+		match, err := catalogUC.Match(*p.ID.Brand, model)
+		if err != nil {
+			return nil, 0, err
+		}
+		if match.Brand == nil {
+			res = append(res, row)
+			continue
+		}
+
+		set := bson.M{"brand_id": match.Brand.BrandID, "brand": match.Brand.Name}
+		row.BrandID = &match.Brand.BrandID
+		if match.Model != nil {
+			set["model_id"] = match.Model.ModelID
+			set["model"] = match.Model.Name
+			row.ModelID = &match.Model.ModelID
+		}
+		res = append(res, row)
+		if dryRun {
+			continue
+		}
+
+		// missing model is matched by null
+		ur, err := Collection().UpdateMany(uc.Ctx,
+			bson.M{"brand_id": bson.M{"$exists": false}, "brand": p.ID.Brand, "model": p.ID.Model},
+			bson.M{"$set": set},
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		updated += ur.ModifiedCount
+	}
+	return res, updated, nil
+}
@@ -0,0 +1,182 @@
+package cctv
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/maulanar/gin-kecilin/src/contact"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// normalizeContacts keep contact_id and the owner link in sync, links are sorted by role then priority.
+// Without contacts on update the current links are kept, only the owner follow contact_id
+func normalizeContacts(param *Cctv, oldData *Cctv) error {
+	if param.Contacts == nil {
+		links := []contact.CctvContact{}
+		if oldData != nil {
+			if param.ContactID == "" {
+				param.ContactID = oldData.ContactID
+			}
+			for _, v := range oldData.Contacts {
+				if v.Role != contact.RoleOwner {
+					links = append(links, v)
+				}
+			}
+		}
+		if param.ContactID != "" {
+			links = append(links, contact.CctvContact{ContactID: param.ContactID, Role: contact.RoleOwner})
+		}
+		param.Contacts = links
+	} else {
+		var owner *contact.CctvContact
+		for i, v := range param.Contacts {
+			if v.Role != contact.RoleOwner {
+				continue
+			}
+			if owner != nil {
+				return errors.New(ModuleName + " can only have one owner contact")
+			}
+			owner = &param.Contacts[i]
+		}
+		switch {
+		case owner == nil && param.ContactID != "":
+			param.Contacts = append(param.Contacts, contact.CctvContact{ContactID: param.ContactID, Role: contact.RoleOwner})
+		case owner != nil && param.ContactID == "":
+			param.ContactID = owner.ContactID
+		case owner != nil && owner.ContactID != param.ContactID:
+			return errors.New("Contact id must be the same as the owner contact")
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, v := range param.Contacts {
+		key := v.Role + ":" + v.ContactID
+		if seen[key] {
+			return errors.New("Contact " + v.ContactID + " is linked as " + v.Role + " more than once")
+		}
+		seen[key] = true
+	}
+
+	rank := map[string]int{}
+	for i, v := range contact.Roles {
+		rank[v] = i
+	}
+	sort.SliceStable(param.Contacts, func(i, j int) bool {
+		a, b := param.Contacts[i], param.Contacts[j]
+		if a.Role != b.Role {
+			return rank[a.Role] < rank[b.Role]
+		}
+		return a.Priority < b.Priority
+	})
+	return nil
+}
+
+// validateContacts check every linked contact exists
+func (uc *UsecaseHandler) validateContacts(param *Cctv) error {
+	for _, v := range param.Contacts {
+		if err := valildator.Struct(v); err != nil {
+			return err
+		}
+	}
+
+	contacts, err := uc.findContacts([]Cctv{*param})
+	if err != nil {
+		return err
+	}
+	for _, v := range param.Contacts {
+		if contacts[v.ContactID] == nil {
+			return errors.New("Data " + contact.ModuleName + " with id " + v.ContactID + " is not found")
+		}
+	}
+	return nil
+}
+
+// attachContacts embed the owner contact and every linked contact grouped by role.
+// Missing contact is left out, contact is nil when the owner is missing, see repair-orphans
+func (uc *UsecaseHandler) attachContacts(datas []Cctv) error {
+	contacts, err := uc.findContacts(datas)
+	if err != nil {
+		return err
+	}
+
+	for k := range datas {
+		v := &datas[k]
+		v.Contact = contacts[v.ContactID]
+
+		v.ContactsByRole = map[string][]contact.RoleContact{}
+		for _, link := range v.Contacts {
+			if c := contacts[link.ContactID]; c != nil {
+				v.ContactsByRole[link.Role] = append(v.ContactsByRole[link.Role], contact.RoleContact{Priority: link.Priority, Contact: c})
+			}
+		}
+		// cctv not migrated yet only has contact_id
+		if len(v.ContactsByRole[contact.RoleOwner]) == 0 && v.Contact != nil {
+			v.ContactsByRole[contact.RoleOwner] = []contact.RoleContact{{Contact: v.Contact}}
+		}
+	}
+	return nil
+}
+
+// findContacts get every contact referenced by the cctvs in one query, keyed by contact_id
+func (uc *UsecaseHandler) findContacts(datas []Cctv) (map[string]*contact.Contact, error) {
+	ids := []string{}
+	for _, v := range datas {
+		ids = append(ids, v.ContactID)
+		for _, link := range v.Contacts {
+			ids = append(ids, link.ContactID)
+		}
+	}
+
+	res := map[string]*contact.Contact{}
+	if len(ids) == 0 {
+		return res, nil
+	}
+	cur, err := contact.Collection().Find(uc.Ctx, bson.M{"contact_id": bson.M{"$in": ids}}, options.Find())
+	if err != nil {
+		return nil, err
+	}
+	var contacts []contact.Contact
+	if err := cur.All(uc.Ctx, &contacts); err != nil {
+		return nil, err
+	}
+	for k := range contacts {
+		res[contacts[k].ContactID] = &contacts[k]
+	}
+	return res, nil
+}
+
+// contactRoleFilter turn contact_role into a match on the contact links,
+// together with contact_id both must match the same link
+func contactRoleFilter(filter bson.M) {
+	role, ok := filter["contact_role"]
+	if !ok {
+		return
+	}
+	delete(filter, "contact_role")
+
+	link := bson.M{"role": role}
+	if id, ok := filter["contact_id"]; ok {
+		link["contact_id"] = id
+		delete(filter, "contact_id")
+	}
+	filter["contacts"] = bson.M{"$elemMatch": link}
+}
+
+// MigrateContacts add the owner link to cctvs created before contact links existed
+func (uc *UsecaseHandler) MigrateContacts() (int64, error) {
+	res, err := Collection().UpdateMany(uc.Ctx,
+		bson.M{"contacts": bson.M{"$exists": false}, "contact_id": bson.M{"$exists": true}},
+		mongo.Pipeline{
+			bson.D{{Key: "$set", Value: bson.M{"contacts": bson.A{
+				bson.M{"contact_id": "$contact_id", "role": contact.RoleOwner, "priority": 0},
+			}}}},
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
@@ -0,0 +1,133 @@
+package cctv
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/maulanar/gin-kecilin/src/contact"
+)
+
+func TestNormalizeContacts(t *testing.T) {
+	owner := func(id string) contact.CctvContact {
+		return contact.CctvContact{ContactID: id, Role: contact.RoleOwner}
+	}
+	technical := func(id string, priority int) contact.CctvContact {
+		return contact.CctvContact{ContactID: id, Role: contact.RoleTechnical, Priority: priority}
+	}
+	emergency := func(id string, priority int) contact.CctvContact {
+		return contact.CctvContact{ContactID: id, Role: contact.RoleEmergency, Priority: priority}
+	}
+	old := &Cctv{
+		ContactID: "c-1",
+		Contacts:  []contact.CctvContact{owner("c-1"), emergency("c-3", 0), technical("c-2", 1)},
+	}
+
+	tests := []struct {
+		name          string
+		param         Cctv
+		old           *Cctv
+		wantContactID string
+		want          []contact.CctvContact
+		wantErr       bool
+	}{
+		{
+			name:          "create with contact id only",
+			param:         Cctv{ContactID: "c-1"},
+			wantContactID: "c-1",
+			want:          []contact.CctvContact{owner("c-1")},
+		},
+		{
+			name:  "create without contact",
+			param: Cctv{},
+			want:  []contact.CctvContact{},
+		},
+		{
+			name:          "owner link added from contact id",
+			param:         Cctv{ContactID: "c-1", Contacts: []contact.CctvContact{technical("c-2", 0)}},
+			wantContactID: "c-1",
+			want:          []contact.CctvContact{owner("c-1"), technical("c-2", 0)},
+		},
+		{
+			name:          "contact id taken from owner link",
+			param:         Cctv{Contacts: []contact.CctvContact{technical("c-2", 0), owner("c-1")}},
+			wantContactID: "c-1",
+			want:          []contact.CctvContact{owner("c-1"), technical("c-2", 0)},
+		},
+		{
+			name:    "owner link differ from contact id",
+			param:   Cctv{ContactID: "c-1", Contacts: []contact.CctvContact{owner("c-2")}},
+			wantErr: true,
+		},
+		{
+			name:    "more than one owner",
+			param:   Cctv{Contacts: []contact.CctvContact{owner("c-1"), owner("c-2")}},
+			wantErr: true,
+		},
+		{
+			name:    "same contact twice in a role",
+			param:   Cctv{ContactID: "c-1", Contacts: []contact.CctvContact{technical("c-2", 0), technical("c-2", 1)}},
+			wantErr: true,
+		},
+		{
+			name:          "same contact in several roles",
+			param:         Cctv{ContactID: "c-1", Contacts: []contact.CctvContact{emergency("c-1", 0), technical("c-1", 0)}},
+			wantContactID: "c-1",
+			want:          []contact.CctvContact{owner("c-1"), technical("c-1", 0), emergency("c-1", 0)},
+		},
+		{
+			name: "sorted by role then priority",
+			param: Cctv{ContactID: "c-1", Contacts: []contact.CctvContact{
+				emergency("c-5", 2), technical("c-3", 1), emergency("c-4", 0), technical("c-2", 0),
+			}},
+			wantContactID: "c-1",
+			want: []contact.CctvContact{
+				owner("c-1"), technical("c-2", 0), technical("c-3", 1), emergency("c-4", 0), emergency("c-5", 2),
+			},
+		},
+		{
+			name:          "update without contacts keep the links",
+			param:         Cctv{},
+			old:           old,
+			wantContactID: "c-1",
+			want:          []contact.CctvContact{owner("c-1"), technical("c-2", 1), emergency("c-3", 0)},
+		},
+		{
+			name:          "update without contacts move the owner",
+			param:         Cctv{ContactID: "c-9"},
+			old:           old,
+			wantContactID: "c-9",
+			want:          []contact.CctvContact{owner("c-9"), technical("c-2", 1), emergency("c-3", 0)},
+		},
+		{
+			name:          "update with contacts replace the links",
+			param:         Cctv{Contacts: []contact.CctvContact{owner("c-1")}},
+			old:           old,
+			wantContactID: "c-1",
+			want:          []contact.CctvContact{owner("c-1")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := tt.param
+			err := normalizeContacts(&param, tt.old)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeContacts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if param.ContactID != tt.wantContactID {
+				t.Errorf("normalizeContacts() contact id = %q, want %q", param.ContactID, tt.wantContactID)
+			}
+			if !reflect.DeepEqual(param.Contacts, tt.want) {
+				t.Errorf("normalizeContacts() contacts = %+v, want %+v", param.Contacts, tt.want)
+			}
+		})
+	}
+
+	// links of the old data are not changed
+	want := []contact.CctvContact{owner("c-1"), emergency("c-3", 0), technical("c-2", 1)}
+	if !reflect.DeepEqual(old.Contacts, want) {
+		t.Errorf("old contacts = %+v, want %+v", old.Contacts, want)
+	}
+}
@@ -2,11 +2,22 @@ package cctv
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
 	"math"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/maulanar/gin-kecilin/src/audit"
+	"github.com/maulanar/gin-kecilin/src/customfield"
+	"github.com/maulanar/gin-kecilin/src/statushistory"
 	"github.com/maulanar/gin-kecilin/utils"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +25,9 @@ import (
 
 var ModuleName = "CCTV"
 
+// max size of import file, 10 MB
+const maxImportFile = 10 << 20
+
 func GetHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
@@ -32,12 +46,19 @@ func GetHandler() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
 		defer cancel()
 
-		filters := map[string][]string{}
-		for key, values := range c.Request.URL.Query() {
-			if key == "page" || key == "limit" || key == "order_by" {
-				continue
-			}
-			filters[key] = values
+		filters := queryFilters(c.Request.URL.Query())
+		// customer only see their own cctvs
+		utils.ScopeFilters(c, filters, "contact_id", "contact_role")
+
+		geoFilter, err := ParseGeoQuery(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		netFilter, err := NetFilters(filters)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
 		uc := UsecaseHandler{
@@ -49,6 +70,12 @@ func GetHandler() gin.HandlerFunc {
 				Sort:              c.Query("order_by"),
 				AllowedSortFields: AllowedSortFields,
 			},
+			GeoFilter: geoFilter,
+			NetFilter: netFilter,
+		}
+		if err := customfield.Apply(ctx, customfield.EntityCctv, &uc.FilterAndSort); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
 		datas, err := uc.Get()
@@ -76,6 +103,72 @@ func GetHandler() gin.HandlerFunc {
 	}
 }
 
+// query params of the list which are not field filters
+var listQueryParams = map[string]bool{
+	"page":     true,
+	"limit":    true,
+	"order_by": true,
+}
+
+// queryFilters field filters of the query, list & geo params and the extra params are skipped
+func queryFilters(query url.Values, extra ...string) map[string][]string {
+	filters := map[string][]string{}
+	for key, values := range query {
+		if listQueryParams[key] || GeoQueryParams[key] || slices.Contains(extra, key) {
+			continue
+		}
+		filters[key] = values
+	}
+	return filters
+}
+
+func GeoJSONHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		filters := queryFilters(c.Request.URL.Query())
+		// customer only see their own cctvs
+		utils.ScopeFilters(c, filters, "contact_id", "contact_role")
+
+		geoFilter, err := ParseGeoQuery(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		netFilter, err := NetFilters(filters)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+			FilterAndSort: utils.HelperUsecaseHandler{
+				Filters:           filters,
+				Sort:              c.Query("order_by"),
+				AllowedSortFields: AllowedSortFields,
+			},
+			GeoFilter: geoFilter,
+			NetFilter: netFilter,
+		}
+		if err := customfield.Apply(ctx, customfield.EntityCctv, &uc.FilterAndSort); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		data, err := uc.GetGeoJSON()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// plain FeatureCollection so map UI can consume it directly
+		c.Header("Content-Type", "application/geo+json")
+		c.JSON(http.StatusOK, data)
+	}
+}
+
 func GetByIDHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
@@ -92,6 +185,10 @@ func GetByIDHandler() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		if contactID, ok := utils.CustomerContactID(c); ok && data.ContactID != contactID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Data " + ModuleName + " with id " + id + " is not found"})
+			return
+		}
 
 		resp := utils.Response{
 			Status:     http.StatusText(http.StatusOK),
@@ -109,7 +206,8 @@ func CreateHandler() gin.HandlerFunc {
 		defer cancel()
 
 		uc := UsecaseHandler{
-			Ctx: ctx,
+			Ctx:   ctx,
+			Actor: actor(c),
 		}
 
 		param := Cctv{}
@@ -143,7 +241,8 @@ func UpdateHandler() gin.HandlerFunc {
 		defer cancel()
 
 		uc := UsecaseHandler{
-			Ctx: ctx,
+			Ctx:   ctx,
+			Actor: actor(c),
 		}
 
 		param := Cctv{}
@@ -193,3 +292,264 @@ func DeleteHandler() gin.HandlerFunc {
 		c.JSON(http.StatusOK, resp.BuildSingleResponse())
 	}
 }
+
+func CredentialsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		data, err := uc.RevealCredentials(id)
+
+		// every reveal attempt is audited
+		message := ""
+		if err != nil {
+			message = err.Error()
+		}
+		if auditErr := audit.Record(c, ctx, "cctv.credentials.reveal", "cctvs", id, err == nil, message); auditErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": auditErr.Error()})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    "Successfully get " + ModuleName + " credentials",
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+func StatusHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx:   ctx,
+			Actor: actor(c),
+		}
+
+		param := StatusChange{}
+		if err := c.BindJSON(&param); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		param.Source = statushistory.SourceManual
+		param.By = uc.Actor
+
+		data, err := uc.ChangeStatus(id, &param)
+		if err != nil {
+			// changed by other process meanwhile, client should read it again and retry
+			if errors.Is(err, ErrStatusMismatch) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    ModuleName + " status changed successfully",
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// HeartbeatHandler record the device is alive, with the firmware version it runs
+func HeartbeatHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		// body is optional
+		param := Heartbeat{}
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&param); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if err := uc.Heartbeat(id, &param); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    ModuleName + " heartbeat received",
+			Data:       param,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// email of logged in user
+func actor(c *gin.Context) string {
+	if claims, ok := utils.GetClaims(c); ok {
+		return claims.Email
+	}
+	return ""
+}
+
+// ImportHandler bulk create or update cctv from a csv or xlsx file, dry run unless dry_run=false
+func ImportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFile)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+		defer cancel()
+
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+			return
+		}
+		defer file.Close()
+
+		var rows [][]string
+		switch strings.ToLower(filepath.Ext(header.Filename)) {
+		case ".csv":
+			reader := csv.NewReader(file)
+			reader.FieldsPerRecord = -1
+			rows, err = reader.ReadAll()
+		case ".xlsx":
+			rows, err = utils.ReadXLSX(file, header.Size, maxImportRows+1)
+		default:
+			err = errors.New("File must be .csv or .xlsx")
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		param := ImportParam{
+			Rows:      rows,
+			DryRun:    c.DefaultPostForm("dry_run", "true") != "false",
+			UpsertBy:  c.PostForm("upsert_by"),
+			ContactID: c.PostForm("contact_id"),
+		}
+		if v := c.PostForm("mapping"); v != "" {
+			if err := json.Unmarshal([]byte(v), &param.Mapping); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping, must be JSON object of column to field"})
+				return
+			}
+		}
+
+		uc := UsecaseHandler{
+			Ctx:   ctx,
+			Actor: actor(c),
+		}
+
+		data, err := uc.Import(&param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		message := ModuleName + " imported successfully"
+		if param.DryRun {
+			message = ModuleName + " import checked, nothing is saved on dry run"
+		}
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    message,
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// ExportHandler stream cctvs matching the same filter & sort as GetHandler, format csv (default), xlsx or ndjson
+func ExportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := strings.ToLower(c.DefaultQuery("format", utils.ExportCSV))
+		contentType, ok := utils.ExportContentTypes[format]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv, xlsx or ndjson"})
+			return
+		}
+		paths, err := customfield.ExportColumns(c.Request.Context(), customfield.EntityCctv, ExportColumns)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		columns, err := utils.ParseExportColumns(c.Query("columns"), paths, DefaultExportColumns)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Minute)
+		defer cancel()
+
+		filters := queryFilters(c.Request.URL.Query(), "format", "columns")
+		// customer only see their own cctvs
+		utils.ScopeFilters(c, filters, "contact_id", "contact_role")
+
+		geoFilter, err := ParseGeoQuery(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		netFilter, err := NetFilters(filters)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+			FilterAndSort: utils.HelperUsecaseHandler{
+				Filters:           filters,
+				Sort:              c.Query("order_by"),
+				AllowedSortFields: AllowedSortFields,
+			},
+			GeoFilter: geoFilter,
+			NetFilter: netFilter,
+		}
+		if err := customfield.Apply(ctx, customfield.EntityCctv, &uc.FilterAndSort); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="cctvs_`+time.Now().Format("20060102")+"."+format+`"`)
+		c.Status(http.StatusOK)
+
+		w, err := utils.NewExportWriter(format, c.Writer, columns)
+		if err == nil {
+			err = uc.Export(w, columns, paths)
+		}
+		if err != nil {
+			// headers are already sent, only log it
+			log.Printf("Export %s failed: %v", ModuleName, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cctv
+
+import (
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exportable column and its document path, credentials is never exported
+var ExportColumns = map[string]string{
+	"cctv_id":             "cctv_id",
+	"external_id":         "external_id",
+	"contact_id":          "contact_id",
+	"contacts":            "contacts",
+	"name":                "name",
+	"location":            "location",
+	"latitude":            "coordinates.coordinates.1",
+	"longitude":           "coordinates.coordinates.0",
+	"site_id":             "site_id",
+	"zone_id":             "zone_id",
+	"ip_address":          "ip_address",
+	"port":                "port",
+	"mac_address":         "mac_address",
+	"vlan":                "vlan",
+	"recorder_id":         "recorder_id",
+	"channel":             "channel",
+	"brand":               "brand",
+	"model":               "model",
+	"brand_id":            "brand_id",
+	"model_id":            "model_id",
+	"firmware_version":    "firmware_version",
+	"firmware_updated_at": "firmware_updated_at",
+	"last_heartbeat_at":   "last_heartbeat_at",
+	"purchase_date":       "purchase_date",
+	"installer":           "installer",
+	"warranty_expiry":     "warranty_expiry",
+	"replacement_date":    "replacement_date",
+	"status":              "status",
+	"tags":                "tags",
+	"created_at":          "created_at",
+	"updated_at":          "updated_at",
+
+	// every custom field as json, or one column per field as custom_fields.<key>
+	"custom_fields": "custom_fields",
+}
+
+var DefaultExportColumns = []string{
+	"cctv_id", "external_id", "contact_id", "name", "location", "latitude", "longitude",
+	"site_id", "zone_id", "ip_address", "port", "recorder_id", "channel",
+	"brand", "model", "status", "tags", "created_at", "updated_at",
+}
+
+// Export write every cctv matching the filter, read from the cursor one by one.
+// Paths are ExportColumns with the custom field columns
+func (uc *UsecaseHandler) Export(w utils.ExportWriter, columns []string, paths map[string]string) error {
+	filter := uc.buildFilter()
+	opts := options.Find().
+		SetProjection(utils.ExportProjection(columns, paths)).
+		SetSort(uc.FilterAndSort.SetSort()).
+		SetBatchSize(500)
+
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(uc.Ctx)
+
+	values := make([]interface{}, len(columns))
+	for cur.Next(uc.Ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return err
+		}
+		for i, c := range columns {
+			values[i] = utils.DocValue(doc, paths[c])
+		}
+		if err := w.Write(values); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	return w.Close()
+}
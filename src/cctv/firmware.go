@@ -0,0 +1,83 @@
+package cctv
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// heartbeat sent by the device or its agent, firmware version is optional
+type Heartbeat struct {
+	FirmwareVersion *string `json:"firmware_version"    validate:"omitempty,max=50"`
+
+	// set by the server
+	CctvID            string     `json:"cctv_id"`
+	FirmwareUpdatedAt *time.Time `json:"firmware_updated_at"`
+	LastHeartbeatAt   time.Time  `json:"last_heartbeat_at"`
+}
+
+// applyFirmware trim the firmware version, firmware updated time is set to now when the version change and no time is sent
+func applyFirmware(param *Cctv, oldData *Cctv) error {
+	if param.FirmwareUpdatedAt != nil && param.FirmwareUpdatedAt.After(time.Now()) {
+		return errors.New("Firmware updated at cannot be in the future")
+	}
+	if param.FirmwareVersion == nil {
+		return nil
+	}
+
+	v := strings.TrimSpace(*param.FirmwareVersion)
+	param.FirmwareVersion = &v
+	if err := valildator.Var(v, "max=50"); err != nil {
+		return errors.New("Firmware version is too long")
+	}
+	changed := oldData == nil || oldData.FirmwareVersion == nil || *oldData.FirmwareVersion != v
+	if v != "" && changed && param.FirmwareUpdatedAt == nil {
+		now := time.Now()
+		param.FirmwareUpdatedAt = &now
+	}
+	return nil
+}
+
+// Heartbeat record the device is alive and the firmware it reports, status is not changed
+func (uc *UsecaseHandler) Heartbeat(id string, param *Heartbeat) error {
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+
+	var data Cctv
+	err := Collection().FindOne(uc.Ctx, bson.M{"cctv_id": id},
+		options.FindOne().SetProjection(bson.M{"firmware_version": 1, "firmware_updated_at": 1}),
+	).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return errors.New("Data " + ModuleName + " with id " + id + " is not found")
+		}
+		return err
+	}
+
+	now := time.Now()
+	param.CctvID = id
+	param.LastHeartbeatAt = now
+	param.FirmwareUpdatedAt = data.FirmwareUpdatedAt
+	set := bson.M{"last_heartbeat_at": now}
+
+	if param.FirmwareVersion != nil {
+		v := strings.TrimSpace(*param.FirmwareVersion)
+		param.FirmwareVersion = &v
+		if v != "" && (data.FirmwareVersion == nil || *data.FirmwareVersion != v) {
+			set["firmware_version"] = v
+			set["firmware_updated_at"] = now
+			param.FirmwareUpdatedAt = &now
+		}
+	}
+	if param.FirmwareVersion == nil || *param.FirmwareVersion == "" {
+		param.FirmwareVersion = data.FirmwareVersion
+	}
+
+	_, err = Collection().UpdateOne(uc.Ctx, bson.M{"cctv_id": id}, bson.M{"$set": set})
+	return err
+}
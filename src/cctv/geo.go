@@ -0,0 +1,172 @@
+package cctv
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// mean earth radius in meters, used to convert radius to radians
+const earthRadius = 6371008.8
+
+// default radius for near query, in meters
+const defaultNearRadius = 1000.0
+
+// query params reserved for geo filter
+var GeoQueryParams = map[string]bool{
+	"near":    true,
+	"radius":  true,
+	"bbox":    true,
+	"polygon": true,
+}
+
+// GeoJSON point, coordinates is [longitude, latitude]
+type GeoPoint struct {
+	Type        string    `json:"type"                bson:"type"`
+	Coordinates []float64 `json:"coordinates"         bson:"coordinates"`
+}
+
+func (p *GeoPoint) Validate() error {
+	if p.Type == "" {
+		p.Type = "Point"
+	}
+	if p.Type != "Point" {
+		return errors.New("Coordinates type must be Point")
+	}
+	if len(p.Coordinates) != 2 {
+		return errors.New("Coordinates must be [longitude, latitude]")
+	}
+	return validLngLat(p.Coordinates[0], p.Coordinates[1])
+}
+
+type GeoFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   GeoPoint               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []GeoFeature `json:"features"`
+}
+
+// ParseGeoQuery build geo conditions from query param
+// near=lng,lat&radius=meters, bbox=minLng,minLat,maxLng,maxLat, polygon=lng,lat;lng,lat;...
+func ParseGeoQuery(query url.Values) ([]bson.M, error) {
+	conds := []bson.M{}
+
+	if v := query.Get("near"); v != "" {
+		point, err := parseFloats(v, 2, "near")
+		if err != nil {
+			return nil, err
+		}
+		if err := validLngLat(point[0], point[1]); err != nil {
+			return nil, err
+		}
+
+		radius := defaultNearRadius
+		if r := query.Get("radius"); r != "" {
+			radius, err = strconv.ParseFloat(r, 64)
+			if err != nil || math.IsNaN(radius) || math.IsInf(radius, 0) || radius <= 0 {
+				return nil, errors.New("Invalid radius, must be a positive number in meters")
+			}
+		}
+
+		conds = append(conds, bson.M{"coordinates": bson.M{"$geoWithin": bson.M{
+			"$centerSphere": bson.A{bson.A{point[0], point[1]}, radius / earthRadius},
+		}}})
+	}
+
+	if v := query.Get("bbox"); v != "" {
+		box, err := parseFloats(v, 4, "bbox")
+		if err != nil {
+			return nil, err
+		}
+		if err := validLngLat(box[0], box[1]); err != nil {
+			return nil, err
+		}
+		if err := validLngLat(box[2], box[3]); err != nil {
+			return nil, err
+		}
+		if box[0] >= box[2] || box[1] >= box[3] {
+			return nil, errors.New("Invalid bbox, must be minLng,minLat,maxLng,maxLat")
+		}
+
+		ring := bson.A{
+			bson.A{box[0], box[1]},
+			bson.A{box[2], box[1]},
+			bson.A{box[2], box[3]},
+			bson.A{box[0], box[3]},
+			bson.A{box[0], box[1]},
+		}
+		conds = append(conds, geoWithinPolygon(ring))
+	}
+
+	if v := query.Get("polygon"); v != "" {
+		ring := bson.A{}
+		for _, p := range strings.Split(v, ";") {
+			point, err := parseFloats(p, 2, "polygon")
+			if err != nil {
+				return nil, err
+			}
+			if err := validLngLat(point[0], point[1]); err != nil {
+				return nil, err
+			}
+			ring = append(ring, bson.A{point[0], point[1]})
+		}
+		if len(ring) < 3 {
+			return nil, errors.New("Invalid polygon, need at least 3 points")
+		}
+
+		// close the ring if needed
+		first, last := ring[0].(bson.A), ring[len(ring)-1].(bson.A)
+		if first[0] != last[0] || first[1] != last[1] {
+			ring = append(ring, first)
+		}
+		conds = append(conds, geoWithinPolygon(ring))
+	}
+
+	return conds, nil
+}
+
+func geoWithinPolygon(ring bson.A) bson.M {
+	return bson.M{"coordinates": bson.M{"$geoWithin": bson.M{
+		"$geometry": bson.M{
+			"type":        "Polygon",
+			"coordinates": bson.A{ring},
+		},
+	}}}
+}
+
+func parseFloats(v string, n int, name string) ([]float64, error) {
+	parts := strings.Split(v, ",")
+	if len(parts) != n {
+		return nil, errors.New("Invalid " + name + " value: " + v)
+	}
+
+	res := make([]float64, 0, n)
+	for _, p := range parts {
+		// NaN and Inf parse fine but are not a coordinate
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, errors.New("Invalid " + name + " value: " + v)
+		}
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+func validLngLat(lng, lat float64) error {
+	// NaN is not out of any range
+	if math.IsNaN(lng) || lng < -180 || lng > 180 {
+		return errors.New("Longitude must be between -180 and 180")
+	}
+	if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return errors.New("Latitude must be between -90 and 90")
+	}
+	return nil
+}
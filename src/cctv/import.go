@@ -0,0 +1,435 @@
+package cctv
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// max data rows of one import file
+const maxImportRows = 5000
+
+// upsert key of import
+const (
+	UpsertByIP         = "ip"
+	UpsertByExternalID = "external_id"
+)
+
+// param of bulk import, Rows[0] is the header
+type ImportParam struct {
+	Rows      [][]string
+	Mapping   map[string]string // column header -> field, empty to use the header as field
+	DryRun    bool
+	UpsertBy  string // "", ip or external_id
+	ContactID string // used for row without contact_id
+}
+
+type ImportResult struct {
+	DryRun  bool        `json:"dry_run"`
+	Total   int         `json:"total"`
+	Valid   int         `json:"valid"`
+	Invalid int         `json:"invalid"`
+	Created int         `json:"created"`
+	Updated int         `json:"updated"`
+	Rows    []ImportRow `json:"rows"`
+}
+
+type ImportRow struct {
+	Row    int      `json:"row"`    // row number in the file, header is row 1
+	Action string   `json:"action"` // create or update
+	CctvID string   `json:"cctv_id,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// importRecord one parsed row
+type importRecord struct {
+	data      Cctv
+	latitude  *float64
+	longitude *float64
+}
+
+// column setter by field name
+var importFields = map[string]func(r *importRecord, v string) error{
+	"external_id":      func(r *importRecord, v string) error { r.data.ExternalID = &v; return nil },
+	"contact_id":       func(r *importRecord, v string) error { r.data.ContactID = v; return nil },
+	"name":             func(r *importRecord, v string) error { r.data.Name = v; return nil },
+	"location":         func(r *importRecord, v string) error { r.data.Location = &v; return nil },
+	"site_id":          func(r *importRecord, v string) error { r.data.SiteID = &v; return nil },
+	"zone_id":          func(r *importRecord, v string) error { r.data.ZoneID = &v; return nil },
+	"ip_address":       func(r *importRecord, v string) error { r.data.IPAddress = &v; return nil },
+	"port":             func(r *importRecord, v string) error { return parseImportInt(&r.data.Port, "port", v) },
+	"mac_address":      func(r *importRecord, v string) error { r.data.MACAddress = &v; return nil },
+	"vlan":             func(r *importRecord, v string) error { return parseImportInt(&r.data.VLAN, "vlan", v) },
+	"recorder_id":      func(r *importRecord, v string) error { r.data.RecorderID = &v; return nil },
+	"channel":          func(r *importRecord, v string) error { return parseImportInt(&r.data.Channel, "channel", v) },
+	"brand":            func(r *importRecord, v string) error { r.data.Brand = &v; return nil },
+	"model":            func(r *importRecord, v string) error { r.data.Model = &v; return nil },
+	"firmware_version": func(r *importRecord, v string) error { r.data.FirmwareVersion = &v; return nil },
+	"firmware_updated_at": func(r *importRecord, v string) error {
+		return parseImportTime(&r.data.FirmwareUpdatedAt, "firmware_updated_at", v)
+	},
+	"purchase_date": func(r *importRecord, v string) error {
+		return parseImportDate(&r.data.PurchaseDate, "purchase_date", v)
+	},
+	"installer": func(r *importRecord, v string) error { r.data.Installer = &v; return nil },
+	"warranty_expiry": func(r *importRecord, v string) error {
+		return parseImportDate(&r.data.WarrantyExpiry, "warranty_expiry", v)
+	},
+	"replacement_date": func(r *importRecord, v string) error {
+		return parseImportDate(&r.data.ReplacementDate, "replacement_date", v)
+	},
+	"status":       func(r *importRecord, v string) error { r.data.Status = strings.ToLower(v); return nil },
+	"latitude":     func(r *importRecord, v string) error { return parseImportFloat(&r.latitude, "latitude", v) },
+	"longitude":    func(r *importRecord, v string) error { return parseImportFloat(&r.longitude, "longitude", v) },
+	"rtsp_url":     func(r *importRecord, v string) error { r.credentials().RTSPURL = &v; return nil },
+	"http_url":     func(r *importRecord, v string) error { r.credentials().HTTPURL = &v; return nil },
+	"snapshot_url": func(r *importRecord, v string) error { r.credentials().SnapshotURL = &v; return nil },
+	"username":     func(r *importRecord, v string) error { r.credentials().Username = &v; return nil },
+	"password":     func(r *importRecord, v string) error { r.credentials().Password = &v; return nil },
+}
+
+func (r *importRecord) credentials() *Credentials {
+	if r.data.Credentials == nil {
+		r.data.Credentials = &Credentials{}
+	}
+	return r.data.Credentials
+}
+
+// Import validate every row with the same rules as Create and UpdateByID,
+// on dry run nothing is written, otherwise valid rows are saved and invalid rows skipped
+func (uc *UsecaseHandler) Import(param *ImportParam) (*ImportResult, error) {
+	if len(param.Rows) < 2 {
+		return nil, errors.New("Import file has no data row")
+	}
+	if len(param.Rows)-1 > maxImportRows {
+		return nil, errors.New("Import file has more than " + strconv.Itoa(maxImportRows) + " rows")
+	}
+	if param.UpsertBy != "" && param.UpsertBy != UpsertByIP && param.UpsertBy != UpsertByExternalID {
+		return nil, errors.New("Upsert by must be ip or external_id")
+	}
+
+	columns, err := importColumns(param.Rows[0], param.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	res := ImportResult{
+		DryRun: param.DryRun,
+		Rows:   []ImportRow{},
+	}
+
+	// key already used by previous rows of the file
+	seenAddress := map[string]int{}
+	seenExternalID := map[string]int{}
+
+	for i, values := range param.Rows[1:] {
+		rowNumber := i + 2
+		if isEmptyRow(values) {
+			continue
+		}
+		res.Total++
+
+		row := ImportRow{Row: rowNumber, Action: "create"}
+		rec, errs := parseImportRow(values, columns)
+		if rec.data.ContactID == "" {
+			rec.data.ContactID = param.ContactID
+		}
+
+		if len(errs) == 0 && rec.data.Credentials != nil {
+			if err := valildator.Struct(rec.data.Credentials); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+
+		var existing *Cctv
+		if len(errs) == 0 {
+			existing, err = uc.findImportMatch(&rec.data, param.UpsertBy)
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+
+		if len(errs) == 0 {
+			if existing != nil {
+				row.Action = "update"
+				row.CctvID = existing.CctvID
+				err = uc.prepareImportUpdate(&rec.data, existing)
+			} else {
+				if rec.data.Status == "" {
+					rec.data.Status = StatusPendingInstall
+				}
+				err = uc.validateCreate(&rec.data)
+			}
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+
+		// duplicate inside the file is not seen by the database check on dry run
+		if len(errs) == 0 {
+			if key := addressKey(&rec.data); key != "" {
+				if prev, ok := seenAddress[key]; ok {
+					errs = append(errs, "Duplicate Ip Address, port and channel with row "+strconv.Itoa(prev))
+				} else {
+					seenAddress[key] = rowNumber
+				}
+			}
+			if rec.data.ExternalID != nil && *rec.data.ExternalID != "" {
+				key := rec.data.ContactID + "|" + *rec.data.ExternalID
+				if prev, ok := seenExternalID[key]; ok {
+					errs = append(errs, "Duplicate external id with row "+strconv.Itoa(prev))
+				} else {
+					seenExternalID[key] = rowNumber
+				}
+			}
+		}
+
+		if len(errs) == 0 && !param.DryRun {
+			if existing != nil {
+				err = uc.UpdateByID(existing.CctvID, &rec.data)
+			} else {
+				err = uc.Create(&rec.data)
+				row.CctvID = rec.data.CctvID
+			}
+			if err != nil {
+				errs = append(errs, err.Error())
+			} else if existing != nil {
+				res.Updated++
+			} else {
+				res.Created++
+			}
+		}
+
+		if len(errs) > 0 {
+			row.Errors = errs
+			res.Invalid++
+		} else {
+			res.Valid++
+		}
+		res.Rows = append(res.Rows, row)
+	}
+
+	return &res, nil
+}
+
+// importColumns map every column index to a field, unmapped column is ignored
+func importColumns(header []string, mapping map[string]string) (map[int]string, error) {
+	for _, field := range mapping {
+		if _, ok := importFields[field]; !ok {
+			return nil, errors.New("Unknown import field " + field)
+		}
+	}
+
+	columns := map[int]string{}
+	used := map[string]string{}
+	for i, h := range header {
+		h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+		field := ""
+		if len(mapping) > 0 {
+			field = mapping[h]
+		} else {
+			field = strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(h))
+		}
+		if _, ok := importFields[field]; !ok {
+			continue
+		}
+		if prev, ok := used[field]; ok {
+			return nil, errors.New("Columns " + prev + " and " + h + " are mapped to the same field " + field)
+		}
+		used[field] = h
+		columns[i] = field
+	}
+
+	if _, ok := used["name"]; !ok {
+		return nil, errors.New("Import file must have a name column")
+	}
+	return columns, nil
+}
+
+func parseImportRow(values []string, columns map[int]string) (*importRecord, []string) {
+	rec := &importRecord{}
+	errs := []string{}
+	for i, v := range values {
+		field, ok := columns[i]
+		v = strings.TrimSpace(v)
+		if !ok || v == "" {
+			continue
+		}
+		if err := importFields[field](rec, v); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	switch {
+	case rec.latitude != nil && rec.longitude != nil:
+		rec.data.Coordinates = &GeoPoint{Type: "Point", Coordinates: []float64{*rec.longitude, *rec.latitude}}
+	case rec.latitude != nil || rec.longitude != nil:
+		errs = append(errs, "Latitude and longitude must be set together")
+	}
+	return rec, errs
+}
+
+// findImportMatch find the cctv to update by the upsert key
+func (uc *UsecaseHandler) findImportMatch(param *Cctv, upsertBy string) (*Cctv, error) {
+	filter := bson.M{}
+	switch upsertBy {
+	case UpsertByIP:
+		if param.IPAddress == nil {
+			return nil, nil
+		}
+		// stored ip address is canonical
+		ip := *param.IPAddress
+		if n, err := utils.NormalizeIP(ip); err == nil {
+			ip = n
+		}
+		filter["ip_address"] = ip
+		if param.Port != nil {
+			filter["port"] = *param.Port
+		}
+		if param.Channel != nil {
+			filter["channel"] = *param.Channel
+		}
+	case UpsertByExternalID:
+		if param.ExternalID == nil {
+			return nil, nil
+		}
+		if param.ContactID == "" {
+			return nil, errors.New("Contact id is required to upsert by external id")
+		}
+		filter["contact_id"] = param.ContactID
+		filter["external_id"] = *param.ExternalID
+	default:
+		return nil, nil
+	}
+
+	cur, err := Collection().Find(uc.Ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var datas []Cctv
+	if err := cur.All(uc.Ctx, &datas); err != nil {
+		return nil, err
+	}
+
+	switch len(datas) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &datas[0], nil
+	default:
+		return nil, errors.New("More than one " + ModuleName + " match the " + upsertBy + ", add port and channel column")
+	}
+}
+
+// prepareImportUpdate keep the stored value of column not in the file, then validate
+func (uc *UsecaseHandler) prepareImportUpdate(param *Cctv, existing *Cctv) error {
+	if param.ContactID == "" {
+		param.ContactID = existing.ContactID
+	}
+	if param.Status == "" {
+		param.Status = existing.Status
+	}
+	if param.SiteID == nil {
+		param.SiteID = existing.SiteID
+	}
+	if param.ZoneID == nil {
+		param.ZoneID = existing.ZoneID
+	}
+	if param.RecorderID == nil {
+		param.RecorderID = existing.RecorderID
+	}
+	if param.Channel == nil {
+		param.Channel = existing.Channel
+	}
+	if param.IPAddress == nil {
+		param.IPAddress = existing.IPAddress
+	}
+	if param.Port == nil {
+		param.Port = existing.Port
+	}
+	if param.Name == "" {
+		param.Name = existing.Name
+	}
+	param.CctvID = existing.CctvID
+
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+	return uc.validateUpdate(param, existing)
+}
+
+func addressKey(param *Cctv) string {
+	if param.IPAddress == nil || *param.IPAddress == "" {
+		return ""
+	}
+	key := *param.IPAddress + "|"
+	if param.Port != nil {
+		key += strconv.Itoa(*param.Port)
+	}
+	key += "|"
+	if param.Channel != nil {
+		key += strconv.Itoa(*param.Channel)
+	}
+	return key
+}
+
+func isEmptyRow(values []string) bool {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func parseImportInt(dst **int, field, v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return errors.New("Invalid " + field + " " + v)
+	}
+	*dst = &n
+	return nil
+}
+
+func parseImportFloat(dst **float64, field, v string) error {
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return errors.New("Invalid " + field + " " + v)
+	}
+	*dst = &n
+	return nil
+}
+
+// parseImportTime accept RFC3339, a date in server timezone or a spreadsheet date number
+func parseImportTime(dst **time.Time, field, v string) error {
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		t, err = time.ParseInLocation("2006-01-02", v, time.Local)
+	}
+	if err != nil {
+		if serial, ok := utils.ParseXLSXDate(v, time.Local); ok {
+			t, err = serial, nil
+		}
+	}
+	if err != nil {
+		return errors.New("Invalid " + field + " " + v + ", must be RFC3339 time or YYYY-MM-DD")
+	}
+	*dst = &t
+	return nil
+}
+
+// parseImportDate accept YYYY-MM-DD or RFC3339, stored as YYYY-MM-DD
+func parseImportDate(dst **string, field, v string) error {
+	var t *time.Time
+	if err := parseImportTime(&t, field, v); err != nil {
+		return errors.New("Invalid " + field + " " + v + ", must be YYYY-MM-DD")
+	}
+	d := t.Format("2006-01-02")
+	*dst = &d
+	return nil
+}
@@ -0,0 +1,43 @@
+package cctv
+
+import (
+	"errors"
+	"strings"
+)
+
+// validateLifecycle check the dates are YYYY-MM-DD, and warranty expiry and replacement date are not before the purchase date.
+// On update the stored dates are used for the one not sent. Dates compare as text
+func validateLifecycle(param *Cctv, oldData *Cctv) error {
+	if param.Installer != nil {
+		v := strings.TrimSpace(*param.Installer)
+		param.Installer = &v
+		if err := valildator.Var(v, "max=100"); err != nil {
+			return errors.New("Installer is too long")
+		}
+	}
+	for name, v := range map[string]*string{
+		"Purchase date":    param.PurchaseDate,
+		"Warranty expiry":  param.WarrantyExpiry,
+		"Replacement date": param.ReplacementDate,
+	} {
+		if v != nil && *v != "" {
+			if err := valildator.Var(*v, "datetime=2006-01-02"); err != nil {
+				return errors.New(name + " must be a date, YYYY-MM-DD")
+			}
+		}
+	}
+
+	purchase := pick(param.PurchaseDate, oldData, func(v *Cctv) *string { return v.PurchaseDate })
+	if purchase == nil || *purchase == "" {
+		return nil
+	}
+	for name, v := range map[string]*string{
+		"Warranty expiry":  pick(param.WarrantyExpiry, oldData, func(v *Cctv) *string { return v.WarrantyExpiry }),
+		"Replacement date": pick(param.ReplacementDate, oldData, func(v *Cctv) *string { return v.ReplacementDate }),
+	} {
+		if v != nil && *v != "" && *v < *purchase {
+			return errors.New(name + " cannot be before the purchase date")
+		}
+	}
+	return nil
+}
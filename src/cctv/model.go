@@ -1,41 +1,120 @@
 package cctv
 
 import (
+	"context"
 	"time"
 
 	"github.com/maulanar/gin-kecilin/database"
 	"github.com/maulanar/gin-kecilin/src/contact"
+	"github.com/maulanar/gin-kecilin/utils"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Cctv struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty"`
-	CctvID    string             `json:"cctv_id"             bson:"cctv_id,omitempty"`
-	ContactID string             `json:"contact_id"          validate:"required" bson:"contact_id,omitempty"`
-	Name      string             `json:"name"                validate:"required" bson:"name,omitempty"`
-	Location  *string            `json:"location"            bson:"location,omitempty"`
-	IPAddress *string            `json:"ip_address"          bson:"ip_address,omitempty"`
-	Brand     *string            `json:"brand"               bson:"brand,omitempty"`
-	Model     *string            `json:"model"               bson:"model,omitempty"`
-	Status    string             `json:"status"              validate:"required,oneof=online offline maintenance" bson:"status,omitempty"`
-	CreatedAt time.Time          `json:"created_at"          bson:"created_at,omitempty"`
-	UpdatedAt time.Time          `json:"updated_at"          bson:"updated_at,omitempty"`
-
-	Contact *contact.Contact `json:"contact"`
+	ID                primitive.ObjectID    `bson:"_id,omitempty"`
+	CctvID            string                `json:"cctv_id"               bson:"cctv_id,omitempty"`
+	ExternalID        *string               `json:"external_id"           bson:"external_id,omitempty"` // id in customer own system
+	ContactID         string                `json:"contact_id"            validate:"required" bson:"contact_id,omitempty"`
+	Name              string                `json:"name"                  validate:"required" bson:"name,omitempty"`
+	Location          *string               `json:"location"              bson:"location,omitempty"`
+	Coordinates       *GeoPoint             `json:"coordinates,omitempty" bson:"coordinates,omitempty"`
+	SiteID            *string               `json:"site_id"               bson:"site_id,omitempty"`
+	ZoneID            *string               `json:"zone_id"               bson:"zone_id,omitempty"`
+	IPAddress         *string               `json:"ip_address"            bson:"ip_address,omitempty"`
+	Port              *int                  `json:"port"                  validate:"omitempty,min=1,max=65535" bson:"port,omitempty"`
+	MACAddress        *string               `json:"mac_address"           bson:"mac_address,omitempty"` // e.g. aa:bb:cc:dd:ee:ff
+	VLAN              *int                  `json:"vlan"                  validate:"omitempty,min=1,max=4094" bson:"vlan,omitempty"`
+	RecorderID        *string               `json:"recorder_id"           bson:"recorder_id,omitempty"`
+	Channel           *int                  `json:"channel"               validate:"omitempty,min=1" bson:"channel,omitempty"`
+	Brand             *string               `json:"brand"                 bson:"brand,omitempty"`
+	Model             *string               `json:"model"                 bson:"model,omitempty"`
+	BrandID           *string               `json:"brand_id"              bson:"brand_id,omitempty"` // catalog brand, brand is its name
+	ModelID           *string               `json:"model_id"              bson:"model_id,omitempty"` // catalog model, model is its name
+	FirmwareVersion   *string               `json:"firmware_version"      validate:"omitempty,max=50" bson:"firmware_version,omitempty"`
+	FirmwareUpdatedAt *time.Time            `json:"firmware_updated_at"   bson:"firmware_updated_at,omitempty"`
+	LastHeartbeatAt   *time.Time            `json:"last_heartbeat_at"     bson:"last_heartbeat_at,omitempty"` // last heartbeat from the device
+	PurchaseDate      *string               `json:"purchase_date"         validate:"omitempty,datetime=2006-01-02" bson:"purchase_date,omitempty"`
+	Installer         *string               `json:"installer"             validate:"omitempty,max=100" bson:"installer,omitempty"` // company or person installing the camera
+	WarrantyExpiry    *string               `json:"warranty_expiry"       validate:"omitempty,datetime=2006-01-02" bson:"warranty_expiry,omitempty"`
+	ReplacementDate   *string               `json:"replacement_date"      validate:"omitempty,datetime=2006-01-02" bson:"replacement_date,omitempty"` // planned replacement
+	Status            string                `json:"status"                validate:"required,oneof=pending_install online offline maintenance decommissioned" bson:"status,omitempty"`
+	Contacts          []contact.CctvContact `json:"contacts"              bson:"contacts,omitempty"` // owner, technical & emergency contact
+	Tags              []string              `json:"tags,omitempty"        bson:"tags,omitempty"`
+	CreatedAt         time.Time             `json:"created_at"            bson:"created_at,omitempty"`
+	UpdatedAt         time.Time             `json:"updated_at"            bson:"updated_at,omitempty"`
+
+	// ip address as fixed length hex, used for cidr query
+	IPKey *string `json:"-" bson:"ip_key,omitempty"`
+
+	// warranty expiry the contacts were reminded of, a new expiry is reminded again
+	WarrantyRemindedFor *string `json:"-" bson:"warranty_reminded_for,omitempty"`
+
+	// plain credentials only accepted as input, stored encrypted and never returned
+	Credentials          *Credentials          `json:"credentials,omitempty" bson:"-"`
+	EncryptedCredentials *utils.EncryptedValue `json:"-"                     bson:"credentials,omitempty"`
+	HasCredentials       bool                  `json:"has_credentials"       bson:"-"`
+
+	// value of admin defined custom fields by key
+	CustomFields map[string]interface{} `json:"custom_fields,omitempty" bson:"custom_fields,omitempty"`
+
+	Contact        *contact.Contact                 `json:"contact"` // owner
+	ContactsByRole map[string][]contact.RoleContact `json:"contacts_by_role" bson:"-"`
+}
+
+// stream endpoints & device login
+type Credentials struct {
+	RTSPURL     *string `json:"rtsp_url"            validate:"omitempty,url" bson:"rtsp_url,omitempty"`
+	HTTPURL     *string `json:"http_url"            validate:"omitempty,url" bson:"http_url,omitempty"`
+	SnapshotURL *string `json:"snapshot_url"        validate:"omitempty,url" bson:"snapshot_url,omitempty"`
+	Username    *string `json:"username"            bson:"username,omitempty"`
+	Password    *string `json:"password"            bson:"password,omitempty"`
+}
+
+func (v *Credentials) IsEmpty() bool {
+	return v.RTSPURL == nil && v.HTTPURL == nil && v.SnapshotURL == nil && v.Username == nil && v.Password == nil
 }
 
 // whitelist field can be sorted
 var AllowedSortFields = map[string]bool{
-	"cctv_id":    true,
-	"contact_id": true,
-	"ip_address": true,
-	"name":       true,
-	"created_at": true,
-	"updated_at": true,
+	"cctv_id":             true,
+	"contact_id":          true,
+	"site_id":             true,
+	"zone_id":             true,
+	"ip_address":          true,
+	"mac_address":         true,
+	"vlan":                true,
+	"recorder_id":         true,
+	"firmware_version":    true,
+	"firmware_updated_at": true,
+	"last_heartbeat_at":   true,
+	"purchase_date":       true,
+	"warranty_expiry":     true,
+	"replacement_date":    true,
+	"name":                true,
+	"status":              true,
+	"created_at":          true,
+	"updated_at":          true,
 }
 
 func Collection() *mongo.Collection {
 	return database.OpenCollection("cctvs")
 }
+
+func EnsureIndexes(ctx context.Context) error {
+	_, err := Collection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "coordinates", Value: "2dsphere"}}},
+		{Keys: bson.D{{Key: "site_id", Value: 1}, {Key: "zone_id", Value: 1}}},
+		{Keys: bson.D{{Key: "ip_address", Value: 1}, {Key: "port", Value: 1}, {Key: "channel", Value: 1}}},
+		{Keys: bson.D{{Key: "recorder_id", Value: 1}, {Key: "channel", Value: 1}}},
+		{Keys: bson.D{{Key: "ip_key", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "mac_address", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "external_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "contacts.contact_id", Value: 1}, {Key: "contacts.role", Value: 1}}},
+		{Keys: bson.D{{Key: "warranty_expiry", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	return err
+}
@@ -0,0 +1,98 @@
+package cctv
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// applyNetwork store canonical ip & mac address, so one address has one spelling and cidr query can use the ip key
+func applyNetwork(param *Cctv) error {
+	if param.IPAddress != nil && *param.IPAddress != "" {
+		ip, err := utils.NormalizeIP(*param.IPAddress)
+		if err != nil {
+			return err
+		}
+		key, _ := utils.IPKey(ip)
+		param.IPAddress = &ip
+		param.IPKey = &key
+	}
+	if param.MACAddress != nil && *param.MACAddress != "" {
+		mac, err := utils.NormalizeMAC(*param.MACAddress)
+		if err != nil {
+			return err
+		}
+		param.MACAddress = &mac
+	}
+	if param.VLAN != nil {
+		if err := valildator.Var(*param.VLAN, "min=1,max=4094"); err != nil {
+			return errors.New("Vlan must be between 1 and 4094")
+		}
+	}
+	return nil
+}
+
+// NetFilters rewrite network filters of query param: `ip` is short for `ip_address`,
+// ip & mac address are compared in canonical form, and `ip_address[$cidr]=10.0.0.0/24` become ip key range conditions.
+// Several cidr match any of them
+func NetFilters(filters map[string][]string) ([]bson.M, error) {
+	conds := []bson.M{}
+	for key, values := range filters {
+		field, op, _ := strings.Cut(key, "[")
+		if field != "ip" && field != "ip_address" && field != "mac_address" {
+			continue
+		}
+		delete(filters, key)
+
+		if op == "$cidr]" {
+			if field == "mac_address" {
+				return nil, errors.New("Cidr filter is only for ip address")
+			}
+			or := bson.A{}
+			for _, v := range values {
+				for _, cidr := range strings.Split(v, ",") {
+					prefix, err := utils.ParseCIDR(cidr)
+					if err != nil {
+						return nil, err
+					}
+					first, last := utils.CIDRKeyRange(prefix)
+					or = append(or, bson.M{"ip_key": bson.M{"$gte": first, "$lte": last}})
+				}
+			}
+			if len(or) == 1 {
+				conds = append(conds, or[0].(bson.M))
+			} else if len(or) > 1 {
+				conds = append(conds, bson.M{"$or": or})
+			}
+			continue
+		}
+
+		newValues := make([]string, 0, len(values))
+		for _, v := range values {
+			if op != "$like]" {
+				// unknown spelling is kept, so it match nothing instead of everything
+				if field == "mac_address" {
+					if n, err := utils.NormalizeMAC(v); err == nil {
+						v = n
+					}
+				} else if n, err := utils.NormalizeIP(v); err == nil {
+					v = n
+				}
+			}
+			newValues = append(newValues, v)
+		}
+
+		newKey := field
+		if field == "ip" {
+			newKey = "ip_address"
+		}
+		if op != "" {
+			newKey += "[" + op
+		}
+		filters[newKey] = newValues
+	}
+	return conds, nil
+}
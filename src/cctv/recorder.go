@@ -0,0 +1,109 @@
+package cctv
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/maulanar/gin-kecilin/src/statushistory"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// field keeping the status of a channel before the recorder cascade moved it,
+// only channels having it are restored when the recorder is back online
+const recorderStatusField = "recorder_status_from"
+
+// CascadeRecorderStatus move the channels of a recorder along with its status through ChangeStatus,
+// online channels follow an offline or maintenance recorder and are restored when it is back online,
+// channels which are offline, in maintenance or inactive for their own reason are left as is
+func CascadeRecorderStatus(ctx context.Context, recorderID, from, to string) error {
+	uc := UsecaseHandler{Ctx: ctx}
+
+	// channels already moved by the cascade follow the recorder, or go back when it is online
+	cascaded, err := uc.recorderChannels(bson.M{"recorder_id": recorderID, recorderStatusField: bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+	for _, v := range cascaded {
+		status := to
+		if to == StatusOnline {
+			status = v.Previous
+		}
+		err := uc.cascadeChannel(v.CctvID, from, status)
+		if err == nil && to != StatusOnline {
+			continue
+		}
+		if err != nil {
+			log.Printf("Recorder %s, cctv %s: %v", recorderID, v.CctvID, err)
+		}
+		// restored, or its status is not the cascade one anymore
+		if err := uc.setRecorderStatus(v.CctvID, ""); err != nil {
+			return err
+		}
+	}
+	if to == StatusOnline {
+		return nil
+	}
+
+	channels, err := uc.recorderChannels(bson.M{
+		"recorder_id":       recorderID,
+		"status":            StatusOnline,
+		recorderStatusField: bson.M{"$exists": false},
+	})
+	if err != nil {
+		return err
+	}
+	for _, v := range channels {
+		if err := uc.cascadeChannel(v.CctvID, StatusOnline, to); err != nil {
+			log.Printf("Recorder %s, cctv %s: %v", recorderID, v.CctvID, err)
+			continue
+		}
+		if err := uc.setRecorderStatus(v.CctvID, StatusOnline); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type recorderChannel struct {
+	CctvID   string `bson:"cctv_id"`
+	Previous string `bson:"recorder_status_from"`
+}
+
+func (uc *UsecaseHandler) recorderChannels(filter bson.M) ([]recorderChannel, error) {
+	opts := options.Find().SetProjection(bson.M{"cctv_id": 1, recorderStatusField: 1})
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	res := []recorderChannel{}
+	if err := cur.All(uc.Ctx, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// cascadeChannel change the channel status when it is still from, a changed or removed channel is skipped
+func (uc *UsecaseHandler) cascadeChannel(cctvID, from, to string) error {
+	_, err := uc.ChangeStatus(cctvID, &StatusChange{
+		Status: to,
+		Source: statushistory.SourceRecorder,
+		From:   from,
+	})
+	if errors.Is(err, ErrStatusMismatch) || errors.Is(err, ErrNotFound) {
+		return errors.New("status is not " + from + " anymore, skipped")
+	}
+	return err
+}
+
+// setRecorderStatus keep the channel status before the cascade, empty previous remove it
+func (uc *UsecaseHandler) setRecorderStatus(cctvID, previous string) error {
+	update := bson.M{"$set": bson.M{recorderStatusField: previous}}
+	if previous == "" {
+		update = bson.M{"$unset": bson.M{recorderStatusField: ""}}
+	}
+	_, err := Collection().UpdateOne(uc.Ctx, bson.M{"cctv_id": cctvID}, update)
+	return err
+}
@@ -0,0 +1,84 @@
+package cctv
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	StatusPendingInstall = "pending_install"
+	StatusOnline         = "online"
+	StatusOffline        = "offline"
+	StatusMaintenance    = "maintenance"
+	StatusDecommissioned = "decommissioned"
+)
+
+// allowed status transition, from -> to -> reason required
+var statusTransitions = map[string]map[string]bool{
+	StatusPendingInstall: {
+		StatusOnline:         false,
+		StatusOffline:        false,
+		StatusMaintenance:    false,
+		StatusDecommissioned: true,
+	},
+	StatusOnline: {
+		StatusOffline:        false,
+		StatusMaintenance:    false,
+		StatusDecommissioned: true,
+	},
+	StatusOffline: {
+		StatusOnline:         false,
+		StatusMaintenance:    false,
+		StatusDecommissioned: true,
+	},
+	StatusMaintenance: {
+		StatusOnline:         false,
+		StatusOffline:        false,
+		StatusDecommissioned: true,
+	},
+	StatusDecommissioned: {
+		StatusPendingInstall: true,
+	},
+}
+
+// returned when the current status is not the expected From
+var ErrStatusMismatch = errors.New(ModuleName + " status has been changed")
+
+// wrapped by status change of a cctv which does not exist
+var ErrNotFound = errors.New("not found")
+
+// status which is not probed nor alerted
+var InactiveStatuses = []string{StatusPendingInstall, StatusDecommissioned}
+
+// param of status change
+type StatusChange struct {
+	Status string  `json:"status"              validate:"required"`
+	Reason *string `json:"reason"              bson:"reason,omitempty"`
+
+	// set by caller, not by request body
+	Source string `json:"-"`
+	By     string `json:"-"`
+	From   string `json:"-"` // change only when current status is From
+}
+
+// CheckTransition validate the move from a status to another
+func CheckTransition(from, to string, reason *string) error {
+	if _, ok := statusTransitions[to]; !ok {
+		return errors.New("Invalid status " + to)
+	}
+
+	next, ok := statusTransitions[from]
+	if !ok {
+		// legacy or unknown status can move anywhere
+		return nil
+	}
+
+	needReason, ok := next[to]
+	if !ok {
+		return errors.New("Status cannot change from " + from + " to " + to)
+	}
+	if needReason && (reason == nil || strings.TrimSpace(*reason) == "") {
+		return errors.New("Reason is required to change status from " + from + " to " + to)
+	}
+	return nil
+}
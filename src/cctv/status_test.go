@@ -0,0 +1,63 @@
+package cctv
+
+import "testing"
+
+func TestCheckTransition(t *testing.T) {
+	reason := "replaced by new camera"
+	blank := "  "
+
+	tests := []struct {
+		from, to string
+		reason   *string
+		wantErr  bool
+	}{
+		// pending install
+		{StatusPendingInstall, StatusOnline, nil, false},
+		{StatusPendingInstall, StatusOffline, nil, false},
+		{StatusPendingInstall, StatusMaintenance, nil, false},
+		{StatusPendingInstall, StatusDecommissioned, nil, true},
+		{StatusPendingInstall, StatusDecommissioned, &reason, false},
+
+		// online, offline & maintenance move freely among themselves
+		{StatusOnline, StatusOffline, nil, false},
+		{StatusOnline, StatusMaintenance, nil, false},
+		{StatusOffline, StatusOnline, nil, false},
+		{StatusOffline, StatusMaintenance, nil, false},
+		{StatusMaintenance, StatusOnline, nil, false},
+		{StatusMaintenance, StatusOffline, nil, false},
+
+		// back to pending install only from decommissioned
+		{StatusOnline, StatusPendingInstall, nil, true},
+		{StatusOffline, StatusPendingInstall, &reason, true},
+		{StatusMaintenance, StatusPendingInstall, nil, true},
+
+		// decommission need a reason
+		{StatusOnline, StatusDecommissioned, nil, true},
+		{StatusOnline, StatusDecommissioned, &blank, true},
+		{StatusOnline, StatusDecommissioned, &reason, false},
+		{StatusOffline, StatusDecommissioned, &reason, false},
+		{StatusMaintenance, StatusDecommissioned, &reason, false},
+
+		// decommissioned
+		{StatusDecommissioned, StatusPendingInstall, nil, true},
+		{StatusDecommissioned, StatusPendingInstall, &reason, false},
+		{StatusDecommissioned, StatusOnline, &reason, true},
+		{StatusDecommissioned, StatusOffline, nil, true},
+		{StatusDecommissioned, StatusMaintenance, nil, true},
+
+		// same status is not a transition
+		{StatusOnline, StatusOnline, nil, true},
+
+		// legacy status
+		{"active", StatusOnline, nil, false},
+		{"", StatusDecommissioned, nil, false},
+		{StatusOnline, "active", nil, true},
+		{"", "", nil, true},
+	}
+	for _, tt := range tests {
+		err := CheckTransition(tt.from, tt.to, tt.reason)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckTransition(%q, %q, %v) error = %v, wantErr %v", tt.from, tt.to, tt.reason != nil, err, tt.wantErr)
+		}
+	}
+}
@@ -2,11 +2,17 @@ package cctv
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
 	"time"
 
-	"github.com/maulanar/gin-kecilin/src/contact"
+	"github.com/maulanar/gin-kecilin/src/customfield"
+	"github.com/maulanar/gin-kecilin/src/recorder"
+	"github.com/maulanar/gin-kecilin/src/site"
+	"github.com/maulanar/gin-kecilin/src/statushistory"
+	"github.com/maulanar/gin-kecilin/src/stream"
 	"github.com/maulanar/gin-kecilin/utils"
 
 	"github.com/go-playground/validator/v10"
@@ -23,6 +29,9 @@ type UsecaseHandler struct {
 	Limit         int64
 	TotalData     int64
 	FilterAndSort utils.HelperUsecaseHandler
+	GeoFilter     []bson.M
+	NetFilter     []bson.M // cidr conditions, see NetFilters
+	Actor         string   // email of the user doing the change
 }
 
 var valildator = validator.New()
@@ -35,11 +44,13 @@ func (uc *UsecaseHandler) Get() ([]Cctv, error) {
 		uc.Limit = 10
 	}
 
-	filter := uc.FilterAndSort.SetFilter() // dynamic filter by query param
-	sort := uc.FilterAndSort.SetSort()     // dynamic sort by query param
-	skip := (uc.Page - 1) * uc.Limit       // offset
+	filter := uc.buildFilter()         // dynamic filter by query param
+	sort := uc.FilterAndSort.SetSort() // dynamic sort by query param
+	skip := (uc.Page - 1) * uc.Limit   // offset
 	opts := options.Find().
 		SetProjection(bson.M{ // block sensitive content
+			"credentials.wrapped_key": 0,
+			"credentials.ciphertext":  0,
 		}).
 		SetSort(sort).
 		SetSkip(skip).
@@ -67,45 +78,88 @@ func (uc *UsecaseHandler) Get() ([]Cctv, error) {
 		datas = []Cctv{}
 	}
 
-	contactUC := contact.UsecaseHandler{
-		Ctx: uc.Ctx,
+	if err := uc.attachContacts(datas); err != nil {
+		return nil, err
 	}
 	for k := range datas {
-		v := &datas[k]
-
-		contact, err := contactUC.GetByID(v.ContactID)
-		if err != nil {
-			return nil, err
-		}
-		v.Contact = contact
-		v.Contact.CCTVs = nil
+		datas[k].HasCredentials = datas[k].EncryptedCredentials != nil
 	}
 
 	uc.TotalData = total
 	return datas, nil
 }
 
-func (uc *UsecaseHandler) Create(param *Cctv) error {
-	// validate input
-	if err := valildator.Struct(param); err != nil {
-		return err
-	}
+// GetGeoJSON return filtered cctv which have coordinates as a GeoJSON FeatureCollection
+func (uc *UsecaseHandler) GetGeoJSON() (*GeoFeatureCollection, error) {
+	filter := uc.buildFilter()
+	filter["coordinates"] = bson.M{"$exists": true}
+	opts := options.Find().SetSort(uc.FilterAndSort.SetSort())
 
-	// validate ip_address is unique
-	count, err := Collection().CountDocuments(uc.Ctx, bson.M{"ip_address": param.IPAddress})
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if count > 0 {
-		return errors.New("Duplicate Ip Address")
+	defer cur.Close(uc.Ctx)
+
+	res := GeoFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: []GeoFeature{},
 	}
+	for cur.Next(uc.Ctx) {
+		var v Cctv
+		if err := cur.Decode(&v); err != nil {
+			return nil, err
+		}
+		if v.Coordinates == nil {
+			continue
+		}
 
-	// validate contact id is valid
-	contactUC := contact.UsecaseHandler{
-		Ctx: uc.Ctx,
+		res.Features = append(res.Features, GeoFeature{
+			Type:     "Feature",
+			Geometry: *v.Coordinates,
+			Properties: map[string]interface{}{
+				"cctv_id":    v.CctvID,
+				"contact_id": v.ContactID,
+				"name":       v.Name,
+				"location":   v.Location,
+				"ip_address": v.IPAddress,
+				"brand":      v.Brand,
+				"model":      v.Model,
+				"status":     v.Status,
+			},
+		})
 	}
-	_, err = contactUC.GetByID(param.ContactID)
-	if err != nil {
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// buildFilter combine dynamic filter with geo & network filter
+func (uc *UsecaseHandler) buildFilter() bson.M {
+	filter := uc.FilterAndSort.SetFilter()
+	contactRoleFilter(filter)
+	if len(uc.GeoFilter) > 0 || len(uc.NetFilter) > 0 {
+		and := bson.A{}
+		for _, cond := range uc.GeoFilter {
+			and = append(and, cond)
+		}
+		for _, cond := range uc.NetFilter {
+			and = append(and, cond)
+		}
+		filter["$and"] = and
+	}
+	return filter
+}
+
+func (uc *UsecaseHandler) Create(param *Cctv) error {
+	if err := uc.validateCreate(param); err != nil {
+		return err
+	}
+
+	// encrypt credentials
+	if err := encryptCredentials(param); err != nil {
 		return err
 	}
 
@@ -114,12 +168,13 @@ func (uc *UsecaseHandler) Create(param *Cctv) error {
 	param.CreatedAt = time.Now()
 	param.UpdatedAt = time.Now()
 
-	_, err = Collection().InsertOne(uc.Ctx, param)
+	_, err := Collection().InsertOne(uc.Ctx, param)
 	if err != nil {
 		return err
 	}
+	publish(stream.CctvCreated, param)
 
-	return nil
+	return statushistory.Record(uc.Ctx, param.CctvID, "", param.Status, nil, statushistory.SourceCreate, uc.Actor)
 }
 
 func (uc *UsecaseHandler) GetByID(id string) (*Cctv, error) {
@@ -133,14 +188,12 @@ func (uc *UsecaseHandler) GetByID(id string) (*Cctv, error) {
 	}
 
 	// get data contact
-	contactUC := contact.UsecaseHandler{
-		Ctx: uc.Ctx,
-	}
-	data.Contact, err = contactUC.GetByID(data.ContactID)
-	if err != nil {
+	datas := []Cctv{data}
+	if err := uc.attachContacts(datas); err != nil {
 		return nil, err
 	}
-	data.Contact.CCTVs = nil
+	data = datas[0]
+	data.HasCredentials = data.EncryptedCredentials != nil
 
 	return &data, nil
 }
@@ -156,40 +209,178 @@ func (uc *UsecaseHandler) UpdateByID(id string, param *Cctv) error {
 	param.CctvID = oldData.CctvID
 	param.UpdatedAt = time.Now()
 
-	// validate ip address is unique
-	if oldData.IPAddress != nil && *oldData.IPAddress != *param.IPAddress {
-		count, err := Collection().CountDocuments(uc.Ctx, bson.M{"ip_address": param.IPAddress})
-		if err != nil {
-			return err
-		}
+	if err := uc.validateUpdate(param, oldData); err != nil {
+		return err
+	}
 
-		if count > 0 {
-			return errors.New("IP Address already exists")
+	// encrypt credentials, empty credentials remove the stored one
+	update := bson.M{}
+	switch {
+	case param.Credentials == nil:
+		param.HasCredentials = oldData.HasCredentials
+	case param.Credentials.IsEmpty():
+		update["$unset"] = bson.M{"credentials": ""}
+		param.Credentials = nil
+	default:
+		if err := encryptCredentials(param); err != nil {
+			return err
 		}
 	}
 
-	// validate contact id is valid
-	contactUC := contact.UsecaseHandler{
-		Ctx: uc.Ctx,
-	}
-	_, err = contactUC.GetByID(param.ContactID)
-	if err != nil {
-		return err
+	customfield.UnsetEmpty(update, param.Tags, param.CustomFields)
+	unsetCatalog(update, param)
+	// status kept for the recorder cascade does not hold anymore
+	if (param.Status != "" && param.Status != oldData.Status) ||
+		(param.RecorderID != nil && (oldData.RecorderID == nil || *param.RecorderID != *oldData.RecorderID)) {
+		unset, _ := update["$unset"].(bson.M)
+		if unset == nil {
+			unset = bson.M{}
+		}
+		unset[recorderStatusField] = ""
+		update["$unset"] = unset
 	}
 
 	filter := bson.M{"cctv_id": id}
-	update := bson.M{"$set": param}
+	update["$set"] = param
 	_, err = Collection().UpdateOne(uc.Ctx, filter, update)
 	if err != nil {
 		return err
 	}
 
+	if param.SiteID == nil {
+		param.SiteID = oldData.SiteID
+	}
+	publish(stream.CctvUpdated, param)
+
+	if param.Status != "" && param.Status != oldData.Status {
+		publishStatus(param, oldData.Status, nil, statushistory.SourceUpdate)
+		return statushistory.Record(uc.Ctx, id, oldData.Status, param.Status, nil, statushistory.SourceUpdate, uc.Actor)
+	}
 	return nil
 }
 
+// ChangeStatus move cctv status following the allowed transition and record the history
+func (uc *UsecaseHandler) ChangeStatus(id string, param *StatusChange) (*Cctv, error) {
+	if err := valildator.Struct(param); err != nil {
+		return nil, err
+	}
+
+	var data Cctv
+	err := Collection().FindOne(uc.Ctx, bson.M{"cctv_id": id}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("Data %s with id %s is %w", ModuleName, id, ErrNotFound)
+		}
+		return nil, err
+	}
+
+	if param.From != "" && data.Status != param.From {
+		return nil, ErrStatusMismatch
+	}
+	if data.Status == param.Status {
+		return &data, nil
+	}
+	if err := CheckTransition(data.Status, param.Status, param.Reason); err != nil {
+		return nil, err
+	}
+
+	// only update when status not changed by other process meanwhile,
+	// a status not set by the recorder is not restored when the recorder is back online
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"status": param.Status, "updated_at": now}}
+	if param.Source != statushistory.SourceRecorder {
+		update["$unset"] = bson.M{recorderStatusField: ""}
+	}
+	res, err := Collection().UpdateOne(uc.Ctx, bson.M{"cctv_id": id, "status": data.Status}, update)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, ErrStatusMismatch
+	}
+
+	source := param.Source
+	if source == "" {
+		source = statushistory.SourceManual
+	}
+	if err := statushistory.Record(uc.Ctx, id, data.Status, param.Status, param.Reason, source, param.By); err != nil {
+		return nil, err
+	}
+
+	from := data.Status
+	data.Status = param.Status
+	data.UpdatedAt = now
+	data.EncryptedCredentials = nil
+	publishStatus(&data, from, param.Reason, source)
+
+	return &data, nil
+}
+
+// RevealCredentials decrypt stored credentials, caller must be authorized & audited
+func (uc *UsecaseHandler) RevealCredentials(id string) (*Credentials, error) {
+	data, err := uc.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if data.EncryptedCredentials == nil {
+		return nil, errors.New(ModuleName + " with id " + id + " has no credentials")
+	}
+
+	plain, err := utils.Decrypt(data.EncryptedCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	var res Credentials
+	if err := json.Unmarshal(plain, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RotateCredentialKeys rewrap credentials data key which not use the active master key
+func (uc *UsecaseHandler) RotateCredentialKeys() (int64, error) {
+	filter := bson.M{
+		"credentials":        bson.M{"$exists": true},
+		"credentials.key_id": bson.M{"$ne": utils.ActiveCredentialKeyID()},
+	}
+	cur, err := Collection().Find(uc.Ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var rotated int64
+	for cur.Next(uc.Ctx) {
+		var data Cctv
+		if err := cur.Decode(&data); err != nil {
+			return rotated, err
+		}
+
+		changed, err := utils.Rewrap(data.EncryptedCredentials)
+		if err != nil {
+			return rotated, errors.New("CCTV " + data.CctvID + ": " + err.Error())
+		}
+		if !changed {
+			continue
+		}
+
+		_, err = Collection().UpdateOne(uc.Ctx,
+			bson.M{"cctv_id": data.CctvID},
+			bson.M{"$set": bson.M{"credentials": data.EncryptedCredentials}},
+		)
+		if err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+
+	return rotated, cur.Err()
+}
+
 func (uc *UsecaseHandler) DeleteByID(id string) error {
 	// validate id exists
-	_, err := uc.GetByID(id)
+	data, err := uc.GetByID(id)
 	if err != nil {
 		return err
 	}
@@ -199,6 +390,338 @@ func (uc *UsecaseHandler) DeleteByID(id string) error {
 	if err != nil {
 		return err
 	}
+	data.EncryptedCredentials = nil
+	publish(stream.CctvDeleted, data)
+
+	return nil
+}
+
+// publish cctv change to the live stream
+func publish(msgType string, data *Cctv) {
+	msg := stream.Message{
+		Type:      msgType,
+		CctvID:    data.CctvID,
+		ContactID: data.ContactID,
+		Data:      data,
+	}
+	if data.SiteID != nil {
+		msg.SiteID = *data.SiteID
+	}
+	stream.Publish(msg)
+}
+
+func publishStatus(data *Cctv, from string, reason *string, source string) {
+	msg := stream.Message{
+		Type:      stream.CctvStatusChanged,
+		CctvID:    data.CctvID,
+		ContactID: data.ContactID,
+		Data: stream.StatusData{
+			CctvID: data.CctvID,
+			From:   from,
+			To:     data.Status,
+			Reason: reason,
+			Source: source,
+		},
+	}
+	if data.SiteID != nil {
+		msg.SiteID = *data.SiteID
+	}
+	stream.Publish(msg)
+}
+
+// validateCreate check new cctv against every rule, may fill ip address from the recorder
+func (uc *UsecaseHandler) validateCreate(param *Cctv) error {
+	// owner link and contact_id fill each other
+	if err := normalizeContacts(param, nil); err != nil {
+		return err
+	}
+
+	// validate input
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+
+	// validate tags & custom fields
+	if err := uc.validateCustomFields(param, true); err != nil {
+		return err
+	}
+
+	// validate coordinates
+	if param.Coordinates != nil {
+		if err := param.Coordinates.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// validate initial status
+	if param.Status == StatusDecommissioned {
+		return errors.New("New " + ModuleName + " cannot be decommissioned")
+	}
+
+	// validate recorder & channel is valid
+	if err := uc.validateRecorder(param, ""); err != nil {
+		return err
+	}
+
+	// canonical ip & mac address, vlan range
+	if err := applyNetwork(param); err != nil {
+		return err
+	}
+
+	// link brand & model to the catalog, pre-fill stream urls of the model
+	if err := uc.applyCatalog(param, nil); err != nil {
+		return err
+	}
+
+	// firmware updated time follow the version
+	if err := applyFirmware(param, nil); err != nil {
+		return err
+	}
+
+	// validate purchase, warranty & replacement dates
+	if err := validateLifecycle(param, nil); err != nil {
+		return err
+	}
+
+	// validate ip_address, port & channel is unique
+	if err := uc.validateUniqueAddress(param, ""); err != nil {
+		return err
+	}
+
+	// validate external id is unique per contact
+	if err := uc.validateUniqueExternalID(param, ""); err != nil {
+		return err
+	}
+
+	// validate every linked contact is valid
+	if err := uc.validateContacts(param); err != nil {
+		return err
+	}
+
+	// validate site & zone is valid
+	if err := uc.validateSite(param); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateCustomFields normalize the tags and check custom fields against their schema
+func (uc *UsecaseHandler) validateCustomFields(param *Cctv, create bool) error {
+	tags, err := customfield.NormalizeTags(param.Tags)
+	if err != nil {
+		return err
+	}
+	param.Tags = tags
+	return customfield.Validate(uc.Ctx, customfield.EntityCctv, param.CustomFields, create)
+}
+
+// validateUpdate check changed cctv against every rule, may fill ip address from the recorder
+func (uc *UsecaseHandler) validateUpdate(param *Cctv, oldData *Cctv) error {
+	id := oldData.CctvID
+
+	// owner link follow contact_id, other links kept unless sent
+	if err := normalizeContacts(param, oldData); err != nil {
+		return err
+	}
+
+	// validate tags & custom fields
+	if err := uc.validateCustomFields(param, false); err != nil {
+		return err
+	}
+
+	// validate status transition, move which need reason must use status endpoint
+	if param.Status != "" && param.Status != oldData.Status {
+		if err := CheckTransition(oldData.Status, param.Status, nil); err != nil {
+			return err
+		}
+	}
+
+	// validate coordinates
+	if param.Coordinates != nil {
+		if err := param.Coordinates.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// validate recorder & channel is valid
+	if err := uc.validateRecorder(param, id); err != nil {
+		return err
+	}
+
+	// canonical ip & mac address, vlan range
+	if err := applyNetwork(param); err != nil {
+		return err
+	}
+
+	// link brand & model to the catalog, pre-fill stream urls of the model
+	if err := uc.applyCatalog(param, oldData); err != nil {
+		return err
+	}
+
+	// firmware updated time follow the version
+	if err := applyFirmware(param, oldData); err != nil {
+		return err
+	}
+
+	// validate purchase, warranty & replacement dates
+	if err := validateLifecycle(param, oldData); err != nil {
+		return err
+	}
+
+	// validate ip address, port & channel is unique
+	if err := uc.validateUniqueAddress(param, id); err != nil {
+		return err
+	}
+
+	// validate external id is unique per contact
+	if err := uc.validateUniqueExternalID(param, id); err != nil {
+		return err
+	}
+
+	// validate every linked contact is valid
+	if err := uc.validateContacts(param); err != nil {
+		return err
+	}
+
+	// validate site & zone is valid
+	if err := uc.validateSite(param); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (uc *UsecaseHandler) validateSite(param *Cctv) error {
+	hasSite := param.SiteID != nil && *param.SiteID != ""
+	hasZone := param.ZoneID != nil && *param.ZoneID != ""
+	if !hasSite {
+		if hasZone {
+			return errors.New("Zone cannot be set without site")
+		}
+		return nil
+	}
+
+	siteUC := site.UsecaseHandler{
+		Ctx: uc.Ctx,
+	}
+	if hasZone {
+		_, err := siteUC.GetZone(*param.SiteID, *param.ZoneID)
+		return err
+	}
+	_, err := siteUC.GetByID(*param.SiteID)
+	return err
+}
+
+// validateRecorder check recorder exists and the channel is free,
+// camera without ip address inherit the recorder ip address
+func (uc *UsecaseHandler) validateRecorder(param *Cctv, excludeID string) error {
+	if param.RecorderID == nil || *param.RecorderID == "" {
+		if param.Channel != nil {
+			return errors.New("Channel cannot be set without recorder")
+		}
+		return nil
+	}
+	if param.Channel == nil {
+		return errors.New("Channel is required when recorder is set")
+	}
+
+	recorderUC := recorder.UsecaseHandler{
+		Ctx: uc.Ctx,
+	}
+	rec, err := recorderUC.GetByID(*param.RecorderID)
+	if err != nil {
+		return err
+	}
+
+	if *param.Channel > rec.ChannelCount {
+		return errors.New("Channel is out of range of recorder channel count")
+	}
+	for _, v := range rec.Channels {
+		if v.CctvID != excludeID && v.Channel != nil && *v.Channel == *param.Channel {
+			return errors.New("Channel already used by CCTV " + v.CctvID)
+		}
+	}
+
+	if param.IPAddress == nil || *param.IPAddress == "" {
+		param.IPAddress = &rec.IPAddress
+		if param.Port == nil {
+			param.Port = rec.Port
+		}
+	}
+
+	return nil
+}
+
+// validateUniqueAddress ip address is unique per (ip, port, channel),
+// so channels of one recorder can share the same ip address
+func (uc *UsecaseHandler) validateUniqueAddress(param *Cctv, excludeID string) error {
+	if param.IPAddress == nil || *param.IPAddress == "" {
+		return nil
+	}
+
+	filter := bson.M{
+		"ip_address": param.IPAddress,
+		"port":       param.Port,
+		"channel":    param.Channel,
+	}
+	if excludeID != "" {
+		filter["cctv_id"] = bson.M{"$ne": excludeID}
+	}
+
+	count, err := Collection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("Duplicate Ip Address, port and channel")
+	}
+	return nil
+}
+
+func (uc *UsecaseHandler) validateUniqueExternalID(param *Cctv, excludeID string) error {
+	if param.ExternalID == nil || *param.ExternalID == "" {
+		return nil
+	}
+
+	filter := bson.M{
+		"contact_id":  param.ContactID,
+		"external_id": param.ExternalID,
+	}
+	if excludeID != "" {
+		filter["cctv_id"] = bson.M{"$ne": excludeID}
+	}
+
+	count, err := Collection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("Duplicate external id")
+	}
+	return nil
+}
+
+func encryptCredentials(param *Cctv) error {
+	param.EncryptedCredentials = nil
+	if param.Credentials == nil {
+		return nil
+	}
+
+	if err := valildator.Struct(param.Credentials); err != nil {
+		return err
+	}
+	plain, err := json.Marshal(param.Credentials)
+	if err != nil {
+		return err
+	}
+	param.EncryptedCredentials, err = utils.Encrypt(plain)
+	if err != nil {
+		return err
+	}
 
+	// never send plain credentials back
+	param.Credentials = nil
+	param.HasCredentials = true
 	return nil
 }
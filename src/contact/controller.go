@@ -2,11 +2,16 @@ package contact
 
 import (
 	"context"
+	"errors"
+	"io"
+	"log"
 	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/maulanar/gin-kecilin/src/customfield"
 	"github.com/maulanar/gin-kecilin/utils"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +19,9 @@ import (
 
 var ModuleName = "Contact"
 
+// max size of vCard import file, 5 MB
+const maxVCardFile = 5 << 20
+
 func GetHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
@@ -37,8 +45,14 @@ func GetHandler() gin.HandlerFunc {
 			if key == "page" || key == "limit" || key == "order_by" {
 				continue
 			}
+			// filter contact by site of their cctvs
+			if key == "site_id" {
+				key = "cctvs.site_id"
+			}
 			filters[key] = values
 		}
+		// phone in any format
+		utils.PhoneFilters(filters)
 
 		uc := UsecaseHandler{
 			Ctx:   ctx,
@@ -50,6 +64,10 @@ func GetHandler() gin.HandlerFunc {
 				AllowedSortFields: AllowedSortFields,
 			},
 		}
+		if err := customfield.Apply(ctx, customfield.EntityContact, &uc.FilterAndSort); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
 		datas, err := uc.Get()
 		if err != nil {
@@ -89,6 +107,11 @@ func GetByIDHandler() gin.HandlerFunc {
 
 		data, err := uc.GetByID(id)
 		if err != nil {
+			// merged contact redirect to the one it was merged into
+			if newID, rerr := uc.ResolveRedirect(id); rerr == nil {
+				c.Redirect(http.StatusPermanentRedirect, "/api/contacts/"+newID)
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -179,8 +202,18 @@ func DeleteHandler() gin.HandlerFunc {
 			Ctx: ctx,
 		}
 
-		err := uc.DeleteByID(id)
+		// policy=restrict|cascade|reassign, reassign need reassign_to
+		param := DeleteParam{
+			Policy:     c.Query("policy"),
+			ReassignTo: c.Query("reassign_to"),
+		}
+		err := uc.DeleteByID(id, &param)
 		if err != nil {
+			var refErr *ReferencedError
+			if errors.As(err, &refErr) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "cctv_ids": refErr.CctvIDs})
+				return
+			}
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
@@ -193,3 +226,289 @@ func DeleteHandler() gin.HandlerFunc {
 		c.JSON(http.StatusOK, resp.BuildSingleResponse())
 	}
 }
+
+// ExportHandler stream contacts matching the same filter & sort as GetHandler, format csv (default), xlsx or ndjson.
+// flatten=true write one row per cctv of the contact
+func ExportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := strings.ToLower(c.DefaultQuery("format", utils.ExportCSV))
+		contentType, ok := utils.ExportContentTypes[format]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv, xlsx or ndjson"})
+			return
+		}
+		flatten := c.Query("flatten") == "true"
+		defaults := DefaultExportColumns
+		if flatten {
+			defaults = DefaultFlatExportColumns
+		}
+		paths, err := customfield.ExportColumns(c.Request.Context(), customfield.EntityContact, ExportPaths(flatten))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		columns, err := utils.ParseExportColumns(c.Query("columns"), paths, defaults)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Minute)
+		defer cancel()
+
+		filters := map[string][]string{}
+		for key, values := range c.Request.URL.Query() {
+			if key == "page" || key == "limit" || key == "order_by" || key == "format" || key == "columns" || key == "flatten" {
+				continue
+			}
+			// filter contact by site of their cctvs
+			if key == "site_id" {
+				key = "cctvs.site_id"
+			}
+			filters[key] = values
+		}
+		// phone in any format
+		utils.PhoneFilters(filters)
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+			FilterAndSort: utils.HelperUsecaseHandler{
+				Filters:           filters,
+				Sort:              c.Query("order_by"),
+				AllowedSortFields: AllowedSortFields,
+			},
+		}
+		if err := customfield.Apply(ctx, customfield.EntityContact, &uc.FilterAndSort); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="contacts_`+time.Now().Format("20060102")+"."+format+`"`)
+		c.Status(http.StatusOK)
+
+		w, err := utils.NewExportWriter(format, c.Writer, columns)
+		if err == nil {
+			err = uc.Export(w, columns, paths, flatten)
+		}
+		if err != nil {
+			// headers are already sent, only log it
+			log.Printf("Export %s failed: %v", ModuleName, err)
+		}
+	}
+}
+
+// VCardHandler download a contact as vCard, version 3.0 (default) or 4.0
+func VCardHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		version := c.DefaultQuery("version", VCard3)
+		if version != VCard3 && version != VCard4 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Version must be 3.0 or 4.0"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		data, err := uc.GetByID(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Type", "text/vcard; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="contact_`+data.ContactID+`.vcf"`)
+		c.Status(http.StatusOK)
+		if err := WriteVCard(c.Writer, data, version); err != nil {
+			log.Printf("vCard %s failed: %v", ModuleName, err)
+		}
+	}
+}
+
+// ExportVCardHandler download contacts matching the same filter & sort as GetHandler as one vCard file
+func ExportVCardHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version := c.DefaultQuery("version", VCard3)
+		if version != VCard3 && version != VCard4 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Version must be 3.0 or 4.0"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Minute)
+		defer cancel()
+
+		filters := map[string][]string{}
+		for key, values := range c.Request.URL.Query() {
+			if key == "order_by" || key == "version" {
+				continue
+			}
+			// filter contact by site of their cctvs
+			if key == "site_id" {
+				key = "cctvs.site_id"
+			}
+			filters[key] = values
+		}
+		// phone in any format
+		utils.PhoneFilters(filters)
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+			FilterAndSort: utils.HelperUsecaseHandler{
+				Filters:           filters,
+				Sort:              c.Query("order_by"),
+				AllowedSortFields: AllowedSortFields,
+			},
+		}
+		if err := customfield.Apply(ctx, customfield.EntityContact, &uc.FilterAndSort); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Type", "text/vcard; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="contacts_`+time.Now().Format("20060102")+`.vcf"`)
+		c.Status(http.StatusOK)
+		if err := uc.ExportVCard(c.Writer, version); err != nil {
+			// headers are already sent, only log it
+			log.Printf("vCard export %s failed: %v", ModuleName, err)
+		}
+	}
+}
+
+// ImportVCardHandler create contacts from a vCard file, as multipart "file" or the raw body.
+// Dry run unless dry_run=false, on_duplicate=skip (default) or update for contact with the same email
+func ImportVCardHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxVCardFile)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+		defer cancel()
+
+		var body io.Reader = c.Request.Body
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			file, _, err := c.Request.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+				return
+			}
+			defer file.Close()
+			body = file
+		}
+
+		cards, err := ParseVCards(body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		dryRun := c.DefaultQuery("dry_run", c.DefaultPostForm("dry_run", "true")) != "false"
+		onDuplicate := c.DefaultQuery("on_duplicate", c.PostForm("on_duplicate"))
+		data, err := uc.ImportVCard(cards, dryRun, onDuplicate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		message := ModuleName + " imported successfully"
+		if dryRun {
+			message = ModuleName + " import checked, nothing is saved on dry run"
+		}
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    message,
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// DuplicatesHandler list pairs of contacts which look like the same customer, highest score first.
+// contact_id limit the pairs to one contact, min_score between 0 and 1 (default 0.6)
+func DuplicatesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		minScore, err := strconv.ParseFloat(c.DefaultQuery("min_score", "0.6"), 64)
+		if err != nil || minScore < 0 || minScore > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Min score must be between 0 and 1"})
+			return
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if limit < 1 {
+			limit = 50
+		}
+		if limit > 100 {
+			limit = 100
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		datas, err := uc.FindDuplicates(c.Query("contact_id"), minScore, limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		message := "Successfully get duplicate " + ModuleName
+		if uc.Truncated {
+			message += ", contacts sharing a very common phone, email or name are not all compared"
+		}
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    message,
+			Data:       datas,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// MergeHandler merge source contacts into the contact of the path
+func MergeHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		param := MergeParam{}
+		if err := c.BindJSON(&param); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		by := ""
+		if claims, ok := utils.GetClaims(c); ok {
+			by = claims.Email
+		}
+		data, err := uc.Merge(id, &param, by)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    ModuleName + " merged successfully",
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
@@ -0,0 +1,129 @@
+package contact
+
+import (
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exportable column and its document path, cctv.* columns need flatten
+var ExportColumns = map[string]string{
+	"contact_id": "contact_id",
+	"first_name": "first_name",
+	"last_name":  "last_name",
+	"email":      "email",
+	"phone":      "phone",
+	"address":    "address",
+	"tags":       "tags",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"cctv_count": "cctv_count",
+	"cctvs":      "cctvs",
+
+	// every custom field as json, or one column per field as custom_fields.<key>
+	"custom_fields": "custom_fields",
+}
+
+// columns of the cctv row when flattened
+var ExportCctvColumns = map[string]string{
+	"cctv.cctv_id":     "cctvs.cctv_id",
+	"cctv.external_id": "cctvs.external_id",
+	"cctv.name":        "cctvs.name",
+	"cctv.location":    "cctvs.location",
+	"cctv.site_id":     "cctvs.site_id",
+	"cctv.zone_id":     "cctvs.zone_id",
+	"cctv.ip_address":  "cctvs.ip_address",
+	"cctv.port":        "cctvs.port",
+	"cctv.recorder_id": "cctvs.recorder_id",
+	"cctv.channel":     "cctvs.channel",
+	"cctv.brand":       "cctvs.brand",
+	"cctv.model":       "cctvs.model",
+	"cctv.status":      "cctvs.status",
+	"cctv.tags":        "cctvs.tags",
+}
+
+var DefaultExportColumns = []string{
+	"contact_id", "first_name", "last_name", "email", "phone", "address", "tags", "cctv_count", "created_at", "updated_at",
+}
+
+var DefaultFlatExportColumns = []string{
+	"contact_id", "first_name", "last_name", "email", "phone", "address",
+	"cctv.cctv_id", "cctv.name", "cctv.site_id", "cctv.ip_address", "cctv.port", "cctv.channel",
+	"cctv.brand", "cctv.model", "cctv.status",
+}
+
+// ExportPaths column paths allowed for the export mode
+func ExportPaths(flatten bool) map[string]string {
+	if !flatten {
+		return ExportColumns
+	}
+	paths := map[string]string{}
+	for k, v := range ExportColumns {
+		if k != "cctvs" {
+			paths[k] = v
+		}
+	}
+	for k, v := range ExportCctvColumns {
+		paths[k] = v
+	}
+	return paths
+}
+
+// Export write every contact matching the filter, flatten write one row per cctv.
+// Paths are ExportPaths with the custom field columns
+func (uc *UsecaseHandler) Export(w utils.ExportWriter, columns []string, paths map[string]string, flatten bool) error {
+	filter := uc.FilterAndSort.SetFilter()
+	sort := uc.FilterAndSort.SetSort()
+
+	// related cctvs, without credentials
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         "cctvs",
+			"localField":   "contact_id",
+			"foreignField": "contacts.contact_id",
+			"pipeline": bson.A{
+				bson.M{"$project": bson.M{"_id": 0, "credentials": 0}},
+			},
+			"as": "cctvs",
+		}}},
+		bson.D{{Key: "$addFields", Value: bson.M{"cctv_count": bson.M{"$size": "$cctvs"}}}},
+	}
+	if flatten {
+		// filter after unwind, so cctvs.* filter match the cctv row
+		pipeline = append(pipeline, bson.D{{Key: "$unwind", Value: bson.M{
+			"path":                       "$cctvs",
+			"preserveNullAndEmptyArrays": true,
+		}}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
+	if len(sort) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sort}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$project", Value: utils.ExportProjection(columns, paths)}})
+
+	cur, err := Collection().Aggregate(uc.Ctx, pipeline, options.Aggregate().SetBatchSize(500).SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(uc.Ctx)
+
+	values := make([]interface{}, len(columns))
+	for cur.Next(uc.Ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return err
+		}
+		for i, c := range columns {
+			values[i] = utils.DocValue(doc, paths[c])
+		}
+		if err := w.Write(values); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,369 @@
+package contact
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"github.com/maulanar/gin-kecilin/src/stream"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// what happen to the cctvs of a deleted contact
+const (
+	DeleteRestrict = "restrict" // refuse while any cctv reference the contact
+	DeleteCascade  = "cascade"  // delete the cctvs too
+	DeleteReassign = "reassign" // move the cctvs to another contact
+)
+
+type DeleteParam struct {
+	Policy     string `json:"policy"      validate:"omitempty,oneof=restrict cascade reassign"`
+	ReassignTo string `json:"reassign_to" validate:"required_if=Policy reassign"`
+}
+
+// ReferencedError returned by restrict delete, contact still owns cctvs
+type ReferencedError struct {
+	CctvIDs []string
+}
+
+func (e *ReferencedError) Error() string {
+	return ModuleName + " still has CCTV assigned: " + strings.Join(e.CctvIDs, ", ")
+}
+
+// references to a missing contact, keyed by the missing contact id
+type Orphans struct {
+	Cctvs     map[string][]string `json:"cctvs"`
+	Sites     map[string][]string `json:"sites"`
+	Recorders map[string][]string `json:"recorders"`
+	Links     map[string][]string `json:"links"` // cctvs with a technical/emergency link to the missing contact
+	// missing contact merged into another one, repair always re-point to it
+	Redirects map[string]string `json:"redirects"`
+}
+
+// collection with optional contact_id, unset when the contact is gone
+var optionalOwners = []struct{ collection, idField string }{
+	{"sites", "site_id"},
+	{"recorders", "recorder_id"},
+}
+
+// deleteWithPolicy remove the contact and apply the policy to its references in one transaction
+func (uc *UsecaseHandler) deleteWithPolicy(data *Contact, param *DeleteParam) error {
+	id := data.ContactID
+	if param.Policy == DeleteReassign {
+		if param.ReassignTo == id {
+			return errors.New("Cannot reassign CCTV to the deleted " + ModuleName)
+		}
+		if _, err := uc.findOne(param.ReassignTo); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	err := database.WithTransaction(uc.Ctx, func(sc mongo.SessionContext) error {
+		// owned cctvs, legacy cctv may only have contact_id without the owner link.
+		// Checked inside the transaction so a cctv linked meanwhile is not orphaned
+		filter := bson.M{"$or": bson.A{
+			bson.M{"contact_id": id},
+			bson.M{"contacts": bson.M{"$elemMatch": bson.M{"contact_id": id, "role": RoleOwner}}},
+		}}
+		if param.Policy == DeleteRestrict {
+			cur, err := CctvCollection().Find(sc, filter, options.Find().SetProjection(bson.M{"cctv_id": 1}))
+			if err != nil {
+				return err
+			}
+			var owned []ContactCctv
+			if err := cur.All(sc, &owned); err != nil {
+				return err
+			}
+			if len(owned) > 0 {
+				ids := make([]string, 0, len(owned))
+				for _, v := range owned {
+					ids = append(ids, v.CctvID)
+				}
+				return &ReferencedError{CctvIDs: ids}
+			}
+		}
+
+		var err error
+		switch param.Policy {
+		case DeleteCascade:
+			_, err = CctvCollection().DeleteMany(sc, filter)
+		case DeleteReassign:
+			_, err = CctvCollection().UpdateMany(sc, filter, bson.M{"$set": bson.M{"contact_id": param.ReassignTo, "updated_at": now}})
+		}
+		if err != nil {
+			return err
+		}
+		if err := relinkCctvs(sc, []string{id}, param.ReassignTo, now); err != nil {
+			return err
+		}
+		if err := relinkSteps(sc, []string{id}, param.ReassignTo, now); err != nil {
+			return err
+		}
+
+		// pending invitation was sent to the deleted contact, it is not moved to the reassigned one
+		_, err = database.OpenCollection("invitations").UpdateMany(sc,
+			bson.M{"contact_id": id, "status": "pending"},
+			bson.M{"$set": bson.M{"status": "revoked", "updated_at": now}},
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range optionalOwners {
+			update := bson.M{"$unset": bson.M{"contact_id": ""}, "$set": bson.M{"updated_at": now}}
+			if param.Policy == DeleteReassign {
+				update = bson.M{"$set": bson.M{"contact_id": param.ReassignTo, "updated_at": now}}
+			}
+			if _, err := database.OpenCollection(v.collection).UpdateMany(sc, bson.M{"contact_id": id}, update); err != nil {
+				return err
+			}
+		}
+
+		_, err = Collection().DeleteOne(sc, bson.M{"contact_id": id})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, v := range data.CCTVs {
+		msg := stream.Message{Type: stream.CctvUpdated, CctvID: v.CctvID, ContactID: v.ContactID}
+		if v.SiteID != nil {
+			msg.SiteID = *v.SiteID
+		}
+		if v.ContactID == id {
+			if param.Policy == DeleteCascade {
+				msg.Type = stream.CctvDeleted
+			} else {
+				msg.ContactID = param.ReassignTo
+				v.ContactID = param.ReassignTo
+			}
+		}
+		msg.Data = v
+		stream.Publish(msg)
+	}
+	return nil
+}
+
+// relinkCctvs point the cctv contact links of the from contacts to another contact, or remove them when to is empty.
+// The owner contact_id is not touched
+func relinkCctvs(sc mongo.SessionContext, from []string, to string, now time.Time) error {
+	filter := bson.M{"contacts.contact_id": bson.M{"$in": from}}
+	if to == "" {
+		_, err := CctvCollection().UpdateMany(sc, filter, bson.M{
+			"$pull": bson.M{"contacts": bson.M{"contact_id": bson.M{"$in": from}}},
+			"$set":  bson.M{"updated_at": now},
+		})
+		return err
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"link.contact_id": bson.M{"$in": from}}},
+	})
+	_, err := CctvCollection().UpdateMany(sc, filter, bson.M{
+		"$set": bson.M{"contacts.$[link].contact_id": to, "updated_at": now},
+	}, opts)
+	return err
+}
+
+// relinkSteps point the escalation policy steps of the from contacts to another contact, or remove them when to is empty
+func relinkSteps(sc mongo.SessionContext, from []string, to string, now time.Time) error {
+	filter := bson.M{"steps.contact_id": bson.M{"$in": from}}
+	if to == "" {
+		_, err := database.OpenCollection("escalation_policies").UpdateMany(sc, filter, bson.M{
+			"$pull": bson.M{"steps": bson.M{"contact_id": bson.M{"$in": from}}},
+			"$set":  bson.M{"updated_at": now},
+		})
+		return err
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"step.contact_id": bson.M{"$in": from}}},
+	})
+	_, err := database.OpenCollection("escalation_policies").UpdateMany(sc, filter, bson.M{
+		"$set": bson.M{"steps.$[step].contact_id": to, "updated_at": now},
+	}, opts)
+	return err
+}
+
+// FindOrphans list cctvs, sites and recorders referencing a contact which does not exist
+func (uc *UsecaseHandler) FindOrphans() (*Orphans, error) {
+	res := Orphans{Redirects: map[string]string{}}
+	var err error
+	if res.Cctvs, err = uc.orphanRefs("cctvs", "cctv_id"); err != nil {
+		return nil, err
+	}
+	if res.Sites, err = uc.orphanRefs("sites", "site_id"); err != nil {
+		return nil, err
+	}
+	if res.Recorders, err = uc.orphanRefs("recorders", "recorder_id"); err != nil {
+		return nil, err
+	}
+	if res.Links, err = uc.orphanLinks(); err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+	for _, refs := range []map[string][]string{res.Cctvs, res.Sites, res.Recorders, res.Links} {
+		for id := range refs {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return &res, nil
+	}
+	cur, err := RedirectCollection().Find(uc.Ctx, bson.M{"contact_id": bson.M{"$in": missing}},
+		options.Find().SetProjection(bson.M{"contact_id": 1, "merged_into": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var redirects []Redirect
+	if err := cur.All(uc.Ctx, &redirects); err != nil {
+		return nil, err
+	}
+	for _, v := range redirects {
+		res.Redirects[v.ContactID] = v.MergedInto
+	}
+	return &res, nil
+}
+
+// RepairOrphans re-point orphans of a merged contact to the contact it was merged into,
+// the others are deleted (sites and recorders only lose their contact) or reassigned to reassignTo
+func (uc *UsecaseHandler) RepairOrphans(policy, reassignTo string) (*Orphans, error) {
+	if policy != DeleteCascade && policy != DeleteReassign {
+		return nil, errors.New("Repair policy must be cascade or reassign")
+	}
+	if policy == DeleteReassign {
+		if _, err := uc.findOne(reassignTo); err != nil {
+			return nil, err
+		}
+	}
+
+	orphans, err := uc.FindOrphans()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = database.WithTransaction(uc.Ctx, func(sc mongo.SessionContext) error {
+		for _, v := range []struct {
+			collection string
+			refs       map[string][]string
+		}{
+			{"cctvs", orphans.Cctvs},
+			{"sites", orphans.Sites},
+			{"recorders", orphans.Recorders},
+		} {
+			for missing := range v.refs {
+				filter := bson.M{"contact_id": missing}
+				target, merged := orphans.Redirects[missing]
+				if !merged && policy == DeleteReassign {
+					target = reassignTo
+				}
+
+				var err error
+				switch {
+				case target != "":
+					_, err = database.OpenCollection(v.collection).UpdateMany(sc, filter,
+						bson.M{"$set": bson.M{"contact_id": target, "updated_at": now}})
+				case v.collection == "cctvs":
+					_, err = database.OpenCollection(v.collection).DeleteMany(sc, filter)
+				default:
+					_, err = database.OpenCollection(v.collection).UpdateMany(sc, filter,
+						bson.M{"$unset": bson.M{"contact_id": ""}, "$set": bson.M{"updated_at": now}})
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for missing := range orphans.Links {
+			target, merged := orphans.Redirects[missing]
+			if !merged && policy == DeleteReassign {
+				target = reassignTo
+			}
+			if err := relinkCctvs(sc, []string{missing}, target, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orphans, nil
+}
+
+// orphanRefs ids of the collection documents which contact_id has no contact, keyed by contact_id
+func (uc *UsecaseHandler) orphanRefs(collection, idField string) (map[string][]string, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"contact_id": bson.M{"$nin": bson.A{nil, ""}}}}},
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         "contacts",
+			"localField":   "contact_id",
+			"foreignField": "contact_id",
+			"as":           "contact",
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"contact": bson.M{"$size": 0}}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id": "$contact_id",
+			"ids": bson.M{"$push": "$" + idField},
+		}}},
+	}
+	cur, err := database.OpenCollection(collection).Aggregate(uc.Ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		ContactID string   `bson:"_id"`
+		IDs       []string `bson:"ids"`
+	}
+	if err := cur.All(uc.Ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	res := map[string][]string{}
+	for _, v := range groups {
+		res[v.ContactID] = v.IDs
+	}
+	return res, nil
+}
+
+// orphanLinks ids of the cctvs linked to a contact which does not exist, keyed by contact_id
+func (uc *UsecaseHandler) orphanLinks() (map[string][]string, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$unwind", Value: "$contacts"}},
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         "contacts",
+			"localField":   "contacts.contact_id",
+			"foreignField": "contact_id",
+			"as":           "contact",
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"contact": bson.M{"$size": 0}}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id": "$contacts.contact_id",
+			"ids": bson.M{"$addToSet": "$cctv_id"},
+		}}},
+	}
+	cur, err := CctvCollection().Aggregate(uc.Ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		ContactID string   `bson:"_id"`
+		IDs       []string `bson:"ids"`
+	}
+	if err := cur.All(uc.Ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	res := map[string][]string{}
+	for _, v := range groups {
+		res[v.ContactID] = v.IDs
+	}
+	return res, nil
+}
@@ -0,0 +1,414 @@
+package contact
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"github.com/maulanar/gin-kecilin/src/stream"
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// max contacts of one block compared pair by pair, a bigger block is a too common value like a placeholder phone
+const maxDuplicateBlock = 2000
+
+// weight of each part of the duplicate score
+var duplicateWeights = map[string]float64{
+	"name":    0.5,
+	"phone":   0.3,
+	"address": 0.2,
+}
+
+// fields which value can be picked on merge
+var mergeFields = map[string]bool{
+	"first_name": true,
+	"last_name":  true,
+	"email":      true,
+	"phone":      true,
+	"address":    true,
+}
+
+// collections referencing contact_id, re-pointed on merge
+var contactReferences = []string{"cctvs", "sites", "recorders", "users", "invitations"}
+
+// FindDuplicates score pairs of contacts, only pair of contactID when it is set.
+// Contacts are blocked by phone, email and name word prefix, and only contacts of the same block are compared,
+// so every contact is scanned without comparing every pair. Truncated is set when a block is too big to compare
+func (uc *UsecaseHandler) FindDuplicates(contactID string, minScore float64, limit int) ([]DuplicateCandidate, error) {
+	opts := options.Find().
+		SetProjection(bson.M{"contact_id": 1, "first_name": 1, "last_name": 1, "email": 1, "phone": 1, "address": 1})
+	cur, err := Collection().Find(uc.Ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var contacts []Contact
+	if err := cur.All(uc.Ctx, &contacts); err != nil {
+		return nil, err
+	}
+
+	target := -1
+	keys := make([]duplicateKey, len(contacts))
+	blocks := map[string][]int{}
+	for i := range contacts {
+		keys[i] = newDuplicateKey(&contacts[i])
+		for _, b := range duplicateBlocks(&contacts[i], &keys[i]) {
+			blocks[b] = append(blocks[b], i)
+		}
+		if contacts[i].ContactID == contactID {
+			target = i
+		}
+	}
+	if contactID != "" && target < 0 {
+		return nil, errors.New("Data " + ModuleName + " with id " + contactID + " is not found")
+	}
+
+	names := make([]string, 0, len(blocks))
+	if target >= 0 {
+		names = duplicateBlocks(&contacts[target], &keys[target])
+	} else {
+		for b := range blocks {
+			names = append(names, b)
+		}
+		sort.Strings(names)
+	}
+
+	res := []DuplicateCandidate{}
+	seen := map[[2]int]bool{}
+	for _, name := range names {
+		members := blocks[name]
+		if len(members) > maxDuplicateBlock {
+			uc.Truncated = true
+			continue
+		}
+		for x, i := range members {
+			for _, j := range members[x+1:] {
+				if target >= 0 && i != target && j != target {
+					continue
+				}
+				if seen[[2]int{i, j}] {
+					continue
+				}
+				seen[[2]int{i, j}] = true
+
+				score, parts := keys[i].score(&keys[j])
+				if score < minScore {
+					continue
+				}
+				res = append(res, DuplicateCandidate{
+					Score:    score,
+					Scores:   parts,
+					Contacts: []Contact{contacts[i], contacts[j]},
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Score > res[j].Score })
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// Merge move sources into the target contact in one transaction: pick field values,
+// re-point every contact_id reference, then replace each source with a redirect
+func (uc *UsecaseHandler) Merge(targetID string, param *MergeParam, by string) (*Contact, error) {
+	if err := valildator.Struct(param); err != nil {
+		return nil, err
+	}
+
+	for field := range param.Fields {
+		if !mergeFields[field] {
+			return nil, errors.New("Field " + field + " cannot be picked on merge")
+		}
+	}
+
+	target, err := uc.findOne(targetID)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string]*Contact{targetID: target}
+	sources := []*Contact{}
+	for _, id := range param.SourceIDs {
+		if id == targetID {
+			return nil, errors.New("Cannot merge " + ModuleName + " into itself")
+		}
+		if _, ok := byID[id]; ok {
+			continue
+		}
+		source, err := uc.findOne(id)
+		if err != nil {
+			return nil, err
+		}
+		byID[id] = source
+		sources = append(sources, source)
+	}
+
+	// target value by default, empty value is filled from the first source having it
+	set := bson.M{}
+	for field := range mergeFields {
+		from := param.Fields[field]
+		var value *string
+		if from != "" {
+			picked, ok := byID[from]
+			if !ok {
+				return nil, errors.New("Field " + field + " must be taken from the merged " + ModuleName)
+			}
+			value = contactField(picked, field)
+		} else {
+			value = contactField(target, field)
+			for _, v := range sources {
+				if value != nil && *value != "" {
+					break
+				}
+				value = contactField(v, field)
+			}
+		}
+		if value != nil {
+			set[field] = *value
+		}
+	}
+	// legacy phone which is not a valid number is kept as written, without normalized phone
+	update := bson.M{"$set": set}
+	if v, ok := set["phone"].(string); ok {
+		if e164, err := utils.NormalizePhone(v); err == nil {
+			set["phone_e164"] = e164
+		} else {
+			update["$unset"] = bson.M{"phone_e164": ""}
+		}
+	}
+	now := time.Now()
+	set["updated_at"] = now
+
+	sourceIDs := make([]string, 0, len(sources))
+	redirects := make([]interface{}, 0, len(sources))
+	for _, v := range sources {
+		sourceIDs = append(sourceIDs, v.ContactID)
+		v.CCTVs = nil
+		redirects = append(redirects, Redirect{
+			ContactID:  v.ContactID,
+			MergedInto: targetID,
+			MergedAt:   now,
+			MergedBy:   by,
+			Contact:    *v,
+		})
+	}
+
+	err = database.WithTransaction(uc.Ctx, func(sc mongo.SessionContext) error {
+		if _, err := Collection().UpdateOne(sc, bson.M{"contact_id": targetID}, update); err != nil {
+			return err
+		}
+		for _, name := range contactReferences {
+			_, err := database.OpenCollection(name).UpdateMany(sc,
+				bson.M{"contact_id": bson.M{"$in": sourceIDs}},
+				bson.M{"$set": bson.M{"contact_id": targetID, "updated_at": now}},
+			)
+			if err != nil {
+				return err
+			}
+		}
+		if err := relinkCctvs(sc, sourceIDs, targetID, now); err != nil {
+			return err
+		}
+		if err := relinkSteps(sc, sourceIDs, targetID, now); err != nil {
+			return err
+		}
+		// older redirect to a source now point to the target
+		_, err := RedirectCollection().UpdateMany(sc,
+			bson.M{"merged_into": bson.M{"$in": sourceIDs}},
+			bson.M{"$set": bson.M{"merged_into": targetID}},
+		)
+		if err != nil {
+			return err
+		}
+		if _, err := RedirectCollection().InsertMany(sc, redirects); err != nil {
+			return err
+		}
+		_, err = Collection().DeleteMany(sc, bson.M{"contact_id": bson.M{"$in": sourceIDs}})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := uc.GetByID(targetID)
+	if err != nil {
+		return nil, err
+	}
+	stream.Publish(stream.Message{
+		Type:      stream.ContactMerged,
+		ContactID: targetID,
+		Data:      bson.M{"contact_id": targetID, "merged_ids": sourceIDs},
+	})
+	return data, nil
+}
+
+// ResolveRedirect return the contact id a merged contact now live in
+func (uc *UsecaseHandler) ResolveRedirect(id string) (string, error) {
+	var data Redirect
+	err := RedirectCollection().FindOne(uc.Ctx, bson.M{"contact_id": id}).Decode(&data)
+	if err != nil {
+		return "", err
+	}
+	return data.MergedInto, nil
+}
+
+// findOne contact without its cctvs
+func (uc *UsecaseHandler) findOne(id string) (*Contact, error) {
+	var data Contact
+	err := Collection().FindOne(uc.Ctx, bson.M{"contact_id": id}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + ModuleName + " with id " + id + " is not found")
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+func contactField(c *Contact, field string) *string {
+	switch field {
+	case "first_name":
+		return c.FirstName
+	case "last_name":
+		return c.LastName
+	case "email":
+		return c.Email
+	case "phone":
+		return c.Phone
+	case "address":
+		return c.Address
+	}
+	return nil
+}
+
+// normalized parts of a contact to compare
+type duplicateKey struct {
+	name    []string
+	phone   string
+	address []string
+}
+
+func newDuplicateKey(c *Contact) duplicateKey {
+	return duplicateKey{
+		name:    normalizeWords(deref(c.FirstName) + " " + deref(c.LastName)),
+		phone:   phoneDigits(deref(c.Phone)),
+		address: normalizeWords(deref(c.Address)),
+	}
+}
+
+// duplicateBlocks block names of a contact, contacts sharing none of them are not compared.
+// Name words are blocked by their first 3 letters, so a typo after them still match
+func duplicateBlocks(c *Contact, k *duplicateKey) []string {
+	res := []string{}
+	if k.phone != "" {
+		res = append(res, "phone:"+k.phone)
+	}
+	if email := strings.ToLower(strings.TrimSpace(deref(c.Email))); email != "" {
+		res = append(res, "email:"+email)
+	}
+	seen := map[string]bool{}
+	for _, w := range k.name {
+		prefix := []rune(w)
+		if len(prefix) < 2 {
+			continue
+		}
+		if len(prefix) > 3 {
+			prefix = prefix[:3]
+		}
+		if b := "name:" + string(prefix); !seen[b] {
+			seen[b] = true
+			res = append(res, b)
+		}
+	}
+	return res
+}
+
+// score weighted similarity of the parts known on both contacts
+func (k *duplicateKey) score(o *duplicateKey) (float64, map[string]float64) {
+	parts := map[string]float64{}
+	if len(k.name) > 0 && len(o.name) > 0 {
+		parts["name"] = nameSimilarity(k.name, o.name)
+	}
+	if k.phone != "" && o.phone != "" {
+		parts["phone"] = 0
+		if k.phone == o.phone {
+			parts["phone"] = 1
+		}
+	}
+	if len(k.address) > 0 && len(o.address) > 0 {
+		parts["address"] = jaccard(k.address, o.address)
+	}
+
+	// name is required, phone or address alone is not the same customer
+	if _, ok := parts["name"]; !ok || len(parts) < 2 {
+		return 0, parts
+	}
+
+	var total, weights float64
+	for name, v := range parts {
+		total += v * duplicateWeights[name]
+		weights += duplicateWeights[name]
+	}
+	return float64(int(total/weights*1000)) / 1000, parts
+}
+
+// normalizeWords lowercase words without punctuation
+func normalizeWords(v string) []string {
+	return strings.FieldsFunc(strings.ToLower(v), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// phoneDigits last 9 digits, so local and international format of a number are equal
+func phoneDigits(v string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, v)
+	if len(digits) > 9 {
+		digits = digits[len(digits)-9:]
+	}
+	return digits
+}
+
+// nameSimilarity best of word overlap and edit distance of the whole name
+func nameSimilarity(a, b []string) float64 {
+	words := jaccard(a, b)
+	x, y := strings.Join(a, " "), strings.Join(b, " ")
+	longest := len([]rune(x))
+	if n := len([]rune(y)); n > longest {
+		longest = n
+	}
+	edit := 1 - float64(utils.Levenshtein(x, y))/float64(longest)
+	if edit > words {
+		return edit
+	}
+	return words
+}
+
+func jaccard(a, b []string) float64 {
+	set := map[string]int{}
+	for _, v := range a {
+		set[v] |= 1
+	}
+	for _, v := range b {
+		set[v] |= 2
+	}
+	both := 0
+	for _, v := range set {
+		if v == 3 {
+			both++
+		}
+	}
+	return float64(both) / float64(len(set))
+}
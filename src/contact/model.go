@@ -1,11 +1,14 @@
 package contact
 
 import (
+	"context"
 	"time"
 
 	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Contact struct {
@@ -14,27 +17,86 @@ type Contact struct {
 	LastName  *string            `json:"last_name,omitempty"     validate:""                       bson:"last_name,omitempty"`
 	Email     *string            `json:"email"                   validate:"required,email,min=2"   bson:"email,omitempty"`
 	Phone     *string            `json:"phone,omitempty"         validate:""                       bson:"phone,omitempty"`
+	PhoneE164 *string            `json:"phone_e164,omitempty"    bson:"phone_e164,omitempty"` // normalized phone, phone keep the number as written
 	Address   *string            `json:"address"                 validate:"required,min=2"         bson:"address,omitempty"`
+	Tags      []string           `json:"tags,omitempty"          bson:"tags,omitempty"`
 	CreatedAt time.Time          `json:"created_at"              bson:"created_at,omitempty"`
 	UpdatedAt time.Time          `json:"updated_at"              bson:"updated_at,omitempty"`
 	ContactID string             `json:"contact_id"              bson:"contact_id,omitempty"`
 
-	// relate to cctvs
-	CCTVs []ContactCctv `json:"cctvs,omitempty"`
+	// how and when to reach the contact
+	Notification *NotificationPreference `json:"notification,omitempty" bson:"notification,omitempty"`
+
+	// value of admin defined custom fields by key
+	CustomFields map[string]interface{} `json:"custom_fields,omitempty" bson:"custom_fields,omitempty"`
+
+	// relate to cctvs, every cctv the contact is linked to and the same cctvs grouped by the contact role
+	CCTVs       []ContactCctv            `json:"cctvs,omitempty"`
+	CctvsByRole map[string][]ContactCctv `json:"cctvs_by_role,omitempty" bson:"-"`
+}
+
+// role of a contact on a cctv
+const (
+	RoleOwner     = "owner"
+	RoleTechnical = "technical"
+	RoleEmergency = "emergency"
+)
+
+var Roles = []string{RoleOwner, RoleTechnical, RoleEmergency}
+
+// CctvContact link a cctv to a contact, the owner is also kept as the cctv contact_id
+type CctvContact struct {
+	ContactID string `json:"contact_id"          validate:"required" bson:"contact_id"`
+	Role      string `json:"role"                validate:"required,oneof=owner technical emergency" bson:"role"`
+	Priority  int    `json:"priority"            validate:"min=0" bson:"priority"` // lower is contacted first
+}
+
+// contact of a cctv in one role
+type RoleContact struct {
+	Priority int `json:"priority"`
+	*Contact
 }
 
 type ContactCctv struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty"`
-	CctvID    string             `json:"cctv_id"             bson:"cctv_id,omitempty"`
-	ContactID string             `json:"contact_id"          validate:"required" bson:"contact_id,omitempty"`
-	Name      string             `json:"name"                validate:"required" bson:"name,omitempty"`
-	Location  *string            `json:"location"            bson:"location,omitempty"`
-	IPAddress *string            `json:"ip_address"          bson:"ip_address,omitempty"`
-	Brand     *string            `json:"brand"               bson:"brand,omitempty"`
-	Model     *string            `json:"model"               bson:"model,omitempty"`
-	Status    string             `json:"status"              validate:"required,oneof=online offline maintenance" bson:"status,omitempty"`
-	CreatedAt time.Time          `json:"created_at"          bson:"created_at,omitempty"`
-	UpdatedAt time.Time          `json:"updated_at"          bson:"updated_at,omitempty"`
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	CctvID     string             `json:"cctv_id"             bson:"cctv_id,omitempty"`
+	ContactID  string             `json:"contact_id"          validate:"required" bson:"contact_id,omitempty"`
+	Name       string             `json:"name"                validate:"required" bson:"name,omitempty"`
+	Location   *string            `json:"location"            bson:"location,omitempty"`
+	SiteID     *string            `json:"site_id"             bson:"site_id,omitempty"`
+	ZoneID     *string            `json:"zone_id"             bson:"zone_id,omitempty"`
+	IPAddress  *string            `json:"ip_address"          bson:"ip_address,omitempty"`
+	Port       *int               `json:"port"                bson:"port,omitempty"`
+	RecorderID *string            `json:"recorder_id"         bson:"recorder_id,omitempty"`
+	Channel    *int               `json:"channel"             bson:"channel,omitempty"`
+	Brand      *string            `json:"brand"               bson:"brand,omitempty"`
+	Model      *string            `json:"model"               bson:"model,omitempty"`
+	Status     string             `json:"status"              validate:"required,oneof=pending_install online offline maintenance decommissioned" bson:"status,omitempty"`
+	Contacts   []CctvContact      `json:"contacts,omitempty"  bson:"contacts,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"          bson:"created_at,omitempty"`
+	UpdatedAt  time.Time          `json:"updated_at"          bson:"updated_at,omitempty"`
+}
+
+// pair of contacts which look like the same customer
+type DuplicateCandidate struct {
+	Score    float64            `json:"score"`
+	Scores   map[string]float64 `json:"scores"` // similarity of name, phone and address, only the parts known on both
+	Contacts []Contact          `json:"contacts"`
+}
+
+type MergeParam struct {
+	SourceIDs []string          `json:"source_ids" validate:"required,min=1,dive,required"`
+	Fields    map[string]string `json:"fields"` // field to the contact_id its value is taken from, e.g. {"email": "..."}
+}
+
+// merged contact, keep the old id resolvable
+type Redirect struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	ContactID  string             `json:"contact_id"              bson:"contact_id"`
+	MergedInto string             `json:"merged_into"             bson:"merged_into"`
+	MergedAt   time.Time          `json:"merged_at"               bson:"merged_at"`
+	MergedBy   string             `json:"merged_by,omitempty"     bson:"merged_by,omitempty"`
+	Contact    Contact            `json:"contact"                 bson:"contact"` // data before merge
 }
 
 // whitelist field can be sorted
@@ -53,3 +115,46 @@ func Collection() *mongo.Collection {
 func CctvCollection() *mongo.Collection {
 	return database.OpenCollection("cctvs")
 }
+
+// cctvLookup join every cctv the contact is linked to in any role
+func cctvLookup() bson.D {
+	return bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "cctvs"},
+		{Key: "localField", Value: "contact_id"},
+		{Key: "foreignField", Value: "contacts.contact_id"},
+		{Key: "as", Value: "cctvs"},
+	}}}
+}
+
+// groupCctvs fill CctvsByRole from the links of the joined cctvs
+func (c *Contact) groupCctvs() {
+	if len(c.CCTVs) == 0 {
+		return
+	}
+	c.CctvsByRole = map[string][]ContactCctv{}
+	for _, v := range c.CCTVs {
+		for _, link := range v.Contacts {
+			if link.ContactID == c.ContactID {
+				c.CctvsByRole[link.Role] = append(c.CctvsByRole[link.Role], v)
+			}
+		}
+	}
+}
+
+func RedirectCollection() *mongo.Collection {
+	return database.OpenCollection("contact_redirects")
+}
+
+func EnsureIndexes(ctx context.Context) error {
+	_, err := RedirectCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "contact_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "merged_into", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// phone search
+	_, err = Collection().Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "phone_e164", Value: 1}}})
+	return err
+}
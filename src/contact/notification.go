@@ -0,0 +1,81 @@
+package contact
+
+import (
+	"time"
+)
+
+// channel a contact can be notified on
+const (
+	ChannelEmail    = "email"
+	ChannelSMS      = "sms"
+	ChannelWhatsApp = "whatsapp"
+	ChannelWebhook  = "webhook"
+)
+
+// how and when the contact want to be notified
+type NotificationPreference struct {
+	Channels   []string    `json:"channels"              validate:"omitempty,dive,oneof=email sms whatsapp webhook" bson:"channels,omitempty"` // in order of preference, email when empty
+	WebhookURL *string     `json:"webhook_url,omitempty" validate:"omitempty,url" bson:"webhook_url,omitempty"`
+	QuietHours *QuietHours `json:"quiet_hours,omitempty" bson:"quiet_hours,omitempty"`
+	Timezone   string      `json:"timezone,omitempty"    validate:"omitempty,timezone" bson:"timezone,omitempty"` // IANA name, e.g. Asia/Jakarta
+	Language   string      `json:"language,omitempty"    validate:"omitempty,oneof=id en" bson:"language,omitempty"`
+}
+
+// local time range without notification, end before start cross midnight.
+// Critical alert is still sent
+type QuietHours struct {
+	Start string `json:"start"               validate:"required,datetime=15:04" bson:"start"`
+	End   string `json:"end"                 validate:"required,datetime=15:04" bson:"end"`
+}
+
+// NotificationChannels channels to try in order, email when not set
+func (c *Contact) NotificationChannels() []string {
+	if c.Notification == nil || len(c.Notification.Channels) == 0 {
+		return []string{ChannelEmail}
+	}
+	return c.Notification.Channels
+}
+
+// NotificationLanguage preferred language, en when not set
+func (c *Contact) NotificationLanguage() string {
+	if c.Notification == nil || c.Notification.Language == "" {
+		return "en"
+	}
+	return c.Notification.Language
+}
+
+// InQuietHours tell whether t is inside the contact quiet hours, in the contact timezone
+func (c *Contact) InQuietHours(t time.Time) bool {
+	if c.Notification == nil || c.Notification.QuietHours == nil {
+		return false
+	}
+	q := c.Notification.QuietHours
+	start, err := time.Parse("15:04", q.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", q.End)
+	if err != nil {
+		return false
+	}
+
+	local := t.In(c.Location())
+	now := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+
+	if from <= to {
+		return now >= from && now < to
+	}
+	return now >= from || now < to
+}
+
+// Location timezone of the contact, UTC when not set
+func (c *Contact) Location() *time.Location {
+	if c.Notification != nil && c.Notification.Timezone != "" {
+		if loc, err := time.LoadLocation(c.Notification.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
@@ -6,6 +6,9 @@ import (
 	"math"
 	"time"
 
+	"github.com/maulanar/gin-kecilin/config"
+	"github.com/maulanar/gin-kecilin/src/customfield"
+	"github.com/maulanar/gin-kecilin/src/stream"
 	"github.com/maulanar/gin-kecilin/utils"
 
 	"github.com/go-playground/validator/v10"
@@ -20,6 +23,7 @@ type UsecaseHandler struct {
 	Page          int64
 	Limit         int64
 	TotalData     int64
+	Truncated     bool // duplicate detection skipped a block too big to compare
 	FilterAndSort utils.HelperUsecaseHandler
 }
 
@@ -45,12 +49,7 @@ func (uc *UsecaseHandler) Get() ([]Contact, error) {
 
 	// get related CCTV
 	pipeline := mongo.Pipeline{
-		bson.D{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "cctvs"},
-			{Key: "localField", Value: "contact_id"},
-			{Key: "foreignField", Value: "contact_id"},
-			{Key: "as", Value: "cctvs"},
-		}}},
+		cctvLookup(),
 	}
 	// add filters
 	pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
@@ -79,6 +78,9 @@ func (uc *UsecaseHandler) Get() ([]Contact, error) {
 	if totalPages > 0 && uc.Page > totalPages {
 		datas = []Contact{}
 	}
+	for k := range datas {
+		datas[k].groupCctvs()
+	}
 
 	uc.TotalData = total
 	return datas, nil
@@ -100,6 +102,17 @@ func (uc *UsecaseHandler) Create(param *Contact) error {
 		return errors.New("Email already exists")
 	}
 
+	// normalize phone
+	param.PhoneE164, err = utils.NormalizePhonePtr(param.Phone)
+	if err != nil {
+		return err
+	}
+
+	// validate tags & custom fields
+	if err := uc.validateCustomFields(param, true); err != nil {
+		return err
+	}
+
 	param.ID = primitive.NewObjectID()
 	param.ContactID = param.ID.Hex()
 	param.CreatedAt = time.Now()
@@ -109,6 +122,7 @@ func (uc *UsecaseHandler) Create(param *Contact) error {
 	if err != nil {
 		return err
 	}
+	publish(stream.ContactCreated, param)
 
 	return nil
 }
@@ -120,12 +134,7 @@ func (uc *UsecaseHandler) GetByID(id string) (*Contact, error) {
 	pipeline := mongo.Pipeline{
 		bson.D{{Key: "$match", Value: bson.M{"contact_id": id}}},
 		bson.D{{Key: "$limit", Value: 1}},
-		bson.D{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "cctvs"},
-			{Key: "localField", Value: "contact_id"},
-			{Key: "foreignField", Value: "contact_id"},
-			{Key: "as", Value: "cctvs"},
-		}}},
+		cctvLookup(),
 	}
 
 	dt, err := Collection().Aggregate(uc.Ctx, pipeline)
@@ -143,6 +152,10 @@ func (uc *UsecaseHandler) GetByID(id string) (*Contact, error) {
 		}
 		return nil, err
 	}
+	if len(data) == 0 {
+		return nil, errors.New("Data " + ModuleName + " with id " + id + " is not found")
+	}
+	data[0].groupCctvs()
 
 	return &data[0], nil
 }
@@ -159,7 +172,7 @@ func (uc *UsecaseHandler) UpdateByID(id string, param *Contact) error {
 	param.UpdatedAt = time.Now()
 
 	// validate email is unique
-	if oldData.Email != nil && *oldData.Email != *param.Email {
+	if oldData.Email != nil && param.Email != nil && *oldData.Email != *param.Email {
 		count, err := Collection().CountDocuments(uc.Ctx, bson.M{"email": param.Email})
 		if err != nil {
 			return err
@@ -170,28 +183,68 @@ func (uc *UsecaseHandler) UpdateByID(id string, param *Contact) error {
 		}
 	}
 
+	// normalize phone
+	param.PhoneE164, err = utils.NormalizePhonePtr(param.Phone)
+	if err != nil {
+		return err
+	}
+
+	// validate tags & custom fields
+	if err := uc.validateCustomFields(param, false); err != nil {
+		return err
+	}
+
 	filter := bson.M{"contact_id": id}
 	update := bson.M{"$set": param}
+	customfield.UnsetEmpty(update, param.Tags, param.CustomFields)
 	_, err = Collection().UpdateOne(uc.Ctx, filter, update)
 	if err != nil {
 		return err
 	}
+	publish(stream.ContactUpdated, param)
 
 	return nil
 }
 
-func (uc *UsecaseHandler) DeleteByID(id string) error {
-	// validate id exists
-	_, err := uc.GetByID(id)
+// validateCustomFields normalize the tags and check custom fields against their schema
+func (uc *UsecaseHandler) validateCustomFields(param *Contact, create bool) error {
+	tags, err := customfield.NormalizeTags(param.Tags)
 	if err != nil {
 		return err
 	}
+	param.Tags = tags
+	return customfield.Validate(uc.Ctx, customfield.EntityContact, param.CustomFields, create)
+}
 
-	filter := bson.M{"contact_id": id}
-	_, err = Collection().DeleteOne(uc.Ctx, filter)
+// DeleteByID delete the contact, its cctvs are handled by the policy (config default when empty)
+func (uc *UsecaseHandler) DeleteByID(id string, param *DeleteParam) error {
+	if param.Policy == "" {
+		param.Policy = config.CONTACT_DELETE_POLICY
+	}
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+
+	// validate id exists
+	data, err := uc.GetByID(id)
 	if err != nil {
 		return err
 	}
 
+	if err := uc.deleteWithPolicy(data, param); err != nil {
+		return err
+	}
+	data.CCTVs = nil
+	publish(stream.ContactDeleted, data)
+
 	return nil
 }
+
+// publish contact change to the live stream
+func publish(msgType string, data *Contact) {
+	stream.Publish(stream.Message{
+		Type:      msgType,
+		ContactID: data.ContactID,
+		Data:      data,
+	})
+}
@@ -0,0 +1,418 @@
+package contact
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// supported vCard version
+const (
+	VCard3 = "3.0"
+	VCard4 = "4.0"
+)
+
+// max cards of one import file
+const maxVCardImport = 5000
+
+// action on contact with the same email
+const (
+	OnDuplicateSkip   = "skip"
+	OnDuplicateUpdate = "update"
+)
+
+// one card of the import file, mapped to contact fields
+type VCard struct {
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+	Address   string
+}
+
+type VCardImportResult struct {
+	DryRun  bool             `json:"dry_run"`
+	Total   int              `json:"total"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Skipped int              `json:"skipped"`
+	Invalid int              `json:"invalid"`
+	Cards   []VCardImportRow `json:"cards"`
+}
+
+type VCardImportRow struct {
+	Index     int      `json:"index"`  // position of the card in the file, start from 1
+	Action    string   `json:"action"` // create, update or skip
+	Email     string   `json:"email"`
+	ContactID string   `json:"contact_id,omitempty"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// WriteVCard encode contact as a vCard of the version
+func WriteVCard(w io.Writer, data *Contact, version string) error {
+	first, last := deref(data.FirstName), deref(data.LastName)
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:" + version,
+		"N:" + escapeVCard(last) + ";" + escapeVCard(first) + ";;;",
+		"FN:" + escapeVCard(strings.TrimSpace(first+" "+last)),
+	}
+	// uid of 4.0 is an uri by default
+	if version == VCard3 {
+		lines = append(lines, "UID:"+data.ContactID)
+	} else {
+		lines = append(lines, "UID;VALUE=text:"+data.ContactID)
+	}
+	if v := deref(data.Email); v != "" {
+		if version == VCard3 {
+			lines = append(lines, "EMAIL;TYPE=INTERNET:"+escapeVCard(v))
+		} else {
+			lines = append(lines, "EMAIL:"+escapeVCard(v))
+		}
+	}
+	if v := deref(data.Phone); v != "" {
+		if version == VCard3 {
+			lines = append(lines, "TEL;TYPE=VOICE:"+escapeVCard(v))
+		} else {
+			if data.PhoneE164 != nil {
+				v = *data.PhoneE164
+			}
+			lines = append(lines, "TEL;VALUE=uri:tel:"+strings.ReplaceAll(v, " ", ""))
+		}
+	}
+	if v := deref(data.Address); v != "" {
+		// address is stored as one line, put it in the street component
+		lines = append(lines, "ADR:;;"+escapeVCard(v)+";;;;")
+	}
+	if !data.UpdatedAt.IsZero() {
+		lines = append(lines, "REV:"+data.UpdatedAt.UTC().Format("20060102T150405Z"))
+	}
+	lines = append(lines, "END:VCARD")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, foldVCard(line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportVCard write every contact matching the filter as vCard, one after another
+func (uc *UsecaseHandler) ExportVCard(w io.Writer, version string) error {
+	filter := uc.FilterAndSort.SetFilter()
+	sort := uc.FilterAndSort.SetSort()
+
+	pipeline := mongo.Pipeline{
+		cctvLookup(),
+		bson.D{{Key: "$match", Value: filter}},
+	}
+	if len(sort) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sort}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$project", Value: bson.M{"cctvs": 0}}})
+
+	cur, err := Collection().Aggregate(uc.Ctx, pipeline, options.Aggregate().SetBatchSize(500))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(uc.Ctx)
+
+	for cur.Next(uc.Ctx) {
+		var data Contact
+		if err := cur.Decode(&data); err != nil {
+			return err
+		}
+		if err := WriteVCard(w, &data, version); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// ParseVCards read every card of a vCard 3.0/4.0 file
+func ParseVCards(r io.Reader) ([]VCard, error) {
+	cards := []VCard{}
+	var card *VCard
+
+	lines, err := unfoldVCard(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		name, params, value, ok := splitVCardLine(line)
+		if !ok {
+			continue
+		}
+
+		switch name {
+		case "BEGIN":
+			if strings.EqualFold(value, "VCARD") {
+				card = &VCard{}
+			}
+			continue
+		case "END":
+			if card != nil && strings.EqualFold(value, "VCARD") {
+				cards = append(cards, *card)
+				if len(cards) > maxVCardImport {
+					return nil, errors.New("vCard file has more than 5000 cards")
+				}
+				card = nil
+			}
+			continue
+		}
+		if card == nil {
+			continue
+		}
+
+		switch name {
+		case "N":
+			parts := splitVCardValue(value, ';')
+			if len(parts) > 0 {
+				card.LastName = parts[0]
+			}
+			if len(parts) > 1 {
+				card.FirstName = parts[1]
+			}
+		case "FN":
+			if card.FirstName == "" && card.LastName == "" {
+				fn := strings.Fields(unescapeVCard(value))
+				if len(fn) > 0 {
+					card.FirstName = fn[0]
+					card.LastName = strings.Join(fn[1:], " ")
+				}
+			}
+		case "EMAIL":
+			if card.Email == "" || isPreferred(params) {
+				card.Email = unescapeVCard(value)
+			}
+		case "TEL":
+			if card.Phone == "" || isPreferred(params) {
+				card.Phone = strings.TrimPrefix(unescapeVCard(value), "tel:")
+			}
+		case "ADR":
+			if card.Address == "" || isPreferred(params) {
+				parts := []string{}
+				for _, p := range splitVCardValue(value, ';') {
+					if p = strings.TrimSpace(p); p != "" {
+						parts = append(parts, p)
+					}
+				}
+				card.Address = strings.Join(parts, ", ")
+			}
+		}
+	}
+	return cards, nil
+}
+
+// ImportVCard create contact of every card, contact with the same email (case insensitive) is skipped or updated.
+// Counts on dry run are what would be done
+func (uc *UsecaseHandler) ImportVCard(cards []VCard, dryRun bool, onDuplicate string) (*VCardImportResult, error) {
+	if onDuplicate == "" {
+		onDuplicate = OnDuplicateSkip
+	}
+	if onDuplicate != OnDuplicateSkip && onDuplicate != OnDuplicateUpdate {
+		return nil, errors.New("On duplicate must be skip or update")
+	}
+	if len(cards) == 0 {
+		return nil, errors.New("vCard file has no card")
+	}
+
+	res := VCardImportResult{
+		DryRun: dryRun,
+		Cards:  []VCardImportRow{},
+	}
+	seen := map[string]int{}
+
+	for i, card := range cards {
+		res.Total++
+		row := VCardImportRow{Index: i + 1, Action: "create", Email: card.Email}
+		param := card.contact()
+
+		var err error
+		email := strings.ToLower(card.Email)
+		if prev, ok := seen[email]; ok && email != "" {
+			err = errors.New("Duplicate email with card " + strconv.Itoa(prev))
+		}
+		seen[email] = i + 1
+
+		var existing Contact
+		if err == nil && card.Email != "" {
+			filter := bson.M{"email": bson.M{"$regex": "^" + regexp.QuoteMeta(card.Email) + "$", "$options": "i"}}
+			err = Collection().FindOne(uc.Ctx, filter).Decode(&existing)
+			switch {
+			case err == nil:
+				row.ContactID = existing.ContactID
+				row.Action = onDuplicate
+				// field missing on the card keep the contact value
+				if onDuplicate == OnDuplicateUpdate {
+					param.keepMissing(&existing)
+				}
+			case errors.Is(err, mongo.ErrNoDocuments):
+				err = nil
+			}
+		}
+		if err == nil {
+			err = valildator.Struct(param)
+		}
+
+		if err == nil && !dryRun {
+			switch row.Action {
+			case "create":
+				err = uc.Create(param)
+				row.ContactID = param.ContactID
+			case OnDuplicateUpdate:
+				err = uc.UpdateByID(existing.ContactID, param)
+			}
+		}
+
+		switch {
+		case err != nil:
+			row.Errors = []string{err.Error()}
+			res.Invalid++
+		case row.Action == OnDuplicateSkip:
+			res.Skipped++
+		case row.Action == OnDuplicateUpdate:
+			res.Updated++
+		default:
+			res.Created++
+		}
+		res.Cards = append(res.Cards, row)
+	}
+
+	return &res, nil
+}
+
+// contact of the card, field missing on the card is nil so an update does not clear it
+func (v *VCard) contact() *Contact {
+	param := &Contact{}
+	for _, f := range []struct {
+		dst **string
+		v   string
+	}{
+		{&param.FirstName, v.FirstName},
+		{&param.LastName, v.LastName},
+		{&param.Email, v.Email},
+		{&param.Phone, v.Phone},
+		{&param.Address, v.Address},
+	} {
+		if f.v != "" {
+			value := f.v
+			*f.dst = &value
+		}
+	}
+	return param
+}
+
+// keepMissing fill field not sent with the existing value, required field must stay valid on update
+func (c *Contact) keepMissing(existing *Contact) {
+	for _, f := range []struct{ dst, v **string }{
+		{&c.FirstName, &existing.FirstName},
+		{&c.LastName, &existing.LastName},
+		{&c.Phone, &existing.Phone},
+		{&c.Address, &existing.Address},
+	} {
+		if *f.dst == nil {
+			*f.dst = *f.v
+		}
+	}
+}
+
+// unfoldVCard join folded lines, continuation line start with space or tab
+func unfoldVCard(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitVCardLine split "group.NAME;PARAM=x:value" to its name, params and value
+func splitVCardLine(line string) (string, []string, string, bool) {
+	idx := strings.Index(line, ":")
+	if idx < 0 {
+		return "", nil, "", false
+	}
+	head, value := line[:idx], line[idx+1:]
+	parts := strings.Split(head, ";")
+	name := strings.ToUpper(parts[0])
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+	return name, parts[1:], value, true
+}
+
+// splitVCardValue split structured value on unescaped separator, then unescape each part
+func splitVCardValue(value string, sep byte) []string {
+	parts := []string{}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			b.WriteByte(value[i])
+			b.WriteByte(value[i+1])
+			i++
+		case value[i] == sep:
+			parts = append(parts, unescapeVCard(b.String()))
+			b.Reset()
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return append(parts, unescapeVCard(b.String()))
+}
+
+func isPreferred(params []string) bool {
+	for _, p := range params {
+		p = strings.ToUpper(p)
+		if strings.HasPrefix(p, "PREF") || (strings.HasPrefix(p, "TYPE=") && strings.Contains(p, "PREF")) {
+			return true
+		}
+	}
+	return false
+}
+
+func escapeVCard(v string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`).Replace(v)
+}
+
+func unescapeVCard(v string) string {
+	return strings.NewReplacer(`\\`, `\`, `\,`, ",", `\;`, ";", `\n`, "\n", `\N`, "\n").Replace(v)
+}
+
+// foldVCard split line longer than 75 octets, without breaking a utf-8 character
+func foldVCard(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+func deref(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
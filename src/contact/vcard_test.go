@@ -0,0 +1,207 @@
+package contact
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseVCards(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []VCard
+	}{
+		{
+			name: "vcard 3.0",
+			in: "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Santoso;Budi;;;\r\nFN:Budi Santoso\r\n" +
+				"EMAIL;TYPE=INTERNET:budi@example.com\r\nTEL;TYPE=VOICE:0812-3456-7890\r\n" +
+				"ADR:;;Jl. Merdeka 1;Jakarta;;10110;Indonesia\r\nEND:VCARD\r\n",
+			want: []VCard{{
+				FirstName: "Budi", LastName: "Santoso", Email: "budi@example.com",
+				Phone: "0812-3456-7890", Address: "Jl. Merdeka 1, Jakarta, 10110, Indonesia",
+			}},
+		},
+		{
+			name: "vcard 4.0 tel uri",
+			in:   "BEGIN:VCARD\nVERSION:4.0\nFN:Siti\nEMAIL:siti@example.com\nTEL;VALUE=uri:tel:+6281234567890\nEND:VCARD\n",
+			want: []VCard{{FirstName: "Siti", Email: "siti@example.com", Phone: "+6281234567890"}},
+		},
+		{
+			name: "folded lines",
+			in: "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Santoso;Bu\r\n di;;;\r\nEMAIL:budi@exa\r\n\tmple.com\r\n" +
+				"ADR:;;Jl. Jend. Sudirman Kav. 52-53\\, Gedung A\\; Lt. 1\r\n 0;Jakarta\r\n  Selatan;;;\r\nEND:VCARD\r\n",
+			want: []VCard{{
+				FirstName: "Budi", LastName: "Santoso", Email: "budi@example.com",
+				Address: "Jl. Jend. Sudirman Kav. 52-53, Gedung A; Lt. 10, Jakarta Selatan",
+			}},
+		},
+		{
+			name: "folded inside a multi byte character",
+			in:   "BEGIN:VCARD\nN:M\xc3\n \xbcller;J\xc3\xbcrgen;;;\nEND:VCARD\n",
+			want: []VCard{{FirstName: "Jürgen", LastName: "Müller"}},
+		},
+		{
+			name: "name from fn",
+			in:   "BEGIN:VCARD\nFN:Agus Budi Santoso\nEND:VCARD\n",
+			want: []VCard{{FirstName: "Agus", LastName: "Budi Santoso"}},
+		},
+		{
+			name: "preferred value",
+			in: "BEGIN:VCARD\nN:A;B;;;\nEMAIL;TYPE=work:work@example.com\nEMAIL;TYPE=home,pref:home@example.com\n" +
+				"TEL:111\nTEL;PREF=1:222\nEMAIL:other@example.com\nEND:VCARD\n",
+			want: []VCard{{FirstName: "B", LastName: "A", Email: "home@example.com", Phone: "222"}},
+		},
+		{
+			name: "group and lower case",
+			in:   "begin:vcard\nitem1.email:budi@example.com\nitem1.X-ABLabel:work\nn:Santoso;Budi\nend:vcard\n",
+			want: []VCard{{FirstName: "Budi", LastName: "Santoso", Email: "budi@example.com"}},
+		},
+		{
+			name: "several cards and text outside",
+			in:   "junk\nBEGIN:VCARD\nFN:One\nEND:VCARD\nEMAIL:lost@example.com\nBEGIN:VCARD\nFN:Two\nEND:VCARD\n",
+			want: []VCard{{FirstName: "One"}, {FirstName: "Two"}},
+		},
+		{
+			name: "card without end",
+			in:   "BEGIN:VCARD\nFN:One\n",
+			want: []VCard{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVCards(strings.NewReader(tt.in))
+			if err != nil {
+				t.Fatalf("ParseVCards() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseVCards() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVCardsTooMany(t *testing.T) {
+	in := strings.Repeat("BEGIN:VCARD\nFN:A\nEND:VCARD\n", maxVCardImport+1)
+	if _, err := ParseVCards(strings.NewReader(in)); err == nil {
+		t.Error("ParseVCards() want error on more than max cards")
+	}
+}
+
+func TestWriteVCard(t *testing.T) {
+	str := func(v string) *string { return &v }
+	data := &Contact{
+		ContactID: "c-1",
+		FirstName: str("Jürgen"),
+		LastName:  str("Müller; Jr."),
+		Email:     str("jurgen@example.com"),
+		Phone:     str("0812 3456 7890"),
+		PhoneE164: str("+6281234567890"),
+		Address:   str(strings.Repeat("Jalan Raya Bogor Km. 26, Cibubur, ", 3) + "Jakarta Timur"),
+	}
+	want := []VCard{{
+		FirstName: "Jürgen", LastName: "Müller; Jr.", Email: "jurgen@example.com",
+		Address: *data.Address,
+	}}
+
+	tests := []struct {
+		version string
+		phone   string
+	}{
+		{VCard3, "0812 3456 7890"},
+		{VCard4, "+6281234567890"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteVCard(&buf, data, tt.version); err != nil {
+				t.Fatal(err)
+			}
+
+			// folded to 75 octets without breaking a character
+			for _, line := range strings.SplitAfter(buf.String(), "\r\n") {
+				if line == "" {
+					continue
+				}
+				if len(line) > 75+2 || !utf8.ValidString(line) {
+					t.Errorf("line %q is longer than 75 octets or not valid utf-8", line)
+				}
+			}
+
+			got, err := ParseVCards(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want[0].Phone = tt.phone
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestFoldVCard(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"FN:Budi", "FN:Budi\r\n"},
+		{strings.Repeat("a", 75), strings.Repeat("a", 75) + "\r\n"},
+		{strings.Repeat("a", 76), strings.Repeat("a", 75) + "\r\n a\r\n"},
+		{strings.Repeat("a", 74) + "ü", strings.Repeat("a", 74) + "\r\n ü\r\n"},
+		{strings.Repeat("a", 149), strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 74) + "\r\n"},
+	}
+	for _, tt := range tests {
+		got := foldVCard(tt.in)
+		if got != tt.want {
+			t.Errorf("foldVCard(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		lines, err := unfoldVCard(strings.NewReader(got))
+		if err != nil || len(lines) != 1 || lines[0] != tt.in {
+			t.Errorf("unfoldVCard(%q) = %q, %v, want %q", got, lines, err, tt.in)
+		}
+	}
+}
+
+func TestVCardContact(t *testing.T) {
+	str := func(v string) *string { return &v }
+	existing := &Contact{
+		FirstName: str("Budi"),
+		LastName:  str("Santoso"),
+		Email:     str("budi@example.com"),
+		Phone:     str("0812"),
+		Address:   str("Jakarta"),
+	}
+
+	tests := []struct {
+		name string
+		card VCard
+		want Contact
+	}{
+		{
+			name: "missing fields are kept",
+			card: VCard{Email: "budi@example.com", Phone: "0813"},
+			want: Contact{FirstName: str("Budi"), LastName: str("Santoso"), Email: str("budi@example.com"), Phone: str("0813"), Address: str("Jakarta")},
+		},
+		{
+			name: "sent fields are updated",
+			card: VCard{FirstName: "Agus", LastName: "Wijaya", Email: "budi@example.com", Phone: "0814", Address: "Bandung"},
+			want: Contact{FirstName: str("Agus"), LastName: str("Wijaya"), Email: str("budi@example.com"), Phone: str("0814"), Address: str("Bandung")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.card.contact()
+			got.keepMissing(existing)
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("contact() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if got := (&VCard{}).contact(); !reflect.DeepEqual(*got, Contact{}) {
+		t.Errorf("contact() of empty card = %+v, want all nil", got)
+	}
+}
@@ -0,0 +1,81 @@
+package customfield
+
+import (
+	"context"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// entity having custom fields, and the collection it is stored in
+const (
+	EntityCctv    = "cctv"
+	EntityContact = "contact"
+)
+
+var entityCollections = map[string]string{
+	EntityCctv:    "cctvs",
+	EntityContact: "contacts",
+}
+
+// type of custom field value, date is stored as YYYY-MM-DD so it sorts as text
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeDate    = "date"
+	TypeEnum    = "enum"
+)
+
+// prefix of custom field value in the document, filter & sort use custom_fields.<key>
+const Prefix = "custom_fields."
+
+// Field schema of one custom field of an entity, defined by admin
+type Field struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	FieldID   string             `json:"field_id"            bson:"field_id,omitempty"`
+	Entity    string             `json:"entity"              validate:"required,oneof=cctv contact" bson:"entity,omitempty"`
+	Key       string             `json:"key"                 validate:"required,max=50" bson:"key,omitempty"`
+	Label     string             `json:"label"               validate:"required,max=100" bson:"label,omitempty"`
+	Type      string             `json:"type"                validate:"required,oneof=string number boolean date enum" bson:"type,omitempty"`
+	Required  bool               `json:"required"            bson:"required"`
+	Options   []string           `json:"options,omitempty"   validate:"required_if=Type enum,dive,required" bson:"options,omitempty"` // allowed value of enum
+	CreatedAt time.Time          `json:"created_at"          bson:"created_at,omitempty"`
+	UpdatedAt time.Time          `json:"updated_at"          bson:"updated_at,omitempty"`
+}
+
+// whitelist field can be sorted
+var AllowedSortFields = map[string]bool{
+	"entity":     true,
+	"key":        true,
+	"label":      true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+func Collection() *mongo.Collection {
+	return database.OpenCollection("custom_fields")
+}
+
+func EnsureIndexes(ctx context.Context) error {
+	_, err := Collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "entity", Value: 1}, {Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// tags filter
+	for _, name := range entityCollections {
+		_, err := database.OpenCollection(name).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "tags", Value: 1}}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,365 @@
+package customfield
+
+import (
+	"context"
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// adjustable depending on usecase
+type UsecaseHandler struct {
+	Ctx           context.Context
+	Page          int64
+	Limit         int64
+	TotalData     int64
+	FilterAndSort utils.HelperUsecaseHandler
+}
+
+var valildator = validator.New()
+
+// key is used in the document path and query, e.g. custom_fields.asset_tag
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+const (
+	maxTags      = 50
+	maxTagLength = 50
+	maxTextValue = 500
+)
+
+func (uc *UsecaseHandler) Get() ([]Field, error) {
+	if uc.Page < 1 {
+		uc.Page = 1
+	}
+	if uc.Limit < 1 {
+		uc.Limit = 10
+	}
+
+	filter := uc.FilterAndSort.SetFilter() // dynamic filter by query param
+	sort := uc.FilterAndSort.SetSort()     // dynamic sort by query param
+	skip := (uc.Page - 1) * uc.Limit       // offset
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "entity", Value: 1}, {Key: "key", Value: 1}}
+	}
+	opts := options.Find().
+		SetSort(sort).
+		SetSkip(skip).
+		SetLimit(uc.Limit)
+
+	// total docs
+	total, err := Collection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	datas := []Field{}
+	if err := cur.All(uc.Ctx, &datas); err != nil {
+		return nil, err
+	}
+
+	totalPages := int64(math.Ceil(float64(total) / float64(uc.Limit)))
+	if totalPages > 0 && uc.Page > totalPages {
+		datas = []Field{}
+	}
+
+	uc.TotalData = total
+	return datas, nil
+}
+
+func (uc *UsecaseHandler) Create(param *Field) error {
+	if err := validateField(param); err != nil {
+		return err
+	}
+
+	// validate key is unique per entity
+	count, err := Collection().CountDocuments(uc.Ctx, bson.M{"entity": param.Entity, "key": param.Key})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("Custom field " + param.Key + " of " + param.Entity + " already exists")
+	}
+
+	param.ID = primitive.NewObjectID()
+	param.FieldID = param.ID.Hex()
+	param.CreatedAt = time.Now()
+	param.UpdatedAt = time.Now()
+
+	_, err = Collection().InsertOne(uc.Ctx, param)
+	return err
+}
+
+func (uc *UsecaseHandler) GetByID(id string) (*Field, error) {
+	var data Field
+	err := Collection().FindOne(uc.Ctx, bson.M{"field_id": id}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + ModuleName + " with id " + id + " is not found")
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+// UpdateByID update the schema, entity & key cannot be changed.
+// Stored values are checked against the new schema on their next save
+func (uc *UsecaseHandler) UpdateByID(id string, param *Field) error {
+	// validate id exists
+	oldData, err := uc.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	param.Entity = oldData.Entity
+	param.Key = oldData.Key
+	if err := validateField(param); err != nil {
+		return err
+	}
+
+	param.ID = oldData.ID
+	param.FieldID = oldData.FieldID
+	param.CreatedAt = oldData.CreatedAt
+	param.UpdatedAt = time.Now()
+
+	_, err = Collection().ReplaceOne(uc.Ctx, bson.M{"field_id": id}, param)
+	return err
+}
+
+// DeleteByID delete the schema and its value on every record of the entity
+func (uc *UsecaseHandler) DeleteByID(id string) error {
+	// validate id exists
+	data, err := uc.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	path := Prefix + data.Key
+	_, err = database.OpenCollection(entityCollections[data.Entity]).UpdateMany(uc.Ctx,
+		bson.M{path: bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{path: ""}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = Collection().DeleteOne(uc.Ctx, bson.M{"field_id": id})
+	return err
+}
+
+func validateField(param *Field) error {
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+	if !keyPattern.MatchString(param.Key) {
+		return errors.New("Key must be lowercase letters, digits and underscore, starting with a letter")
+	}
+	if param.Type != TypeEnum {
+		param.Options = nil
+	}
+	return nil
+}
+
+// fields schema of the entity by key
+func fields(ctx context.Context, entity string) (map[string]Field, error) {
+	cur, err := Collection().Find(ctx, bson.M{"entity": entity})
+	if err != nil {
+		return nil, err
+	}
+	var datas []Field
+	if err := cur.All(ctx, &datas); err != nil {
+		return nil, err
+	}
+
+	res := map[string]Field{}
+	for _, v := range datas {
+		res[v.Key] = v
+	}
+	return res, nil
+}
+
+// Validate check the custom fields of a record against the schema of the entity, values are converted to their type.
+// Required field is checked on create, and on update only when custom fields are sent
+func Validate(ctx context.Context, entity string, values map[string]interface{}, create bool) error {
+	if values == nil && !create {
+		return nil
+	}
+	schema, err := fields(ctx, entity)
+	if err != nil {
+		return err
+	}
+
+	for key, v := range values {
+		f, ok := schema[key]
+		if !ok {
+			return errors.New("Unknown custom field " + key)
+		}
+		if v == nil {
+			delete(values, key)
+			continue
+		}
+		converted, err := convert(&f, v)
+		if err != nil {
+			return err
+		}
+		values[key] = converted
+	}
+
+	for key, f := range schema {
+		if _, ok := values[key]; f.Required && !ok {
+			return errors.New("Custom field " + key + " is required")
+		}
+	}
+	return nil
+}
+
+// convert the JSON value to the type of the field
+func convert(f *Field, v interface{}) (interface{}, error) {
+	invalid := errors.New("Custom field " + f.Key + " must be a " + f.Type)
+
+	switch f.Type {
+	case TypeNumber:
+		n, ok := v.(float64)
+		if !ok {
+			return nil, invalid
+		}
+		return n, nil
+	case TypeBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, invalid
+		}
+		return b, nil
+	case TypeDate:
+		s, ok := v.(string)
+		if !ok {
+			return nil, invalid
+		}
+		if t, err := time.Parse("2006-01-02", s); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, errors.New("Custom field " + f.Key + " must be a date, YYYY-MM-DD")
+		}
+		return t.Format("2006-01-02"), nil
+	case TypeEnum:
+		s, ok := v.(string)
+		if !ok {
+			return nil, invalid
+		}
+		for _, o := range f.Options {
+			if o == s {
+				return s, nil
+			}
+		}
+		return nil, errors.New("Custom field " + f.Key + " must be one of " + strings.Join(f.Options, ", "))
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return nil, invalid
+	}
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) > maxTextValue {
+		return nil, errors.New("Custom field " + f.Key + " is too long")
+	}
+	return s, nil
+}
+
+// NormalizeTags trim, lowercase and remove duplicate tags, sorted
+func NormalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	res := []string{}
+	for _, v := range tags {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" || seen[v] {
+			continue
+		}
+		if utf8.RuneCountInString(v) > maxTagLength {
+			return nil, errors.New("Tag " + v + " is too long")
+		}
+		seen[v] = true
+		res = append(res, v)
+	}
+	if len(res) > maxTags {
+		return nil, errors.New("Too many tags")
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// UnsetEmpty add empty tags & custom fields sent on update to the $unset of the update,
+// they are skipped by $set as omitempty
+func UnsetEmpty(update bson.M, tags []string, values map[string]interface{}) {
+	unset, _ := update["$unset"].(bson.M)
+	if unset == nil {
+		unset = bson.M{}
+	}
+	if tags != nil && len(tags) == 0 {
+		unset["tags"] = ""
+	}
+	if values != nil && len(values) == 0 {
+		unset["custom_fields"] = ""
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+}
+
+// Apply let the list of the entity sort by custom fields, and filter number & boolean custom fields by their type
+func Apply(ctx context.Context, entity string, h *utils.HelperUsecaseHandler) error {
+	schema, err := fields(ctx, entity)
+	if err != nil {
+		return err
+	}
+
+	h.AllowedSortPrefixes = append(h.AllowedSortPrefixes, Prefix)
+	if h.FieldTypes == nil {
+		h.FieldTypes = map[string]string{}
+	}
+	for key, f := range schema {
+		if f.Type == TypeNumber || f.Type == TypeBoolean {
+			h.FieldTypes[Prefix+key] = f.Type
+		}
+	}
+	return nil
+}
+
+// ExportColumns add a custom_fields.<key> column for every custom field of the entity
+func ExportColumns(ctx context.Context, entity string, columns map[string]string) (map[string]string, error) {
+	schema, err := fields(ctx, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]string, len(columns)+len(schema))
+	for k, v := range columns {
+		res[k] = v
+	}
+	for key := range schema {
+		res[Prefix+key] = Prefix + key
+	}
+	return res, nil
+}
@@ -0,0 +1,49 @@
+package dashboard
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ModuleName = "Dashboard"
+
+// SummaryHandler counts for the front page, `refresh=true` to skip the cache (admin/operator)
+func SummaryHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx:     ctx,
+			Refresh: c.Query("refresh") == "true",
+		}
+		// refresh run the slow aggregation, not for everyone
+		if claims, ok := utils.GetClaims(c); uc.Refresh && (!ok || (claims.Role != utils.RoleAdmin && claims.Role != utils.RoleOperator)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admin or operator can refresh the " + ModuleName + " summary"})
+			return
+		}
+		// customer only see their own cctvs
+		if contactID, ok := utils.CustomerContactID(c); ok {
+			uc.ContactID = contactID
+		}
+
+		data, err := uc.Summary()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    "Successfully get " + ModuleName + " summary",
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
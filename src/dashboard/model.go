@@ -0,0 +1,65 @@
+package dashboard
+
+import (
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// summary shown on the front page
+type Summary struct {
+	Total          int64          `json:"total"`
+	ByStatus       []StatusCount  `json:"by_status"`
+	ByBrand        []BrandCount   `json:"by_brand"`
+	BySite         []SiteCount    `json:"by_site"`
+	ByContact      []ContactCount `json:"by_contact"`
+	OfflineLongest []OfflineCctv  `json:"offline_longest"`
+	RecentlyAdded  []RecentCctv   `json:"recently_added"`
+	GeneratedAt    time.Time      `json:"generated_at"`
+}
+
+type StatusCount struct {
+	Status string `json:"status"              bson:"_id"`
+	Count  int64  `json:"count"               bson:"count"`
+}
+
+type BrandCount struct {
+	Brand *string `json:"brand"               bson:"brand"`
+	Model *string `json:"model"               bson:"model"`
+	Count int64   `json:"count"               bson:"count"`
+}
+
+type SiteCount struct {
+	SiteID *string `json:"site_id"             bson:"_id"`
+	Name   *string `json:"name"                bson:"name"`
+	Count  int64   `json:"count"               bson:"count"`
+}
+
+type ContactCount struct {
+	ContactID string  `json:"contact_id"          bson:"_id"`
+	FirstName *string `json:"first_name"          bson:"first_name"`
+	LastName  *string `json:"last_name"           bson:"last_name"`
+	Count     int64   `json:"count"               bson:"count"`
+}
+
+type OfflineCctv struct {
+	CctvID       string    `json:"cctv_id"             bson:"cctv_id"`
+	Name         string    `json:"name"                bson:"name"`
+	ContactID    string    `json:"contact_id"          bson:"contact_id"`
+	SiteID       *string   `json:"site_id"             bson:"site_id"`
+	OfflineSince time.Time `json:"offline_since"       bson:"offline_since"`
+}
+
+type RecentCctv struct {
+	CctvID    string    `json:"cctv_id"             bson:"cctv_id"`
+	Name      string    `json:"name"                bson:"name"`
+	ContactID string    `json:"contact_id"          bson:"contact_id"`
+	SiteID    *string   `json:"site_id"             bson:"site_id"`
+	Status    string    `json:"status"              bson:"status"`
+	CreatedAt time.Time `json:"created_at"          bson:"created_at"`
+}
+
+func CctvCollection() *mongo.Collection {
+	return database.OpenCollection("cctvs")
+}
@@ -0,0 +1,260 @@
+package dashboard
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// how long the summary is served from memory
+const cacheTTL = 30 * time.Second
+
+// how long the shared aggregation may run
+const aggregateTimeout = 30 * time.Second
+
+// size of offline longest and recently added list
+const listSize = 10
+
+type cacheEntry struct {
+	data    *Summary
+	expires time.Time
+}
+
+// summary per contact of a customer, empty contact id is the summary of all cctvs.
+// Calls is the summary being computed per contact, so concurrent misses run one aggregation
+var cache struct {
+	sync.Mutex
+	entries map[string]cacheEntry
+	calls   map[string]*summaryCall
+}
+
+type summaryCall struct {
+	done chan struct{}
+	data *Summary
+	err  error
+}
+
+// adjustable depending on usecase
+type UsecaseHandler struct {
+	Ctx       context.Context
+	Refresh   bool   // skip the cache
+	ContactID string // only cctvs of the contact, for customer
+}
+
+// Summary of all cctvs, or the cctvs of the contact, cached for a short time.
+// The lock is only held to read & update the cache, aggregation run outside it
+func (uc *UsecaseHandler) Summary() (*Summary, error) {
+	cache.Lock()
+	if v, ok := cache.entries[uc.ContactID]; ok && !uc.Refresh && time.Now().Before(v.expires) {
+		cache.Unlock()
+		return v.data, nil
+	}
+
+	// join the aggregation already running for the contact, its result is fresh
+	call, ok := cache.calls[uc.ContactID]
+	if !ok {
+		call = &summaryCall{done: make(chan struct{})}
+		if cache.calls == nil {
+			cache.calls = map[string]*summaryCall{}
+		}
+		cache.calls[uc.ContactID] = call
+		go uc.run(call)
+	}
+	cache.Unlock()
+
+	select {
+	case <-call.done:
+		return call.data, call.err
+	case <-uc.Ctx.Done():
+		return nil, uc.Ctx.Err()
+	}
+}
+
+// run the aggregation shared by every waiting request, so it is not canceled when the request which
+// started it is gone
+func (uc *UsecaseHandler) run(call *summaryCall) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(uc.Ctx), aggregateTimeout)
+	defer cancel()
+	shared := UsecaseHandler{Ctx: ctx, ContactID: uc.ContactID}
+	call.data, call.err = shared.aggregate()
+
+	cache.Lock()
+	delete(cache.calls, uc.ContactID)
+	if call.err == nil {
+		now := time.Now()
+		if cache.entries == nil {
+			cache.entries = map[string]cacheEntry{}
+		}
+		for k, v := range cache.entries {
+			if !now.Before(v.expires) {
+				delete(cache.entries, k)
+			}
+		}
+		cache.entries[uc.ContactID] = cacheEntry{data: call.data, expires: call.data.GeneratedAt.Add(cacheTTL)}
+	}
+	cache.Unlock()
+	close(call.done)
+}
+
+// aggregate compute every part of the summary in a single $facet
+func (uc *UsecaseHandler) aggregate() (*Summary, error) {
+	sortByCount := bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}}
+
+	pipeline := mongo.Pipeline{}
+	if uc.ContactID != "" {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"contact_id": uc.ContactID}}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$facet", Value: bson.M{
+			"total": bson.A{
+				bson.M{"$count": "count"},
+			},
+			"by_status": bson.A{
+				bson.M{"$group": bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}},
+				sortByCount,
+			},
+			"by_brand": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":   bson.M{"brand": "$brand", "model": "$model"},
+					"count": bson.M{"$sum": 1},
+				}},
+				sortByCount,
+				bson.M{"$project": bson.M{"_id": 0, "brand": "$_id.brand", "model": "$_id.model", "count": 1}},
+			},
+			"by_site": bson.A{
+				bson.M{"$group": bson.M{"_id": "$site_id", "count": bson.M{"$sum": 1}}},
+				sortByCount,
+				bson.M{"$lookup": bson.M{
+					"from":         "sites",
+					"localField":   "_id",
+					"foreignField": "site_id",
+					"as":           "site",
+				}},
+				bson.M{"$project": bson.M{
+					"count": 1,
+					"name":  bson.M{"$arrayElemAt": bson.A{"$site.name", 0}},
+				}},
+			},
+			"by_contact": bson.A{
+				bson.M{"$group": bson.M{"_id": "$contact_id", "count": bson.M{"$sum": 1}}},
+				sortByCount,
+				bson.M{"$lookup": bson.M{
+					"from":         "contacts",
+					"localField":   "_id",
+					"foreignField": "contact_id",
+					"as":           "contact",
+				}},
+				bson.M{"$project": bson.M{
+					"count":      1,
+					"first_name": bson.M{"$arrayElemAt": bson.A{"$contact.first_name", 0}},
+					"last_name":  bson.M{"$arrayElemAt": bson.A{"$contact.last_name", 0}},
+				}},
+			},
+			"offline_longest": bson.A{
+				bson.M{"$match": bson.M{"status": "offline"}},
+				// offline since the latest move to offline, or last update for cctv without history
+				bson.M{"$lookup": bson.M{
+					"from": "cctv_status_histories",
+					"let":  bson.M{"cctv_id": "$cctv_id"},
+					"pipeline": bson.A{
+						bson.M{"$match": bson.M{
+							"to":    "offline",
+							"$expr": bson.M{"$eq": bson.A{"$cctv_id", "$$cctv_id"}},
+						}},
+						bson.M{"$sort": bson.M{"changed_at": -1}},
+						bson.M{"$limit": 1},
+					},
+					"as": "last_offline",
+				}},
+				bson.M{"$addFields": bson.M{
+					"offline_since": bson.M{"$ifNull": bson.A{
+						bson.M{"$arrayElemAt": bson.A{"$last_offline.changed_at", 0}},
+						"$updated_at",
+					}},
+				}},
+				bson.M{"$sort": bson.M{"offline_since": 1}},
+				bson.M{"$limit": listSize},
+				bson.M{"$project": bson.M{
+					"cctv_id":       1,
+					"name":          1,
+					"contact_id":    1,
+					"site_id":       1,
+					"offline_since": 1,
+				}},
+			},
+			"recently_added": bson.A{
+				bson.M{"$sort": bson.M{"created_at": -1}},
+				bson.M{"$limit": listSize},
+				bson.M{"$project": bson.M{
+					"cctv_id":    1,
+					"name":       1,
+					"contact_id": 1,
+					"site_id":    1,
+					"status":     1,
+					"created_at": 1,
+				}},
+			},
+		}}},
+	)
+
+	cur, err := CctvCollection().Aggregate(uc.Ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var facets []struct {
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+		ByStatus       []StatusCount  `bson:"by_status"`
+		ByBrand        []BrandCount   `bson:"by_brand"`
+		BySite         []SiteCount    `bson:"by_site"`
+		ByContact      []ContactCount `bson:"by_contact"`
+		OfflineLongest []OfflineCctv  `bson:"offline_longest"`
+		RecentlyAdded  []RecentCctv   `bson:"recently_added"`
+	}
+	if err := cur.All(uc.Ctx, &facets); err != nil {
+		return nil, err
+	}
+
+	data := Summary{
+		ByStatus:       []StatusCount{},
+		ByBrand:        []BrandCount{},
+		BySite:         []SiteCount{},
+		ByContact:      []ContactCount{},
+		OfflineLongest: []OfflineCctv{},
+		RecentlyAdded:  []RecentCctv{},
+		GeneratedAt:    time.Now(),
+	}
+	if len(facets) == 0 {
+		return &data, nil
+	}
+
+	f := facets[0]
+	if len(f.Total) > 0 {
+		data.Total = f.Total[0].Count
+	}
+	if f.ByStatus != nil {
+		data.ByStatus = f.ByStatus
+	}
+	if f.ByBrand != nil {
+		data.ByBrand = f.ByBrand
+	}
+	if f.BySite != nil {
+		data.BySite = f.BySite
+	}
+	if f.ByContact != nil {
+		data.ByContact = f.ByContact
+	}
+	if f.OfflineLongest != nil {
+		data.OfflineLongest = f.OfflineLongest
+	}
+	if f.RecentlyAdded != nil {
+		data.RecentlyAdded = f.RecentlyAdded
+	}
+	return &data, nil
+}
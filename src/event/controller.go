@@ -0,0 +1,199 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ModuleName = "Event"
+
+// max request body of webhook, 1 MB
+const maxWebhookBody = 1 << 20
+
+func GetHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+
+		if limit < 1 {
+			limit = 50
+		}
+		if limit > 500 {
+			limit = 500
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		filter := Filter{
+			Types:      queryList(c, "type"),
+			Severities: queryList(c, "severity"),
+			CctvIDs:    queryList(c, "cctv_id"),
+			SiteIDs:    queryList(c, "site_id"),
+			Cursor:     c.Query("cursor"),
+		}
+		for key, dst := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+			v := c.Query(key)
+			if v == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + key + ", must be RFC3339 time"})
+				return
+			}
+			*dst = &t
+		}
+
+		uc := UsecaseHandler{
+			Ctx:    ctx,
+			Limit:  limit,
+			Filter: filter,
+		}
+
+		datas, err := uc.Get()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:  http.StatusText(http.StatusOK),
+			Message: "Successfully get all " + ModuleName,
+			Data:    datas,
+			Pagination: utils.Pagination{
+				Limit:      int(limit),
+				HasNext:    uc.NextCursor != "",
+				HasPrev:    filter.Cursor != "",
+				NextCursor: uc.NextCursor,
+			},
+		}
+		c.JSON(http.StatusOK, resp.BuildResponse())
+	}
+}
+
+func GetByIDHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		data, err := uc.GetByID(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    "Successfully get " + ModuleName,
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// IngestHandler accept a JSON array of events, or {"events": [...]}
+func IngestHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		params := []Event{}
+		if err := json.Unmarshal(body, &params); err != nil {
+			var wrapped struct {
+				Events []Event `json:"events"`
+			}
+			if err := json.Unmarshal(body, &wrapped); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			params = wrapped.Events
+		}
+
+		data, err := uc.Ingest(params, "api")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    ModuleName + " ingested successfully",
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// WebhookHandler accept vendor payload, see webhookAdapters for supported vendor
+func WebhookHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vendor := c.Param("vendor")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		data, err := uc.Webhook(vendor, body, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    ModuleName + " ingested successfully",
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// queryList accept repeated param or comma separated value
+func queryList(c *gin.Context, key string) []string {
+	res := []string{}
+	for _, v := range c.QueryArray(key) {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				res = append(res, p)
+			}
+		}
+	}
+	return res
+}
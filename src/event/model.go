@@ -0,0 +1,75 @@
+package event
+
+import (
+	"context"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// camera or recorder analytics event
+type Event struct {
+	ID          primitive.ObjectID     `bson:"_id,omitempty"`
+	EventID     string                 `json:"event_id"            bson:"event_id,omitempty"`
+	CctvID      string                 `json:"cctv_id"             validate:"required" bson:"cctv_id,omitempty"`
+	SiteID      *string                `json:"site_id"             bson:"site_id,omitempty"`
+	RecorderID  *string                `json:"recorder_id"         bson:"recorder_id,omitempty"`
+	Type        string                 `json:"type"                validate:"required,oneof=motion tamper line_crossing intrusion video_loss other" bson:"type,omitempty"`
+	Severity    string                 `json:"severity"            validate:"omitempty,oneof=info low medium high critical" bson:"severity,omitempty"`
+	Description *string                `json:"description"         bson:"description,omitempty"`
+	SnapshotID  *string                `json:"snapshot_id"         bson:"snapshot_id,omitempty"`
+	Source      string                 `json:"source"              bson:"source,omitempty"`
+	Payload     map[string]interface{} `json:"payload,omitempty"   bson:"payload,omitempty"`
+	Suppressed  bool                   `json:"suppressed"          bson:"suppressed"` // happened during maintenance window, no alert
+	OccurredAt  time.Time              `json:"occurred_at"         validate:"required" bson:"occurred_at,omitempty"`
+	ReceivedAt  time.Time              `json:"received_at"         bson:"received_at,omitempty"`
+
+	// webhook ip address not resolved to a cctv, reported instead of the cctv id error
+	resolveErr error
+}
+
+// result of one item in a batch
+type IngestError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type IngestResult struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	EventIDs []string      `json:"event_ids"`
+	Errors   []IngestError `json:"errors"`
+}
+
+// default severity when not sent by the device
+var DefaultSeverity = map[string]string{
+	"motion":        "low",
+	"line_crossing": "medium",
+	"intrusion":     "high",
+	"tamper":        "high",
+	"video_loss":    "high",
+	"other":         "info",
+}
+
+// max events in one batch
+const MaxBatchSize = 500
+
+func Collection() *mongo.Collection {
+	return database.OpenCollection("events")
+}
+
+func CctvCollection() *mongo.Collection {
+	return database.OpenCollection("cctvs")
+}
+
+func EnsureIndexes(ctx context.Context) error {
+	_, err := Collection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "occurred_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "cctv_id", Value: 1}, {Key: "occurred_at", Value: -1}}},
+		{Keys: bson.D{{Key: "site_id", Value: 1}, {Key: "occurred_at", Value: -1}}},
+	})
+	return err
+}
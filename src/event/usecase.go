@@ -0,0 +1,351 @@
+package event
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/src/cctv"
+	"github.com/maulanar/gin-kecilin/src/maintenance"
+	"github.com/maulanar/gin-kecilin/src/notification"
+	"github.com/maulanar/gin-kecilin/src/snapshot"
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// adjustable depending on usecase
+type UsecaseHandler struct {
+	Ctx        context.Context
+	Limit      int64
+	Filter     Filter
+	NextCursor string
+}
+
+type Filter struct {
+	From       *time.Time
+	To         *time.Time
+	Types      []string
+	Severities []string
+	CctvIDs    []string
+	SiteIDs    []string
+	Cursor     string
+}
+
+var valildator = validator.New()
+
+// Get search events, newest first, with cursor pagination
+func (uc *UsecaseHandler) Get() ([]Event, error) {
+	if uc.Limit < 1 {
+		uc.Limit = 50
+	}
+
+	filter := bson.M{}
+	occurred := bson.M{}
+	if uc.Filter.From != nil {
+		occurred["$gte"] = *uc.Filter.From
+	}
+	if uc.Filter.To != nil {
+		occurred["$lte"] = *uc.Filter.To
+	}
+	if len(occurred) > 0 {
+		filter["occurred_at"] = occurred
+	}
+	if len(uc.Filter.Types) > 0 {
+		filter["type"] = bson.M{"$in": uc.Filter.Types}
+	}
+	if len(uc.Filter.Severities) > 0 {
+		filter["severity"] = bson.M{"$in": uc.Filter.Severities}
+	}
+	if len(uc.Filter.CctvIDs) > 0 {
+		filter["cctv_id"] = bson.M{"$in": uc.Filter.CctvIDs}
+	}
+	if len(uc.Filter.SiteIDs) > 0 {
+		filter["site_id"] = bson.M{"$in": uc.Filter.SiteIDs}
+	}
+
+	// continue after the last event of previous page
+	if uc.Filter.Cursor != "" {
+		at, id, err := decodeCursor(uc.Filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter["$or"] = bson.A{
+			bson.M{"occurred_at": bson.M{"$lt": at}},
+			bson.M{"occurred_at": at, "_id": bson.M{"$lt": id}},
+		}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "occurred_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(uc.Limit + 1)
+
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	datas := []Event{}
+	if err := cur.All(uc.Ctx, &datas); err != nil {
+		return nil, err
+	}
+
+	// one extra row tell there is next page
+	uc.NextCursor = ""
+	if int64(len(datas)) > uc.Limit {
+		datas = datas[:uc.Limit]
+		last := datas[len(datas)-1]
+		uc.NextCursor = encodeCursor(last.OccurredAt, last.ID)
+	}
+
+	return datas, nil
+}
+
+func (uc *UsecaseHandler) GetByID(id string) (*Event, error) {
+	var data Event
+	err := Collection().FindOne(uc.Ctx, bson.M{"event_id": id}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + ModuleName + " with id " + id + " is not found")
+		}
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// Ingest validate and store a batch, invalid item is reported and skipped
+func (uc *UsecaseHandler) Ingest(params []Event, source string) (*IngestResult, error) {
+	if len(params) == 0 {
+		return nil, errors.New("Events is empty")
+	}
+	if len(params) > MaxBatchSize {
+		return nil, errors.New("Too many events, max " + strconv.Itoa(MaxBatchSize) + " per batch")
+	}
+
+	// get the cctvs of the batch at once
+	cctvIDs := []string{}
+	for _, v := range params {
+		cctvIDs = append(cctvIDs, v.CctvID)
+	}
+	cctvs, err := uc.getCctvs(bson.M{"cctv_id": bson.M{"$in": cctvIDs}})
+	if err != nil {
+		return nil, err
+	}
+
+	res := IngestResult{
+		EventIDs: []string{},
+		Errors:   []IngestError{},
+	}
+	docs := []interface{}{}
+	indexes := []int{} // index in params of each doc
+	now := time.Now()
+	for k := range params {
+		v := &params[k]
+		if err := uc.prepare(v, cctvs, source, now); err != nil {
+			res.Errors = append(res.Errors, IngestError{Index: k, Error: err.Error()})
+			continue
+		}
+		docs = append(docs, v)
+		indexes = append(indexes, k)
+	}
+
+	// unordered insert keep going after a failed document, the failed ones are reported per item
+	failed := map[int]bool{}
+	if len(docs) > 0 {
+		_, err = Collection().InsertMany(uc.Ctx, docs, options.InsertMany().SetOrdered(false))
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil && len(bulkErr.WriteErrors) > 0 {
+			for _, we := range bulkErr.WriteErrors {
+				failed[we.Index] = true
+				res.Errors = append(res.Errors, IngestError{Index: indexes[we.Index], Error: we.Message})
+			}
+			sort.Slice(res.Errors, func(i, j int) bool { return res.Errors[i].Index < res.Errors[j].Index })
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	// escalate event matching the escalation policy, failure does not reject the event
+	notificationUC := notification.UsecaseHandler{
+		Ctx: uc.Ctx,
+	}
+	for k, doc := range docs {
+		if failed[k] {
+			continue
+		}
+		v := doc.(*Event)
+		res.EventIDs = append(res.EventIDs, v.EventID)
+		if v.Suppressed {
+			continue
+		}
+		err := notificationUC.Start(&notification.Trigger{
+			CctvID:      v.CctvID,
+			SiteID:      v.SiteID,
+			EventID:     v.EventID,
+			EventType:   v.Type,
+			Severity:    v.Severity,
+			Description: v.Description,
+			OccurredAt:  v.OccurredAt,
+		})
+		if err != nil {
+			log.Printf("Escalate event %s: %v", v.EventID, err)
+		}
+	}
+
+	res.Accepted = len(res.EventIDs)
+	res.Rejected = len(res.Errors)
+	return &res, nil
+}
+
+func (uc *UsecaseHandler) prepare(v *Event, cctvs map[string]cctvRef, source string, now time.Time) error {
+	if v.resolveErr != nil {
+		return v.resolveErr
+	}
+	if err := valildator.Struct(v); err != nil {
+		return err
+	}
+
+	ref, ok := cctvs[v.CctvID]
+	if !ok {
+		return errors.New("CCTV with id " + v.CctvID + " is not found")
+	}
+
+	// snapshot must belong to the cctv
+	if v.SnapshotID != nil && *v.SnapshotID != "" {
+		snapshotUC := snapshot.UsecaseHandler{
+			Ctx: uc.Ctx,
+		}
+		if _, err := snapshotUC.GetByID(v.CctvID, *v.SnapshotID); err != nil {
+			return err
+		}
+	}
+
+	if v.Severity == "" {
+		v.Severity = DefaultSeverity[v.Type]
+	}
+	if v.OccurredAt.After(now.Add(5 * time.Minute)) {
+		return errors.New("Occurred at is in the future")
+	}
+
+	// event during maintenance window or from inactive cctv is kept but not alerted
+	suppressed := slices.Contains(cctv.InactiveStatuses, ref.Status)
+	if !suppressed {
+		var err error
+		suppressed, err = maintenance.IsUnderMaintenance(uc.Ctx, v.CctvID, ref.SiteID, v.OccurredAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	v.ID = primitive.NewObjectID()
+	v.EventID = v.ID.Hex()
+	v.Suppressed = suppressed
+	v.SiteID = ref.SiteID
+	v.RecorderID = ref.RecorderID
+	v.Source = source
+	v.ReceivedAt = now
+	return nil
+}
+
+type cctvRef struct {
+	CctvID     string  `bson:"cctv_id"`
+	IPAddress  *string `bson:"ip_address"`
+	Channel    *int    `bson:"channel"`
+	SiteID     *string `bson:"site_id"`
+	RecorderID *string `bson:"recorder_id"`
+	Status     string  `bson:"status"`
+}
+
+func (uc *UsecaseHandler) getCctvs(filter bson.M) (map[string]cctvRef, error) {
+	opts := options.Find().SetProjection(bson.M{
+		"cctv_id":     1,
+		"ip_address":  1,
+		"channel":     1,
+		"site_id":     1,
+		"recorder_id": 1,
+		"status":      1,
+	})
+	cur, err := CctvCollection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var refs []cctvRef
+	if err := cur.All(uc.Ctx, &refs); err != nil {
+		return nil, err
+	}
+
+	res := map[string]cctvRef{}
+	for _, v := range refs {
+		res[v.CctvID] = v
+	}
+	return res, nil
+}
+
+// resolveCctvID find cctv by ip address & channel, for vendor payload without cctv id.
+// Ip address is compared in canonical form as stored on cctv.
+// Standalone camera has no channel, so channel 1 also match camera without channel
+func (uc *UsecaseHandler) resolveCctvID(ip string, channel *int) (string, error) {
+	ip, err := utils.NormalizeIP(ip)
+	if err != nil {
+		return "", err
+	}
+	refs, err := uc.getCctvs(bson.M{"ip_address": ip})
+	if err != nil {
+		return "", err
+	}
+
+	var fallback string
+	for _, v := range refs {
+		if channel != nil && v.Channel != nil && *v.Channel == *channel {
+			return v.CctvID, nil
+		}
+		if v.Channel == nil && (channel == nil || *channel == 1) {
+			fallback = v.CctvID
+		}
+	}
+	if fallback != "" {
+		return fallback, nil
+	}
+	return "", errors.New("CCTV with ip address " + ip + " is not found")
+}
+
+func encodeCursor(at time.Time, id primitive.ObjectID) string {
+	raw := strconv.FormatInt(at.UnixMilli(), 10) + ":" + id.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, primitive.ObjectID, error) {
+	invalid := errors.New("Invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, invalid
+	}
+	ms, hex, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, primitive.NilObjectID, invalid
+	}
+	msInt, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, invalid
+	}
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, invalid
+	}
+	return time.UnixMilli(msInt), id, nil
+}
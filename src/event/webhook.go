@@ -0,0 +1,200 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vendor payload converted to event, cctv is resolved later by ip address & channel
+type webhookEvent struct {
+	Event     Event
+	IPAddress string
+	Channel   *int
+}
+
+// adapter convert vendor payload to events, remoteIP is used when payload has no ip address
+type webhookAdapter func(body []byte, remoteIP string) ([]webhookEvent, error)
+
+var webhookAdapters = map[string]webhookAdapter{
+	"generic":   genericAdapter,
+	"hikvision": hikvisionAdapter,
+	"dahua":     dahuaAdapter,
+}
+
+// Webhook convert vendor payload and ingest it
+func (uc *UsecaseHandler) Webhook(vendor string, body []byte, remoteIP string) (*IngestResult, error) {
+	adapter, ok := webhookAdapters[vendor]
+	if !ok {
+		return nil, errors.New("Unsupported webhook vendor " + vendor)
+	}
+
+	items, err := adapter(body, remoteIP)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]Event, 0, len(items))
+	for _, v := range items {
+		if v.Event.CctvID == "" && v.IPAddress != "" {
+			// invalid or unknown ip address is reported by ingest
+			v.Event.CctvID, v.Event.resolveErr = uc.resolveCctvID(v.IPAddress, v.Channel)
+		}
+		params = append(params, v.Event)
+	}
+
+	return uc.Ingest(params, "webhook:"+vendor)
+}
+
+// genericAdapter accept one event or list of event with our own field name,
+// ip_address & channel can be used instead of cctv_id
+func genericAdapter(body []byte, remoteIP string) ([]webhookEvent, error) {
+	type item struct {
+		Event
+		IPAddress string `json:"ip_address"`
+		Channel   *int   `json:"channel"`
+	}
+
+	var items []item
+	if err := json.Unmarshal(body, &items); err != nil {
+		var one item
+		if err := json.Unmarshal(body, &one); err != nil {
+			return nil, errors.New("Invalid generic payload: " + err.Error())
+		}
+		items = []item{one}
+	}
+
+	res := []webhookEvent{}
+	for _, v := range items {
+		res = append(res, webhookEvent{Event: v.Event, IPAddress: v.IPAddress, Channel: v.Channel})
+	}
+	return res, nil
+}
+
+var hikvisionTypes = map[string]string{
+	"vmd":             "motion",
+	"motion":          "motion",
+	"linedetection":   "line_crossing",
+	"fielddetection":  "intrusion",
+	"regionentrance":  "intrusion",
+	"tamperdetection": "tamper",
+	"shelteralarm":    "tamper",
+	"videoloss":       "video_loss",
+}
+
+// hikvisionAdapter accept ISAPI EventNotificationAlert in JSON format
+func hikvisionAdapter(body []byte, remoteIP string) ([]webhookEvent, error) {
+	var p struct {
+		IPAddress        string          `json:"ipAddress"`
+		ChannelID        json.RawMessage `json:"channelID"`
+		DateTime         string          `json:"dateTime"`
+		EventType        string          `json:"eventType"`
+		EventState       string          `json:"eventState"`
+		EventDescription string          `json:"eventDescription"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, errors.New("Invalid hikvision payload: " + err.Error())
+	}
+
+	// inactive is the end of an alarm, only the start is recorded
+	if strings.EqualFold(p.EventState, "inactive") {
+		return []webhookEvent{}, nil
+	}
+
+	ev := webhookEvent{
+		IPAddress: p.IPAddress,
+		Channel:   parseChannel(p.ChannelID),
+	}
+	if ev.IPAddress == "" {
+		ev.IPAddress = remoteIP
+	}
+	ev.Event.Type = mapType(hikvisionTypes, p.EventType)
+	ev.Event.OccurredAt = parseTime(p.DateTime)
+	if p.EventDescription != "" {
+		ev.Event.Description = &p.EventDescription
+	}
+	ev.Event.Payload = rawPayload(body)
+
+	return []webhookEvent{ev}, nil
+}
+
+var dahuaTypes = map[string]string{
+	"videomotion":          "motion",
+	"crosslinedetection":   "line_crossing",
+	"crossregiondetection": "intrusion",
+	"videoblind":           "tamper",
+	"videoloss":            "video_loss",
+}
+
+// dahuaAdapter accept event manager push in JSON format, channel index start from 0
+func dahuaAdapter(body []byte, remoteIP string) ([]webhookEvent, error) {
+	var p struct {
+		Code       string `json:"Code"`
+		Action     string `json:"Action"`
+		Index      *int   `json:"Index"`
+		IPAddress  string `json:"IPAddress"`
+		LocaleTime string `json:"LocaleTime"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, errors.New("Invalid dahua payload: " + err.Error())
+	}
+
+	if strings.EqualFold(p.Action, "Stop") {
+		return []webhookEvent{}, nil
+	}
+
+	ev := webhookEvent{
+		IPAddress: p.IPAddress,
+	}
+	if ev.IPAddress == "" {
+		ev.IPAddress = remoteIP
+	}
+	if p.Index != nil {
+		channel := *p.Index + 1
+		ev.Channel = &channel
+	}
+	ev.Event.Type = mapType(dahuaTypes, p.Code)
+	ev.Event.OccurredAt = parseTime(p.LocaleTime)
+	ev.Event.Payload = rawPayload(body)
+
+	return []webhookEvent{ev}, nil
+}
+
+func mapType(types map[string]string, vendorType string) string {
+	if v, ok := types[strings.ToLower(vendorType)]; ok {
+		return v
+	}
+	return "other"
+}
+
+// parseTime accept RFC3339 and common device format, fallback to now
+func parseTime(v string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
+
+func parseChannel(raw json.RawMessage) *int {
+	var n int
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return &n
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if n, err := strconv.Atoi(s); err == nil {
+			return &n
+		}
+	}
+	return nil
+}
+
+func rawPayload(body []byte) map[string]interface{} {
+	var res map[string]interface{}
+	_ = json.Unmarshal(body, &res)
+	return res
+}
@@ -0,0 +1,117 @@
+package maintenance
+
+import (
+	"context"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	WindowScheduled = "scheduled"
+	WindowActive    = "active"
+	WindowCompleted = "completed"
+	WindowCancelled = "cancelled"
+)
+
+// scheduled maintenance for one cctv or every cctv in a site
+type Window struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	WindowID   string             `json:"window_id"           bson:"window_id,omitempty"`
+	CctvID     *string            `json:"cctv_id"             bson:"cctv_id,omitempty"`
+	SiteID     *string            `json:"site_id"             bson:"site_id,omitempty"`
+	StartAt    time.Time          `json:"start_at"            validate:"required" bson:"start_at,omitempty"`
+	EndAt      time.Time          `json:"end_at"              validate:"required,gtfield=StartAt" bson:"end_at,omitempty"`
+	Technician *string            `json:"technician"          bson:"technician,omitempty"`
+	Notes      *string            `json:"notes"               bson:"notes,omitempty"`
+	State      string             `json:"state"               bson:"state,omitempty"`
+	Affected   []AffectedCctv     `json:"affected"            bson:"affected"`
+	CreatedAt  time.Time          `json:"created_at"          bson:"created_at,omitempty"`
+	UpdatedAt  time.Time          `json:"updated_at"          bson:"updated_at,omitempty"`
+}
+
+// cctv put into maintenance by the window, and the status to restore afterwards
+type AffectedCctv struct {
+	CctvID         string `json:"cctv_id"             bson:"cctv_id"`
+	PreviousStatus string `json:"previous_status"     bson:"previous_status"`
+}
+
+const (
+	WorkOrderOpen       = "open"
+	WorkOrderInProgress = "in_progress"
+	WorkOrderCompleted  = "completed"
+	WorkOrderCancelled  = "cancelled"
+)
+
+type WorkOrder struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	WorkOrderID     string             `json:"work_order_id"       bson:"work_order_id,omitempty"`
+	CctvID          string             `json:"cctv_id"             validate:"required" bson:"cctv_id,omitempty"`
+	WindowID        *string            `json:"window_id"           bson:"window_id,omitempty"`
+	Title           string             `json:"title"               validate:"required,min=2,max=200" bson:"title,omitempty"`
+	Description     *string            `json:"description"         bson:"description,omitempty"`
+	Technician      *string            `json:"technician"          bson:"technician,omitempty"`
+	Status          string             `json:"status"              validate:"omitempty,oneof=open in_progress completed cancelled" bson:"status,omitempty"`
+	ScheduledAt     *time.Time         `json:"scheduled_at"        bson:"scheduled_at,omitempty"`
+	CompletedAt     *time.Time         `json:"completed_at"        bson:"completed_at,omitempty"`
+	CompletionNotes *string            `json:"completion_notes"    bson:"completion_notes,omitempty"`
+	History         []WorkOrderLog     `json:"history"             bson:"history,omitempty"`
+	CreatedAt       time.Time          `json:"created_at"          bson:"created_at,omitempty"`
+	UpdatedAt       time.Time          `json:"updated_at"          bson:"updated_at,omitempty"`
+}
+
+type WorkOrderLog struct {
+	Status string    `json:"status"              bson:"status"`
+	Notes  *string   `json:"notes"               bson:"notes,omitempty"`
+	By     string    `json:"by"                  bson:"by,omitempty"`
+	At     time.Time `json:"at"                  bson:"at"`
+}
+
+// whitelist field can be sorted
+var AllowedSortFields = map[string]bool{
+	"cctv_id":    true,
+	"site_id":    true,
+	"start_at":   true,
+	"end_at":     true,
+	"state":      true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// whitelist field can be sorted
+var WorkOrderAllowedSortFields = map[string]bool{
+	"cctv_id":      true,
+	"status":       true,
+	"scheduled_at": true,
+	"completed_at": true,
+	"created_at":   true,
+	"updated_at":   true,
+}
+
+func Collection() *mongo.Collection {
+	return database.OpenCollection("maintenance_windows")
+}
+
+func WorkOrderCollection() *mongo.Collection {
+	return database.OpenCollection("work_orders")
+}
+
+func EnsureIndexes(ctx context.Context) error {
+	_, err := Collection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "state", Value: 1}, {Key: "start_at", Value: 1}}},
+		{Keys: bson.D{{Key: "cctv_id", Value: 1}, {Key: "start_at", Value: -1}}},
+		{Keys: bson.D{{Key: "site_id", Value: 1}, {Key: "start_at", Value: -1}}},
+		{Keys: bson.D{{Key: "affected.cctv_id", Value: 1}, {Key: "state", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = WorkOrderCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "cctv_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
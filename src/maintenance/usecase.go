@@ -0,0 +1,458 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/src/cctv"
+	"github.com/maulanar/gin-kecilin/src/site"
+	"github.com/maulanar/gin-kecilin/src/statushistory"
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// cctv status used during the window
+const maintenanceStatus = "maintenance"
+
+// adjustable depending on usecase
+type UsecaseHandler struct {
+	Ctx           context.Context
+	Page          int64
+	Limit         int64
+	TotalData     int64
+	FilterAndSort utils.HelperUsecaseHandler
+	Actor         string // email of the user doing the change
+}
+
+var valildator = validator.New()
+
+func (uc *UsecaseHandler) Get() ([]Window, error) {
+	if uc.Page < 1 {
+		uc.Page = 1
+	}
+	if uc.Limit < 1 {
+		uc.Limit = 10
+	}
+
+	filter := uc.FilterAndSort.SetFilter() // dynamic filter by query param
+	sort := uc.FilterAndSort.SetSort()     // dynamic sort by query param
+	skip := (uc.Page - 1) * uc.Limit       // offset
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "start_at", Value: -1}}
+	}
+	opts := options.Find().
+		SetSort(sort).
+		SetSkip(skip).
+		SetLimit(uc.Limit)
+
+	// total docs
+	total, err := Collection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var datas []Window
+	if err := cur.All(uc.Ctx, &datas); err != nil {
+		return nil, err
+	}
+
+	totalPages := int64(math.Ceil(float64(total) / float64(uc.Limit)))
+	if totalPages > 0 && uc.Page > totalPages {
+		datas = []Window{}
+	}
+
+	uc.TotalData = total
+	return datas, nil
+}
+
+func (uc *UsecaseHandler) Create(param *Window) error {
+	// validate input
+	if err := uc.validate(param); err != nil {
+		return err
+	}
+	if !param.EndAt.After(time.Now()) {
+		return errors.New("End at must be in the future")
+	}
+
+	param.ID = primitive.NewObjectID()
+	param.WindowID = param.ID.Hex()
+	param.State = WindowScheduled
+	param.Affected = []AffectedCctv{}
+	param.CreatedAt = time.Now()
+	param.UpdatedAt = time.Now()
+
+	_, err := Collection().InsertOne(uc.Ctx, param)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (uc *UsecaseHandler) GetByID(id string) (*Window, error) {
+	var data Window
+	err := Collection().FindOne(uc.Ctx, bson.M{"window_id": id}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + ModuleName + " with id " + id + " is not found")
+		}
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (uc *UsecaseHandler) UpdateByID(id string, param *Window) error {
+	// validate id exists
+	oldData, err := uc.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if oldData.State != WindowScheduled {
+		return errors.New("Only scheduled " + ModuleName + " can be updated")
+	}
+
+	// validate input
+	if err := uc.validate(param); err != nil {
+		return err
+	}
+
+	param.ID = oldData.ID
+	param.WindowID = oldData.WindowID
+	param.State = oldData.State
+	param.Affected = oldData.Affected
+	param.CreatedAt = oldData.CreatedAt
+	param.UpdatedAt = time.Now()
+
+	filter := bson.M{"window_id": id, "state": WindowScheduled}
+	update := bson.M{"$set": param}
+	_, err = Collection().UpdateOne(uc.Ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (uc *UsecaseHandler) DeleteByID(id string) error {
+	// validate id exists
+	data, err := uc.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if data.State == WindowActive {
+		return errors.New("Active " + ModuleName + " cannot be deleted, cancel it first")
+	}
+
+	filter := bson.M{"window_id": id}
+	_, err = Collection().DeleteOne(uc.Ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Cancel stop the window, cctv in an active window is restored immediately
+func (uc *UsecaseHandler) Cancel(id string) (*Window, error) {
+	data, err := uc.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch data.State {
+	case WindowScheduled:
+	case WindowActive:
+		if err := uc.restore(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New(ModuleName + " is already " + data.State)
+	}
+
+	data.State = WindowCancelled
+	data.UpdatedAt = time.Now()
+	_, err = Collection().UpdateOne(uc.Ctx,
+		bson.M{"window_id": id},
+		bson.M{"$set": bson.M{"state": data.State, "updated_at": data.UpdatedAt}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Run activate windows which started and complete windows which ended
+func (uc *UsecaseHandler) Run(now time.Time) error {
+	// started
+	starting, err := uc.find(bson.M{
+		"state":    WindowScheduled,
+		"start_at": bson.M{"$lte": now},
+		"end_at":   bson.M{"$gt": now},
+	})
+	if err != nil {
+		return err
+	}
+	// failing window is retried next run, it must not block the others
+	for k := range starting {
+		if err := uc.activate(&starting[k]); err != nil {
+			log.Printf("Activate maintenance window %s: %v", starting[k].WindowID, err)
+		}
+	}
+
+	// ended, including scheduled window missed entirely
+	ending, err := uc.find(bson.M{
+		"state":  bson.M{"$in": bson.A{WindowScheduled, WindowActive}},
+		"end_at": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return err
+	}
+	for k := range ending {
+		w := &ending[k]
+		if w.State == WindowActive {
+			if err := uc.restore(w); err != nil {
+				log.Printf("Restore maintenance window %s: %v", w.WindowID, err)
+				continue
+			}
+		}
+		_, err = Collection().UpdateOne(uc.Ctx,
+			bson.M{"window_id": w.WindowID},
+			bson.M{"$set": bson.M{"state": WindowCompleted, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			log.Printf("Complete maintenance window %s: %v", w.WindowID, err)
+		}
+	}
+
+	return nil
+}
+
+// IsUnderMaintenance tell the cctv or its site is in a maintenance window at the given time,
+// used to suppress alert
+func IsUnderMaintenance(ctx context.Context, cctvID string, siteID *string, at time.Time) (bool, error) {
+	target := bson.A{bson.M{"cctv_id": cctvID}}
+	if siteID != nil && *siteID != "" {
+		target = append(target, bson.M{"site_id": *siteID})
+	}
+
+	count, err := Collection().CountDocuments(ctx, bson.M{
+		"$or":      target,
+		"state":    bson.M{"$ne": WindowCancelled},
+		"start_at": bson.M{"$lte": at},
+		"end_at":   bson.M{"$gt": at},
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetWindowsFor return not cancelled windows of the cctv or its site overlapping the range
+func GetWindowsFor(ctx context.Context, cctvID string, siteID *string, from, to time.Time) ([]Window, error) {
+	target := bson.A{bson.M{"cctv_id": cctvID}}
+	if siteID != nil && *siteID != "" {
+		target = append(target, bson.M{"site_id": *siteID})
+	}
+
+	uc := UsecaseHandler{
+		Ctx: ctx,
+	}
+	return uc.find(bson.M{
+		"$or":      target,
+		"state":    bson.M{"$ne": WindowCancelled},
+		"start_at": bson.M{"$lt": to},
+		"end_at":   bson.M{"$gt": from},
+	})
+}
+
+func (uc *UsecaseHandler) find(filter bson.M) ([]Window, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "start_at", Value: 1}})
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	datas := []Window{}
+	if err := cur.All(uc.Ctx, &datas); err != nil {
+		return nil, err
+	}
+	return datas, nil
+}
+
+// activate put the cctvs into maintenance and remember their status
+func (uc *UsecaseHandler) activate(w *Window) error {
+	filter := bson.M{}
+	if w.CctvID != nil {
+		filter["cctv_id"] = *w.CctvID
+	} else {
+		filter["site_id"] = *w.SiteID
+	}
+
+	// not installed or decommissioned cctv is left as is
+	filter["status"] = bson.M{"$nin": cctv.InactiveStatuses}
+
+	opts := options.Find().SetProjection(bson.M{"cctv_id": 1, "status": 1})
+	cur, err := cctv.Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	var cctvs []cctv.Cctv
+	if err := cur.All(uc.Ctx, &cctvs); err != nil {
+		return err
+	}
+
+	affected := []AffectedCctv{}
+	for _, v := range cctvs {
+		previous := v.Status
+		if previous == maintenanceStatus {
+			previous, err = uc.previousStatus(v.CctvID, w.WindowID)
+			if err != nil {
+				return err
+			}
+		}
+
+		// cctv which cannot move to maintenance is left out, the others still start
+		if err := uc.setCctvStatus(v.CctvID, v.Status, maintenanceStatus); err != nil {
+			log.Printf("Maintenance window %s, cctv %s: %v", w.WindowID, v.CctvID, err)
+			continue
+		}
+		affected = append(affected, AffectedCctv{CctvID: v.CctvID, PreviousStatus: previous})
+	}
+
+	w.State = WindowActive
+	w.Affected = affected
+	_, err = Collection().UpdateOne(uc.Ctx,
+		bson.M{"window_id": w.WindowID},
+		bson.M{"$set": bson.M{"state": w.State, "affected": w.Affected, "updated_at": time.Now()}},
+	)
+	return err
+}
+
+// restore put the cctvs back to their previous status,
+// cctv still covered by another active window is restored when that window end
+func (uc *UsecaseHandler) restore(w *Window) error {
+	for _, v := range w.Affected {
+		count, err := Collection().CountDocuments(uc.Ctx, bson.M{
+			"window_id":        bson.M{"$ne": w.WindowID},
+			"state":            WindowActive,
+			"affected.cctv_id": v.CctvID,
+		})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		// status changed by hand during the window is kept
+		if err := uc.setCctvStatus(v.CctvID, maintenanceStatus, v.PreviousStatus); err != nil {
+			log.Printf("Maintenance window %s, cctv %s: %v", w.WindowID, v.CctvID, err)
+		}
+	}
+	return nil
+}
+
+// previousStatus of cctv already in maintenance, taken from the overlapping active window
+func (uc *UsecaseHandler) previousStatus(cctvID, windowID string) (string, error) {
+	windows, err := uc.find(bson.M{
+		"window_id":        bson.M{"$ne": windowID},
+		"state":            WindowActive,
+		"affected.cctv_id": cctvID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, w := range windows {
+		for _, v := range w.Affected {
+			if v.CctvID == cctvID {
+				return v.PreviousStatus, nil
+			}
+		}
+	}
+
+	// set to maintenance by hand, keep it
+	return maintenanceStatus, nil
+}
+
+// setCctvStatus update cctv status when current status is still "from",
+// status changed meanwhile by someone else or cctv deleted during the window is kept as is
+func (uc *UsecaseHandler) setCctvStatus(cctvID, from, to string) error {
+	cctvUc := cctv.UsecaseHandler{Ctx: uc.Ctx}
+	_, err := cctvUc.ChangeStatus(cctvID, &cctv.StatusChange{
+		Status: to,
+		Source: statushistory.SourceMaintenance,
+		By:     uc.Actor,
+		From:   from,
+	})
+	if errors.Is(err, cctv.ErrStatusMismatch) || errors.Is(err, cctv.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (uc *UsecaseHandler) validate(param *Window) error {
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+
+	hasCctv := param.CctvID != nil && *param.CctvID != ""
+	hasSite := param.SiteID != nil && *param.SiteID != ""
+	if hasCctv == hasSite {
+		return errors.New("Either cctv_id or site_id must be set")
+	}
+
+	if hasCctv {
+		cctvUC := cctv.UsecaseHandler{
+			Ctx: uc.Ctx,
+		}
+		_, err := cctvUC.GetByID(*param.CctvID)
+		return err
+	}
+
+	siteUC := site.UsecaseHandler{
+		Ctx: uc.Ctx,
+	}
+	_, err := siteUC.GetByID(*param.SiteID)
+	return err
+}
+
+// RunScheduler check maintenance windows every minute. Block until ctx is done
+func RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		uc := UsecaseHandler{
+			Ctx: runCtx,
+		}
+		if err := uc.Run(time.Now()); err != nil {
+			log.Printf("Maintenance scheduler: %v", err)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package maintenance
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/src/cctv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (uc *UsecaseHandler) GetWorkOrders() ([]WorkOrder, error) {
+	if uc.Page < 1 {
+		uc.Page = 1
+	}
+	if uc.Limit < 1 {
+		uc.Limit = 10
+	}
+
+	filter := uc.FilterAndSort.SetFilter() // dynamic filter by query param
+	sort := uc.FilterAndSort.SetSort()     // dynamic sort by query param
+	skip := (uc.Page - 1) * uc.Limit       // offset
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "created_at", Value: -1}}
+	}
+	opts := options.Find().
+		SetSort(sort).
+		SetSkip(skip).
+		SetLimit(uc.Limit)
+
+	// total docs
+	total, err := WorkOrderCollection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := WorkOrderCollection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var datas []WorkOrder
+	if err := cur.All(uc.Ctx, &datas); err != nil {
+		return nil, err
+	}
+
+	totalPages := int64(math.Ceil(float64(total) / float64(uc.Limit)))
+	if totalPages > 0 && uc.Page > totalPages {
+		datas = []WorkOrder{}
+	}
+
+	uc.TotalData = total
+	return datas, nil
+}
+
+func (uc *UsecaseHandler) CreateWorkOrder(param *WorkOrder) error {
+	// validate input
+	if err := uc.validateWorkOrder(param); err != nil {
+		return err
+	}
+	if param.Status == "" {
+		param.Status = WorkOrderOpen
+	}
+	if param.Status == WorkOrderCompleted {
+		return errors.New("Use complete endpoint to complete " + WorkOrderModuleName)
+	}
+
+	param.ID = primitive.NewObjectID()
+	param.WorkOrderID = param.ID.Hex()
+	param.CompletedAt = nil
+	param.CompletionNotes = nil
+	param.History = []WorkOrderLog{{Status: param.Status, By: uc.Actor, At: time.Now()}}
+	param.CreatedAt = time.Now()
+	param.UpdatedAt = time.Now()
+
+	_, err := WorkOrderCollection().InsertOne(uc.Ctx, param)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (uc *UsecaseHandler) GetWorkOrderByID(id string) (*WorkOrder, error) {
+	var data WorkOrder
+	err := WorkOrderCollection().FindOne(uc.Ctx, bson.M{"work_order_id": id}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + WorkOrderModuleName + " with id " + id + " is not found")
+		}
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (uc *UsecaseHandler) UpdateWorkOrderByID(id string, param *WorkOrder) error {
+	// validate id exists
+	oldData, err := uc.GetWorkOrderByID(id)
+	if err != nil {
+		return err
+	}
+	if oldData.Status == WorkOrderCompleted || oldData.Status == WorkOrderCancelled {
+		return errors.New(WorkOrderModuleName + " is already " + oldData.Status)
+	}
+
+	// validate input
+	if err := uc.validateWorkOrder(param); err != nil {
+		return err
+	}
+	if param.Status == "" {
+		param.Status = oldData.Status
+	}
+	if param.Status == WorkOrderCompleted {
+		return errors.New("Use complete endpoint to complete " + WorkOrderModuleName)
+	}
+
+	param.ID = oldData.ID
+	param.WorkOrderID = oldData.WorkOrderID
+	param.CompletedAt = nil
+	param.CompletionNotes = nil
+	param.History = oldData.History
+	param.CreatedAt = oldData.CreatedAt
+	param.UpdatedAt = time.Now()
+
+	// keep status history
+	if param.Status != oldData.Status {
+		param.History = append(param.History, WorkOrderLog{Status: param.Status, By: uc.Actor, At: time.Now()})
+	}
+
+	filter := bson.M{"work_order_id": id}
+	update := bson.M{"$set": param}
+	_, err = WorkOrderCollection().UpdateOne(uc.Ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CompleteWorkOrder close the work order with completion notes
+func (uc *UsecaseHandler) CompleteWorkOrder(id string, notes string) (*WorkOrder, error) {
+	data, err := uc.GetWorkOrderByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if data.Status == WorkOrderCompleted || data.Status == WorkOrderCancelled {
+		return nil, errors.New(WorkOrderModuleName + " is already " + data.Status)
+	}
+	if notes == "" {
+		return nil, errors.New("Completion notes is required")
+	}
+
+	now := time.Now()
+	data.Status = WorkOrderCompleted
+	data.CompletedAt = &now
+	data.CompletionNotes = &notes
+	data.History = append(data.History, WorkOrderLog{Status: data.Status, Notes: &notes, By: uc.Actor, At: now})
+	data.UpdatedAt = now
+
+	_, err = WorkOrderCollection().UpdateOne(uc.Ctx,
+		bson.M{"work_order_id": id},
+		bson.M{"$set": data},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (uc *UsecaseHandler) DeleteWorkOrderByID(id string) error {
+	// validate id exists
+	_, err := uc.GetWorkOrderByID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"work_order_id": id}
+	_, err = WorkOrderCollection().DeleteOne(uc.Ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (uc *UsecaseHandler) validateWorkOrder(param *WorkOrder) error {
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+
+	// validate cctv id is valid
+	cctvUC := cctv.UsecaseHandler{
+		Ctx: uc.Ctx,
+	}
+	if _, err := cctvUC.GetByID(param.CctvID); err != nil {
+		return err
+	}
+
+	// validate window id is valid
+	if param.WindowID != nil && *param.WindowID != "" {
+		if _, err := uc.GetByID(*param.WindowID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package notification
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/maulanar/gin-kecilin/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// data of the acknowledge page
+type ackPage struct {
+	Alert *Alert
+	Token string // set when the alert can still be acknowledged by the form
+	Done  bool
+	Error string
+}
+
+var ackPageTemplate = template.Must(template.New("ack").Funcs(template.FuncMap{
+	"action": func() string { return strings.TrimRight(config.PUBLIC_URL, "/") + "/api/alerts/ack" },
+	"label":  func(v string) string { return strings.ReplaceAll(v, "_", " ") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Alert</title>
+</head>
+<body style="font-family: sans-serif; max-width: 32em; margin: 2em auto; padding: 0 1em">
+{{if .Error}}
+<h1>Alert</h1>
+<p>{{.Error}}</p>
+{{else}}
+<h1>{{label .Alert.EventType}} on {{if .Alert.CctvName}}{{.Alert.CctvName}}{{else}}{{.Alert.CctvID}}{{end}}</h1>
+<p>Severity: {{.Alert.Severity}}<br>Occurred at: {{.Alert.OccurredAt.Format "2006-01-02 15:04 MST"}}<br>Status: {{.Alert.Status}}</p>
+{{if .Alert.Description}}<p>{{.Alert.Description}}</p>{{end}}
+{{if .Done}}
+<p>Alert is acknowledged, escalation is stopped.</p>
+{{else if eq .Alert.Status "open"}}
+<form method="post" action="{{action}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Acknowledge</button>
+</form>
+{{else}}
+<p>Alert is already {{.Alert.Status}}.</p>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// renderAckPage write the page, the token in the form must not be cached nor sent as referrer
+func renderAckPage(c *gin.Context, status int, page ackPage) {
+	var buf bytes.Buffer
+	if err := ackPageTemplate.Execute(&buf, page); err != nil {
+		log.Printf("Render acknowledge page: %v", err)
+		c.String(http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,147 @@
+package notification
+
+import (
+	"context"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// escalation policy of a cctv or a site, cctv policy win over the policy of its site
+type Policy struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	PolicyID    string             `json:"policy_id"             bson:"policy_id,omitempty"`
+	CctvID      *string            `json:"cctv_id,omitempty"     bson:"cctv_id,omitempty"`
+	SiteID      *string            `json:"site_id,omitempty"     bson:"site_id,omitempty"`
+	MinSeverity string             `json:"min_severity"          validate:"omitempty,oneof=info low medium high critical" bson:"min_severity,omitempty"` // high when empty
+	EventTypes  []string           `json:"event_types,omitempty" validate:"omitempty,dive,oneof=motion tamper line_crossing intrusion video_loss other" bson:"event_types,omitempty"`
+	Steps       []Step             `json:"steps"                 validate:"required,min=1,max=10,dive" bson:"steps"`
+	CreatedAt   time.Time          `json:"created_at"            bson:"created_at,omitempty"`
+	UpdatedAt   time.Time          `json:"updated_at"            bson:"updated_at,omitempty"`
+}
+
+// one step of the escalation, notify a contact or every cctv contact of a role
+type Step struct {
+	ContactID   string `json:"contact_id,omitempty"  validate:"required_without=Role" bson:"contact_id,omitempty"`
+	Role        string `json:"role,omitempty"        validate:"omitempty,oneof=owner technical emergency" bson:"role,omitempty"`
+	WaitMinutes int    `json:"wait_minutes"          validate:"min=0,max=1440" bson:"wait_minutes"` // wait for acknowledgement before this step, ignored on the first step
+}
+
+// status of alert
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+)
+
+// event escalated by a policy, notified step by step until acknowledged
+type Alert struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	AlertID        string             `json:"alert_id"                  bson:"alert_id,omitempty"`
+	PolicyID       string             `json:"policy_id"                 bson:"policy_id"`
+	CctvID         string             `json:"cctv_id"                   bson:"cctv_id"`
+	CctvName       string             `json:"cctv_name"                 bson:"cctv_name"`
+	SiteID         *string            `json:"site_id"                   bson:"site_id,omitempty"`
+	EventID        string             `json:"event_id"                  bson:"event_id"`
+	EventType      string             `json:"event_type"                bson:"event_type"`
+	Severity       string             `json:"severity"                  bson:"severity"`
+	Description    *string            `json:"description"               bson:"description,omitempty"`
+	EventCount     int                `json:"event_count"               bson:"event_count"` // same event type of the cctv while the alert is open
+	Status         string             `json:"status"                    bson:"status"`
+	Step           int                `json:"step"                      bson:"step"`      // steps already notified
+	Exhausted      bool               `json:"exhausted"                 bson:"exhausted"` // every step notified without acknowledgement
+	AckToken       string             `json:"-"                         bson:"ack_token"`
+	AcknowledgedAt *time.Time         `json:"acknowledged_at,omitempty" bson:"acknowledged_at,omitempty"`
+	AcknowledgedBy *string            `json:"acknowledged_by,omitempty" bson:"acknowledged_by,omitempty"`
+	Notifications  []Notification     `json:"notifications"             bson:"notifications"`
+	OccurredAt     time.Time          `json:"occurred_at"               bson:"occurred_at"`
+	LastOccurredAt time.Time          `json:"last_occurred_at"          bson:"last_occurred_at"`
+	CreatedAt      time.Time          `json:"created_at"                bson:"created_at,omitempty"`
+	UpdatedAt      time.Time          `json:"updated_at"                bson:"updated_at,omitempty"`
+}
+
+// status of one notification attempt
+const (
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+	NotificationSkipped = "skipped"
+)
+
+type Notification struct {
+	Step      int       `json:"step"                bson:"step"`
+	ContactID string    `json:"contact_id"          bson:"contact_id"`
+	Channel   string    `json:"channel,omitempty"   bson:"channel,omitempty"`
+	Status    string    `json:"status"              bson:"status"`
+	Error     *string   `json:"error,omitempty"     bson:"error,omitempty"`
+	At        time.Time `json:"at"                  bson:"at"`
+}
+
+// status of job
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// persisted job of the escalation queue, run one escalation step of an alert
+type Job struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	AlertID     string             `bson:"alert_id"`
+	Step        int                `bson:"step"`
+	Status      string             `bson:"status"`
+	RunAt       time.Time          `bson:"run_at"`
+	LockedUntil *time.Time         `bson:"locked_until,omitempty"` // running job which lock expired is taken again, e.g. after restart
+	Attempts    int                `bson:"attempts"`
+	LastError   *string            `bson:"last_error,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at"`
+}
+
+// whitelist field can be sorted
+var AllowedSortFields = map[string]bool{
+	"created_at":       true,
+	"last_occurred_at": true,
+	"severity":         true,
+	"status":           true,
+}
+
+func PolicyCollection() *mongo.Collection {
+	return database.OpenCollection("escalation_policies")
+}
+
+func AlertCollection() *mongo.Collection {
+	return database.OpenCollection("alerts")
+}
+
+func JobCollection() *mongo.Collection {
+	return database.OpenCollection("notification_jobs")
+}
+
+func EnsureIndexes(ctx context.Context) error {
+	_, err := PolicyCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "cctv_id", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "site_id", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = AlertCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "cctv_id", Value: 1}, {Key: "event_type", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "ack_token", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = JobCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "run_at", Value: 1}}},
+		{Keys: bson.D{{Key: "alert_id", Value: 1}, {Key: "step", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	return err
+}
@@ -0,0 +1,186 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/config"
+	"github.com/maulanar/gin-kecilin/src/contact"
+)
+
+// message sent to a contact, already in the contact language
+type Message struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	AckURL  string `json:"ack_url"`
+}
+
+// sender deliver the message to the contact on one channel
+type sender func(ctx context.Context, c *contact.Contact, alert *Alert, msg *Message) error
+
+var senders = map[string]sender{
+	contact.ChannelEmail:    sendEmail,
+	contact.ChannelSMS:      gatewaySender(contact.ChannelSMS),
+	contact.ChannelWhatsApp: gatewaySender(contact.ChannelWhatsApp),
+	contact.ChannelWebhook:  sendWebhook,
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// notify try the contact channels in order until one succeeds, every attempt is returned.
+// Contact in quiet hours is skipped unless the alert is critical
+func notify(ctx context.Context, c *contact.Contact, alert *Alert, step int, now time.Time) []Notification {
+	if alert.Severity != "critical" && c.InQuietHours(now) {
+		reason := "quiet hours"
+		return []Notification{{Step: step, ContactID: c.ContactID, Status: NotificationSkipped, Error: &reason, At: now}}
+	}
+
+	msg := buildMessage(c, alert)
+	res := []Notification{}
+	for _, channel := range c.NotificationChannels() {
+		n := Notification{Step: step, ContactID: c.ContactID, Channel: channel, Status: NotificationSent, At: time.Now()}
+		if err := senders[channel](ctx, c, alert, msg); err != nil {
+			reason := err.Error()
+			n.Status = NotificationFailed
+			n.Error = &reason
+		}
+		res = append(res, n)
+		if n.Status == NotificationSent {
+			break
+		}
+	}
+	return res
+}
+
+// text of the message per language
+var messageTemplates = map[string]struct{ subject, text string }{
+	"en": {
+		subject: "[%s] %s on camera %s",
+		text:    "%s event on camera %s at %s.%s\nAcknowledge: %s",
+	},
+	"id": {
+		subject: "[%s] %s pada kamera %s",
+		text:    "Event %s pada kamera %s pukul %s.%s\nKonfirmasi: %s",
+	},
+}
+
+func buildMessage(c *contact.Contact, alert *Alert) *Message {
+	tpl, ok := messageTemplates[c.NotificationLanguage()]
+	if !ok {
+		tpl = messageTemplates["en"]
+	}
+	name := alert.CctvName
+	if name == "" {
+		name = alert.CctvID
+	}
+	eventType := strings.ReplaceAll(alert.EventType, "_", " ")
+	at := alert.OccurredAt.In(c.Location()).Format("2006-01-02 15:04 MST")
+	description := ""
+	if alert.Description != nil && *alert.Description != "" {
+		description = " " + *alert.Description
+	}
+	ackURL := strings.TrimRight(config.PUBLIC_URL, "/") + "/api/alerts/ack/" + alert.AckToken
+
+	return &Message{
+		Subject: fmt.Sprintf(tpl.subject, strings.ToUpper(alert.Severity), eventType, name),
+		Text:    fmt.Sprintf(tpl.text, eventType, name, at, description, ackURL),
+		AckURL:  ackURL,
+	}
+}
+
+func sendEmail(ctx context.Context, c *contact.Contact, alert *Alert, msg *Message) error {
+	if c.Email == nil || *c.Email == "" {
+		return errors.New("Contact has no email")
+	}
+	return SendEmail(*c.Email, msg.Subject, msg.Text)
+}
+
+// SendEmail send plain text email through the configured smtp
+func SendEmail(to, subject, text string) error {
+	if config.SMTP_HOST == "" {
+		return errors.New("SMTP is not configured")
+	}
+
+	body := "From: " + config.SMTP_FROM + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + strings.NewReplacer("\r", " ", "\n", " ").Replace(subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + strings.ReplaceAll(text, "\n", "\r\n")
+
+	var auth smtp.Auth
+	if config.SMTP_USERNAME != "" {
+		auth = smtp.PlainAuth("", config.SMTP_USERNAME, config.SMTP_PASSWORD, config.SMTP_HOST)
+	}
+	return smtp.SendMail(config.SMTP_HOST+":"+config.SMTP_PORT, auth, config.SMTP_FROM, []string{to}, []byte(body))
+}
+
+// gatewaySender post sms or whatsapp message to the http gateway
+func gatewaySender(channel string) sender {
+	return func(ctx context.Context, c *contact.Contact, alert *Alert, msg *Message) error {
+		if config.NOTIFY_GATEWAY_URL == "" {
+			return errors.New("Notification gateway is not configured")
+		}
+		if c.Phone == nil || *c.Phone == "" {
+			return errors.New("Contact has no phone")
+		}
+		to := *c.Phone
+		if c.PhoneE164 != nil {
+			to = *c.PhoneE164
+		}
+		return postJSON(ctx, config.NOTIFY_GATEWAY_URL, config.NOTIFY_GATEWAY_TOKEN, map[string]string{
+			"channel": channel,
+			"to":      to,
+			"text":    msg.Subject + "\n" + msg.Text,
+		})
+	}
+}
+
+// sendWebhook post the alert to the contact own webhook
+func sendWebhook(ctx context.Context, c *contact.Contact, alert *Alert, msg *Message) error {
+	if c.Notification == nil || c.Notification.WebhookURL == nil {
+		return errors.New("Contact has no webhook url")
+	}
+	return postJSON(ctx, *c.Notification.WebhookURL, "", map[string]interface{}{
+		"alert_id":    alert.AlertID,
+		"cctv_id":     alert.CctvID,
+		"cctv_name":   alert.CctvName,
+		"event_id":    alert.EventID,
+		"event_type":  alert.EventType,
+		"severity":    alert.Severity,
+		"occurred_at": alert.OccurredAt,
+		"message":     msg,
+	})
+}
+
+func postJSON(ctx context.Context, url, token string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("Notification endpoint responded " + resp.Status)
+	}
+	return nil
+}
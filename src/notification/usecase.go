@@ -0,0 +1,384 @@
+package notification
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// adjustable depending on usecase
+type UsecaseHandler struct {
+	Ctx           context.Context
+	Page          int64
+	Limit         int64
+	TotalData     int64
+	FilterAndSort utils.HelperUsecaseHandler
+}
+
+// owner of an escalation policy
+const (
+	ScopeCctv = "cctv"
+	ScopeSite = "site"
+)
+
+// event which start an escalation
+type Trigger struct {
+	CctvID      string
+	SiteID      *string
+	EventID     string
+	EventType   string
+	Severity    string
+	Description *string
+	OccurredAt  time.Time
+}
+
+var valildator = validator.New()
+
+var severityRank = map[string]int{
+	"info":     0,
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// scopeField field of the policy and the collection it point to
+func scopeField(scope string) (string, string, error) {
+	switch scope {
+	case ScopeCctv:
+		return "cctv_id", "cctvs", nil
+	case ScopeSite:
+		return "site_id", "sites", nil
+	}
+	return "", "", errors.New("Unknown escalation scope " + scope)
+}
+
+func (uc *UsecaseHandler) GetPolicy(scope, id string) (*Policy, error) {
+	field, _, err := scopeField(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	var data Policy
+	err = PolicyCollection().FindOne(uc.Ctx, bson.M{field: id}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + PolicyModuleName + " of " + scope + " " + id + " is not found")
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+// SavePolicy create or replace the escalation policy of a cctv or a site
+func (uc *UsecaseHandler) SavePolicy(scope, id string, param *Policy) error {
+	field, collection, err := scopeField(scope)
+	if err != nil {
+		return err
+	}
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+	for _, v := range param.Steps {
+		if v.ContactID != "" && v.Role != "" {
+			return errors.New("Escalation step must notify a contact or a role, not both")
+		}
+	}
+
+	// validate the cctv or site exists
+	count, err := database.OpenCollection(collection).CountDocuments(uc.Ctx, bson.M{field: id})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("Data " + scope + " with id " + id + " is not found")
+	}
+
+	// validate every contact of the steps exists
+	for _, v := range param.Steps {
+		if v.ContactID == "" {
+			continue
+		}
+		count, err := database.OpenCollection("contacts").CountDocuments(uc.Ctx, bson.M{"contact_id": v.ContactID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New("Data Contact with id " + v.ContactID + " is not found")
+		}
+	}
+
+	now := time.Now()
+	param.CctvID, param.SiteID = nil, nil
+	if scope == ScopeCctv {
+		param.CctvID = &id
+	} else {
+		param.SiteID = &id
+	}
+	param.UpdatedAt = now
+
+	old, err := uc.GetPolicy(scope, id)
+	if err == nil {
+		param.ID = old.ID
+		param.PolicyID = old.PolicyID
+		param.CreatedAt = old.CreatedAt
+	} else {
+		param.ID = primitive.NewObjectID()
+		param.PolicyID = param.ID.Hex()
+		param.CreatedAt = now
+	}
+
+	_, err = PolicyCollection().ReplaceOne(uc.Ctx, bson.M{field: id}, param, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (uc *UsecaseHandler) DeletePolicy(scope, id string) error {
+	data, err := uc.GetPolicy(scope, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = PolicyCollection().DeleteOne(uc.Ctx, bson.M{"policy_id": data.PolicyID})
+	return err
+}
+
+// Start open an alert when the event match the policy of its cctv or site, and queue the first step.
+// Event of the same type on a cctv with an open alert is counted on that alert
+func (uc *UsecaseHandler) Start(t *Trigger) error {
+	policy, err := uc.findPolicy(t.CctvID, t.SiteID)
+	if err != nil || policy == nil {
+		return err
+	}
+	if !policy.Match(t.EventType, t.Severity) {
+		return nil
+	}
+
+	now := time.Now()
+	res, err := AlertCollection().UpdateOne(uc.Ctx,
+		bson.M{"cctv_id": t.CctvID, "event_type": t.EventType, "status": AlertOpen},
+		bson.M{
+			"$inc": bson.M{"event_count": 1},
+			"$max": bson.M{"last_occurred_at": t.OccurredAt},
+			"$set": bson.M{"updated_at": now},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+
+	var cctv struct {
+		Name string `bson:"name"`
+	}
+	err = database.OpenCollection("cctvs").FindOne(uc.Ctx, bson.M{"cctv_id": t.CctvID},
+		options.FindOne().SetProjection(bson.M{"name": 1})).Decode(&cctv)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	alert := Alert{
+		ID:             primitive.NewObjectID(),
+		PolicyID:       policy.PolicyID,
+		CctvID:         t.CctvID,
+		CctvName:       cctv.Name,
+		SiteID:         t.SiteID,
+		EventID:        t.EventID,
+		EventType:      t.EventType,
+		Severity:       t.Severity,
+		Description:    t.Description,
+		EventCount:     1,
+		Status:         AlertOpen,
+		AckToken:       hex.EncodeToString(token),
+		Notifications:  []Notification{},
+		OccurredAt:     t.OccurredAt,
+		LastOccurredAt: t.OccurredAt,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	alert.AlertID = alert.ID.Hex()
+	if _, err := AlertCollection().InsertOne(uc.Ctx, alert); err != nil {
+		return err
+	}
+
+	return enqueue(uc.Ctx, alert.AlertID, 0, now)
+}
+
+// Match tell whether the event type & severity should be escalated
+func (p *Policy) Match(eventType, severity string) bool {
+	min := p.MinSeverity
+	if min == "" {
+		min = "high"
+	}
+	if severityRank[severity] < severityRank[min] {
+		return false
+	}
+	if len(p.EventTypes) == 0 {
+		return true
+	}
+	for _, v := range p.EventTypes {
+		if v == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// findPolicy policy of the cctv, or of its site when the cctv has none
+func (uc *UsecaseHandler) findPolicy(cctvID string, siteID *string) (*Policy, error) {
+	filters := []bson.M{{"cctv_id": cctvID}}
+	if siteID != nil && *siteID != "" {
+		filters = append(filters, bson.M{"site_id": *siteID})
+	}
+	for _, filter := range filters {
+		var data Policy
+		err := PolicyCollection().FindOne(uc.Ctx, filter).Decode(&data)
+		if err == nil {
+			return &data, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (uc *UsecaseHandler) GetAlerts() ([]Alert, error) {
+	if uc.Page < 1 {
+		uc.Page = 1
+	}
+	if uc.Limit < 1 {
+		uc.Limit = 10
+	}
+
+	filter := uc.FilterAndSort.SetFilter() // dynamic filter by query param
+	sort := uc.FilterAndSort.SetSort()     // dynamic sort by query param
+	skip := (uc.Page - 1) * uc.Limit       // offset
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "created_at", Value: -1}}
+	}
+	opts := options.Find().
+		SetSort(sort).
+		SetSkip(skip).
+		SetLimit(uc.Limit)
+
+	// total docs
+	total, err := AlertCollection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := AlertCollection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	datas := []Alert{}
+	if err := cur.All(uc.Ctx, &datas); err != nil {
+		return nil, err
+	}
+
+	totalPages := int64(math.Ceil(float64(total) / float64(uc.Limit)))
+	if totalPages > 0 && uc.Page > totalPages {
+		datas = []Alert{}
+	}
+
+	uc.TotalData = total
+	return datas, nil
+}
+
+func (uc *UsecaseHandler) GetAlertByID(id string) (*Alert, error) {
+	var data Alert
+	err := AlertCollection().FindOne(uc.Ctx, bson.M{"alert_id": id}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + ModuleName + " with id " + id + " is not found")
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+// Acknowledge stop the escalation of an open alert
+func (uc *UsecaseHandler) Acknowledge(id, by string) (*Alert, error) {
+	return uc.acknowledge(bson.M{"alert_id": id}, by)
+}
+
+// GetAlertByToken alert of the link sent in the notification, without acknowledging it
+func (uc *UsecaseHandler) GetAlertByToken(token string) (*Alert, error) {
+	if token == "" {
+		return nil, errors.New("Invalid acknowledge token")
+	}
+	var data Alert
+	if err := AlertCollection().FindOne(uc.Ctx, bson.M{"ack_token": token}).Decode(&data); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + ModuleName + " is not found")
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+// AcknowledgeToken acknowledge from the link sent in the notification
+func (uc *UsecaseHandler) AcknowledgeToken(token string) (*Alert, error) {
+	if token == "" {
+		return nil, errors.New("Invalid acknowledge token")
+	}
+	return uc.acknowledge(bson.M{"ack_token": token}, "link")
+}
+
+func (uc *UsecaseHandler) acknowledge(filter bson.M, by string) (*Alert, error) {
+	var data Alert
+	if err := AlertCollection().FindOne(uc.Ctx, filter).Decode(&data); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + ModuleName + " is not found")
+		}
+		return nil, err
+	}
+	if data.Status != AlertOpen {
+		return &data, nil
+	}
+
+	now := time.Now()
+	_, err := AlertCollection().UpdateOne(uc.Ctx,
+		bson.M{"alert_id": data.AlertID, "status": AlertOpen},
+		bson.M{"$set": bson.M{
+			"status":          AlertAcknowledged,
+			"acknowledged_at": now,
+			"acknowledged_by": by,
+			"updated_at":      now,
+		}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// next steps are not needed anymore
+	_, err = JobCollection().UpdateMany(uc.Ctx,
+		bson.M{"alert_id": data.AlertID, "status": JobPending},
+		bson.M{"$set": bson.M{"status": JobCancelled, "updated_at": now}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return uc.GetAlertByID(data.AlertID)
+}
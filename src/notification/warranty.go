@@ -0,0 +1,216 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/config"
+	"github.com/maulanar/gin-kecilin/src/cctv"
+	"github.com/maulanar/gin-kecilin/src/contact"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// result of one warranty reminder run
+type WarrantyReminder struct {
+	CctvCount     int `json:"cctv_count"`     // cctv with warranty expiring, not reminded yet
+	ReminderCount int `json:"reminder_count"` // contact reminded
+	FailedCount   int `json:"failed_count"`   // contact skipped or failed, retried on the next run
+}
+
+// text of the warranty reminder per language, one line per camera
+var warrantyTemplates = map[string]struct{ subject, text, line string }{
+	"en": {
+		subject: "Camera warranty expiring",
+		text:    "Hello %s,\n\nThe warranty of these cameras expires soon:\n%s",
+		line:    "- %s, warranty until %s",
+	},
+	"id": {
+		subject: "Garansi kamera akan berakhir",
+		text:    "Halo %s,\n\nGaransi kamera berikut akan segera berakhir:\n%s",
+		line:    "- %s, garansi sampai %s",
+	},
+}
+
+// RunWarrantyScheduler remind contacts of expiring warranty once a day at WARRANTY_REMINDER_HOUR.
+// Block until ctx is done
+func RunWarrantyScheduler(ctx context.Context) {
+	if config.WARRANTY_REMINDER_DAYS <= 0 {
+		log.Println("Warranty reminder is disabled")
+		return
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(nextReminderAt(time.Now(), config.WARRANTY_REMINDER_HOUR)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		runCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+		uc := UsecaseHandler{
+			Ctx: runCtx,
+		}
+		res, err := uc.RemindWarranties(time.Now(), config.WARRANTY_REMINDER_DAYS)
+		cancel()
+		if err != nil {
+			log.Printf("Warranty reminder: %v", err)
+			continue
+		}
+		log.Printf("Warranty reminder: %d cctv, %d contact reminded, %d failed", res.CctvCount, res.ReminderCount, res.FailedCount)
+	}
+}
+
+// next time at the hour of day after now
+func nextReminderAt(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// RemindWarranties remind the owner & technical contacts of every cctv whose warranty expire within days.
+// A cctv is reminded once per warranty expiry, when at least one of its contacts got the reminder
+func (uc *UsecaseHandler) RemindWarranties(now time.Time, days int) (*WarrantyReminder, error) {
+	from := now.Format("2006-01-02")
+	to := now.AddDate(0, 0, days).Format("2006-01-02")
+
+	cur, err := cctv.Collection().Find(uc.Ctx, bson.M{
+		"warranty_expiry": bson.M{"$gte": from, "$lte": to},
+		"status":          bson.M{"$ne": cctv.StatusDecommissioned},
+		"$expr":           bson.M{"$ne": bson.A{"$warranty_reminded_for", "$warranty_expiry"}},
+	}, options.Find().
+		SetProjection(bson.M{"cctv_id": 1, "name": 1, "contact_id": 1, "contacts": 1, "warranty_expiry": 1}).
+		SetSort(bson.D{{Key: "warranty_expiry", Value: 1}, {Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var cctvs []cctv.Cctv
+	if err := cur.All(uc.Ctx, &cctvs); err != nil {
+		return nil, err
+	}
+
+	res := WarrantyReminder{CctvCount: len(cctvs)}
+	if len(cctvs) == 0 {
+		return &res, nil
+	}
+
+	// cameras of every contact, owner and technical contacts are reminded
+	byContact := map[string][]*cctv.Cctv{}
+	ids := []string{}
+	for k := range cctvs {
+		v := &cctvs[k]
+		seen := map[string]bool{}
+		add := func(id string) {
+			if id == "" || seen[id] {
+				return
+			}
+			seen[id] = true
+			if _, ok := byContact[id]; !ok {
+				ids = append(ids, id)
+			}
+			byContact[id] = append(byContact[id], v)
+		}
+		add(v.ContactID)
+		for _, link := range v.Contacts {
+			if link.Role == contact.RoleOwner || link.Role == contact.RoleTechnical {
+				add(link.ContactID)
+			}
+		}
+	}
+
+	cur, err = contact.Collection().Find(uc.Ctx, bson.M{"contact_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var contacts []contact.Contact
+	if err := cur.All(uc.Ctx, &contacts); err != nil {
+		return nil, err
+	}
+
+	reminded := map[string]bool{}
+	for k := range contacts {
+		c := &contacts[k]
+		list := byContact[c.ContactID]
+		if err := uc.remindWarranty(c, list, now); err != nil {
+			log.Printf("Warranty reminder to contact %s: %v", c.ContactID, err)
+			res.FailedCount++
+			continue
+		}
+		res.ReminderCount++
+		for _, v := range list {
+			reminded[v.CctvID] = true
+		}
+	}
+
+	for _, v := range cctvs {
+		if !reminded[v.CctvID] {
+			continue
+		}
+		// expiry may be changed during the run
+		_, err := cctv.Collection().UpdateOne(uc.Ctx,
+			bson.M{"cctv_id": v.CctvID, "warranty_expiry": v.WarrantyExpiry},
+			bson.M{"$set": bson.M{"warranty_reminded_for": v.WarrantyExpiry}},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &res, nil
+}
+
+// remindWarranty send the reminder on the contact channels in order until one succeeds, quiet hours is respected
+func (uc *UsecaseHandler) remindWarranty(c *contact.Contact, cctvs []*cctv.Cctv, now time.Time) error {
+	if c.InQuietHours(now) {
+		return errors.New("quiet hours")
+	}
+
+	tpl, ok := warrantyTemplates[c.NotificationLanguage()]
+	if !ok {
+		tpl = warrantyTemplates["en"]
+	}
+	name := ""
+	if c.FirstName != nil {
+		name = *c.FirstName
+	}
+	lines := []string{}
+	items := []map[string]string{}
+	for _, v := range cctvs {
+		lines = append(lines, fmt.Sprintf(tpl.line, v.Name, *v.WarrantyExpiry))
+		items = append(items, map[string]string{"cctv_id": v.CctvID, "name": v.Name, "warranty_expiry": *v.WarrantyExpiry})
+	}
+	msg := &Message{
+		Subject: tpl.subject,
+		Text:    fmt.Sprintf(tpl.text, name, strings.Join(lines, "\n")),
+	}
+
+	var err error
+	for _, channel := range c.NotificationChannels() {
+		if channel == contact.ChannelWebhook {
+			if c.Notification == nil || c.Notification.WebhookURL == nil {
+				err = errors.New("Contact has no webhook url")
+				continue
+			}
+			err = postJSON(uc.Ctx, *c.Notification.WebhookURL, "", map[string]interface{}{
+				"type":    "warranty_expiring",
+				"cctvs":   items,
+				"message": msg,
+			})
+		} else {
+			// email & gateway sender only use the message
+			err = senders[channel](uc.Ctx, c, nil, msg)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
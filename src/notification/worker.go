@@ -0,0 +1,232 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/src/contact"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	jobLease       = 2 * time.Minute // running job is taken again after the lease, e.g. the api restarted
+	maxJobAttempts = 5
+	maxJobsPerRun  = 100
+)
+
+// enqueue add the job of an escalation step, a step is queued only once
+func enqueue(ctx context.Context, alertID string, step int, runAt time.Time) error {
+	now := time.Now()
+	_, err := JobCollection().InsertOne(ctx, Job{
+		AlertID:   alertID,
+		Step:      step,
+		Status:    JobPending,
+		RunAt:     runAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// RunWorker run due jobs of the escalation queue every 10 seconds until ctx is done
+func RunWorker(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		for i := 0; i < maxJobsPerRun; i++ {
+			runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			uc := UsecaseHandler{
+				Ctx: runCtx,
+			}
+			ran, err := uc.RunNextJob(time.Now())
+			cancel()
+			if err != nil {
+				log.Printf("Notification worker: %v", err)
+			}
+			if !ran {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunNextJob take one due job and run it, false when there is no due job
+func (uc *UsecaseHandler) RunNextJob(now time.Time) (bool, error) {
+	job, err := claimJob(uc.Ctx, now)
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	runErr := uc.runStep(job.AlertID, job.Step, now)
+
+	update := bson.M{"status": JobDone, "updated_at": time.Now()}
+	if runErr != nil {
+		msg := runErr.Error()
+		update["last_error"] = msg
+		if job.Attempts >= maxJobAttempts {
+			update["status"] = JobFailed
+		} else {
+			// retry after 1, 2, 4, 8 minutes
+			update["status"] = JobPending
+			update["run_at"] = now.Add(time.Minute << (job.Attempts - 1))
+		}
+	}
+	_, err = JobCollection().UpdateOne(uc.Ctx,
+		bson.M{"_id": job.ID},
+		bson.M{"$set": update, "$unset": bson.M{"locked_until": ""}},
+	)
+	if err != nil {
+		return true, err
+	}
+	if runErr != nil {
+		return true, errors.New("alert " + job.AlertID + ": " + runErr.Error())
+	}
+	return true, nil
+}
+
+// claimJob lock the oldest due job, including running job which lease expired
+func claimJob(ctx context.Context, now time.Time) (*Job, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": JobPending, "run_at": bson.M{"$lte": now}},
+		bson.M{"status": JobRunning, "locked_until": bson.M{"$lt": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{"status": JobRunning, "locked_until": now.Add(jobLease), "updated_at": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "run_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job Job
+	err := JobCollection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// runStep notify the contacts of one step, then queue the next step.
+// A step already notified, e.g. job run again after a crash, only queue the next step
+func (uc *UsecaseHandler) runStep(alertID string, step int, now time.Time) error {
+	alert, err := uc.GetAlertByID(alertID)
+	if err != nil {
+		return err
+	}
+	if alert.Status != AlertOpen {
+		return nil
+	}
+
+	var policy Policy
+	err = PolicyCollection().FindOne(uc.Ctx, bson.M{"policy_id": alert.PolicyID}).Decode(&policy)
+	if err != nil {
+		// policy removed, stop escalating
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return err
+	}
+	if step >= len(policy.Steps) {
+		_, err := AlertCollection().UpdateOne(uc.Ctx, bson.M{"alert_id": alertID},
+			bson.M{"$set": bson.M{"exhausted": true, "updated_at": now}})
+		return err
+	}
+
+	if alert.Step <= step {
+		contacts, err := uc.stepContacts(alert, &policy.Steps[step])
+		if err != nil {
+			return err
+		}
+
+		notifications := []Notification{}
+		for k := range contacts {
+			notifications = append(notifications, notify(uc.Ctx, &contacts[k], alert, step, now)...)
+		}
+
+		_, err = AlertCollection().UpdateOne(uc.Ctx,
+			bson.M{"alert_id": alertID},
+			bson.M{
+				"$push": bson.M{"notifications": bson.M{"$each": notifications}},
+				"$set": bson.M{
+					"step":       step + 1,
+					"exhausted":  step+1 >= len(policy.Steps),
+					"updated_at": now,
+				},
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if step+1 < len(policy.Steps) {
+		wait := time.Duration(policy.Steps[step+1].WaitMinutes) * time.Minute
+		return enqueue(uc.Ctx, alertID, step+1, now.Add(wait))
+	}
+	return nil
+}
+
+// stepContacts the contact of the step, or every contact of the cctv with the step role by priority
+func (uc *UsecaseHandler) stepContacts(alert *Alert, step *Step) ([]contact.Contact, error) {
+	ids := []string{}
+	if step.ContactID != "" {
+		ids = append(ids, step.ContactID)
+	} else {
+		var cctv struct {
+			Contacts []contact.CctvContact `bson:"contacts"`
+		}
+		err := contact.CctvCollection().FindOne(uc.Ctx, bson.M{"cctv_id": alert.CctvID},
+			options.FindOne().SetProjection(bson.M{"contacts": 1})).Decode(&cctv)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		// contacts of the cctv are kept sorted by role then priority
+		for _, v := range cctv.Contacts {
+			if v.Role == step.Role {
+				ids = append(ids, v.ContactID)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	cur, err := contact.Collection().Find(uc.Ctx, bson.M{"contact_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var found []contact.Contact
+	if err := cur.All(uc.Ctx, &found); err != nil {
+		return nil, err
+	}
+
+	byID := map[string]contact.Contact{}
+	for _, v := range found {
+		byID[v.ContactID] = v
+	}
+	res := []contact.Contact{}
+	for _, id := range ids {
+		if v, ok := byID[id]; ok {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
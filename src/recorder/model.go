@@ -0,0 +1,66 @@
+package recorder
+
+import (
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NVR/DVR device, cameras are attached to its channels
+type Recorder struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	RecorderID   string             `json:"recorder_id"         bson:"recorder_id,omitempty"`
+	ContactID    *string            `json:"contact_id"          bson:"contact_id,omitempty"`
+	SiteID       *string            `json:"site_id"             bson:"site_id,omitempty"`
+	Name         string             `json:"name"                validate:"required" bson:"name,omitempty"`
+	Type         string             `json:"type"                validate:"required,oneof=nvr dvr" bson:"type,omitempty"`
+	IPAddress    string             `json:"ip_address"          validate:"required" bson:"ip_address,omitempty"`
+	Port         *int               `json:"port"                validate:"omitempty,min=1,max=65535" bson:"port,omitempty"`
+	Brand        *string            `json:"brand"               bson:"brand,omitempty"`
+	Model        *string            `json:"model"               bson:"model,omitempty"`
+	ChannelCount int                `json:"channel_count"       validate:"required,min=1,max=256" bson:"channel_count,omitempty"`
+	Storage      *Storage           `json:"storage"             bson:"storage,omitempty"`
+	Status       string             `json:"status"              validate:"required,oneof=online offline maintenance" bson:"status,omitempty"`
+	CreatedAt    time.Time          `json:"created_at"          bson:"created_at,omitempty"`
+	UpdatedAt    time.Time          `json:"updated_at"          bson:"updated_at,omitempty"`
+
+	// relate to cctvs
+	Channels []RecorderCctv `json:"channels,omitempty" bson:"channels,omitempty"`
+}
+
+type Storage struct {
+	CapacityGB    float64 `json:"capacity_gb"         validate:"min=0" bson:"capacity_gb"`
+	UsedGB        float64 `json:"used_gb"             validate:"min=0" bson:"used_gb"`
+	DiskCount     int     `json:"disk_count"          validate:"min=0" bson:"disk_count"`
+	RetentionDays int     `json:"retention_days"      validate:"min=0" bson:"retention_days"`
+}
+
+type RecorderCctv struct {
+	CctvID    string  `json:"cctv_id"             bson:"cctv_id,omitempty"`
+	Name      string  `json:"name"                bson:"name,omitempty"`
+	Channel   *int    `json:"channel"             bson:"channel,omitempty"`
+	IPAddress *string `json:"ip_address"          bson:"ip_address,omitempty"`
+	Port      *int    `json:"port"                bson:"port,omitempty"`
+	Status    string  `json:"status"              bson:"status,omitempty"`
+}
+
+// whitelist field can be sorted
+var AllowedSortFields = map[string]bool{
+	"recorder_id":   true,
+	"name":          true,
+	"ip_address":    true,
+	"channel_count": true,
+	"status":        true,
+	"created_at":    true,
+	"updated_at":    true,
+}
+
+func Collection() *mongo.Collection {
+	return database.OpenCollection("recorders")
+}
+
+func CctvCollection() *mongo.Collection {
+	return database.OpenCollection("cctvs")
+}
@@ -0,0 +1,243 @@
+package recorder
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/src/contact"
+	"github.com/maulanar/gin-kecilin/src/site"
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// adjustable depending on usecase
+type UsecaseHandler struct {
+	Ctx           context.Context
+	Page          int64
+	Limit         int64
+	TotalData     int64
+	FilterAndSort utils.HelperUsecaseHandler
+}
+
+var valildator = validator.New()
+
+// StatusCascade move the channels along with the recorder status,
+// set by the cctv package which own the channel status rules
+var StatusCascade func(ctx context.Context, recorderID, from, to string) error
+
+func (uc *UsecaseHandler) Get() ([]Recorder, error) {
+	if uc.Page < 1 {
+		uc.Page = 1
+	}
+	if uc.Limit < 1 {
+		uc.Limit = 10
+	}
+
+	filter := uc.FilterAndSort.SetFilter() // dynamic filter by query param
+	sort := uc.FilterAndSort.SetSort()     // dynamic sort by query param
+	skip := (uc.Page - 1) * uc.Limit       // offset
+	opts := options.Find().
+		SetSort(sort).
+		SetSkip(skip).
+		SetLimit(uc.Limit)
+
+	// total docs
+	total, err := Collection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var datas []Recorder
+	if err := cur.All(uc.Ctx, &datas); err != nil {
+		return nil, err
+	}
+
+	totalPages := int64(math.Ceil(float64(total) / float64(uc.Limit)))
+	if totalPages > 0 && uc.Page > totalPages {
+		datas = []Recorder{}
+	}
+
+	uc.TotalData = total
+	return datas, nil
+}
+
+func (uc *UsecaseHandler) Create(param *Recorder) error {
+	// validate input
+	if err := uc.validate(param); err != nil {
+		return err
+	}
+
+	// validate ip address & port is unique
+	count, err := Collection().CountDocuments(uc.Ctx, bson.M{"ip_address": param.IPAddress, "port": param.Port})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("Duplicate Ip Address and port")
+	}
+
+	param.ID = primitive.NewObjectID()
+	param.RecorderID = param.ID.Hex()
+	param.CreatedAt = time.Now()
+	param.UpdatedAt = time.Now()
+	param.Channels = nil
+
+	_, err = Collection().InsertOne(uc.Ctx, param)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (uc *UsecaseHandler) GetByID(id string) (*Recorder, error) {
+	var data []Recorder
+
+	// get attached CCTV
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"recorder_id": id}}},
+		bson.D{{Key: "$limit", Value: 1}},
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "cctvs"},
+			{Key: "localField", Value: "recorder_id"},
+			{Key: "foreignField", Value: "recorder_id"},
+			{Key: "as", Value: "channels"},
+		}}},
+	}
+
+	cur, err := Collection().Aggregate(uc.Ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	if err := cur.All(uc.Ctx, &data); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("Data " + ModuleName + " with id " + id + " is not found")
+	}
+
+	return &data[0], nil
+}
+
+func (uc *UsecaseHandler) UpdateByID(id string, param *Recorder) error {
+	// validate id exists
+	oldData, err := uc.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	// validate input
+	if err := uc.validate(param); err != nil {
+		return err
+	}
+
+	param.ID = oldData.ID
+	param.RecorderID = oldData.RecorderID
+	param.CreatedAt = oldData.CreatedAt
+	param.UpdatedAt = time.Now()
+	param.Channels = nil
+
+	// validate ip address & port is unique
+	count, err := Collection().CountDocuments(uc.Ctx, bson.M{
+		"ip_address":  param.IPAddress,
+		"port":        param.Port,
+		"recorder_id": bson.M{"$ne": id},
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("Duplicate Ip Address and port")
+	}
+
+	// channel count cannot be lower than used channel
+	for _, v := range oldData.Channels {
+		if v.Channel != nil && *v.Channel > param.ChannelCount {
+			return errors.New("Channel count is lower than used channel by CCTV " + v.CctvID)
+		}
+	}
+
+	filter := bson.M{"recorder_id": id}
+	update := bson.M{"$set": param}
+	_, err = Collection().UpdateOne(uc.Ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	// cascade recorder status to its channels
+	if oldData.Status != param.Status && StatusCascade != nil {
+		return StatusCascade(uc.Ctx, id, oldData.Status, param.Status)
+	}
+
+	return nil
+}
+
+func (uc *UsecaseHandler) DeleteByID(id string) error {
+	// validate id exists
+	data, err := uc.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if len(data.Channels) > 0 {
+		return errors.New("Recorder still has CCTV attached, detach them first")
+	}
+
+	filter := bson.M{"recorder_id": id}
+	_, err = Collection().DeleteOne(uc.Ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (uc *UsecaseHandler) validate(param *Recorder) error {
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+
+	// canonical ip address, so the unique check and cctv inheriting it see one spelling
+	ip, err := utils.NormalizeIP(param.IPAddress)
+	if err != nil {
+		return err
+	}
+	param.IPAddress = ip
+
+	// validate contact id is valid
+	if param.ContactID != nil && *param.ContactID != "" {
+		contactUC := contact.UsecaseHandler{
+			Ctx: uc.Ctx,
+		}
+		if _, err := contactUC.GetByID(*param.ContactID); err != nil {
+			return err
+		}
+	}
+
+	// validate site id is valid
+	if param.SiteID != nil && *param.SiteID != "" {
+		siteUC := site.UsecaseHandler{
+			Ctx: uc.Ctx,
+		}
+		if _, err := siteUC.GetByID(*param.SiteID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,326 @@
+package report
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ModuleName = "Report"
+
+// AvailabilityHandler uptime report per cctv, `format=csv` for spreadsheet
+func AvailabilityHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+		defer cancel()
+
+		// default to current month until now
+		now := time.Now()
+		param := AvailabilityParam{
+			ContactID: c.Query("contact_id"),
+			SiteID:    c.Query("site_id"),
+			From:      time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()),
+			To:        now,
+		}
+		// customer only get report of their own cctvs
+		if contactID, ok := utils.CustomerContactID(c); ok {
+			param.ContactID = contactID
+		}
+		for key, dst := range map[string]*time.Time{"from": &param.From, "to": &param.To} {
+			v := c.Query(key)
+			if v == "" {
+				continue
+			}
+			t, err := parseTime(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + key + ", must be RFC3339 time or YYYY-MM-DD"})
+				return
+			}
+			*dst = t
+		}
+		// future is not reported yet
+		if param.To.After(now) {
+			param.To = now
+		}
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		data, err := uc.Availability(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if strings.EqualFold(c.Query("format"), "csv") {
+			writeAvailabilityCSV(c, data)
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    "Successfully get availability " + ModuleName,
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// FirmwareHandler cctvs with outdated firmware grouped by contact, `include_unknown=false` skip cctvs
+// without firmware version, `format=csv` for spreadsheet
+func FirmwareHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+		defer cancel()
+
+		param := FirmwareParam{
+			ContactID:      c.Query("contact_id"),
+			SiteID:         c.Query("site_id"),
+			BrandID:        c.Query("brand_id"),
+			ModelID:        c.Query("model_id"),
+			IncludeUnknown: c.DefaultQuery("include_unknown", "true") != "false",
+		}
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		data, err := uc.Firmware(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if strings.EqualFold(c.Query("format"), "csv") {
+			writeFirmwareCSV(c, data)
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    "Successfully get firmware " + ModuleName,
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// one row per cctv
+func writeFirmwareCSV(c *gin.Context, data *FirmwareReport) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="firmware_`+data.GeneratedAt.Format("20060102")+`.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	writeCSVRow(w, []string{
+		"contact_id", "contact_name", "cctv_id", "name", "site_id", "status", "brand", "model",
+		"firmware_version", "firmware_updated_at", "min_firmware_version", "recommended_firmware_version", "compliance",
+	})
+	for _, g := range data.Contacts {
+		for _, v := range g.Cctvs {
+			updatedAt := ""
+			if v.FirmwareUpdatedAt != nil {
+				updatedAt = v.FirmwareUpdatedAt.Format(time.RFC3339)
+			}
+			writeCSVRow(w, []string{
+				g.ContactID, g.Name, v.CctvID, v.Name, csvString(v.SiteID), v.Status, csvString(v.Brand), csvString(v.Model),
+				csvString(v.FirmwareVersion), updatedAt, csvString(v.MinFirmwareVersion), csvString(v.RecommendedFirmwareVersion), v.Compliance,
+			})
+		}
+	}
+	w.Flush()
+}
+
+// LifecycleHandler cctvs with warranty expiring or replacement due within `days` (default 90) grouped by contact,
+// `include_expired=false` skip expired warranty, `format=csv` for spreadsheet
+func LifecycleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+		defer cancel()
+
+		days, err := strconv.Atoi(c.DefaultQuery("days", "90"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days"})
+			return
+		}
+		param := LifecycleParam{
+			ContactID:      c.Query("contact_id"),
+			SiteID:         c.Query("site_id"),
+			Days:           days,
+			IncludeExpired: c.DefaultQuery("include_expired", "true") != "false",
+		}
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		data, err := uc.Lifecycle(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if strings.EqualFold(c.Query("format"), "csv") {
+			writeLifecycleCSV(c, data)
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    "Successfully get lifecycle " + ModuleName,
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// SubnetsHandler cctv addresses grouped by site, vlan & subnet with their utilization and conflicts,
+// `prefix` (default 24) & `prefix6` (default 64) set the subnet size
+func SubnetsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+		defer cancel()
+
+		prefix, err := strconv.Atoi(c.DefaultQuery("prefix", "24"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prefix"})
+			return
+		}
+		prefix6, err := strconv.Atoi(c.DefaultQuery("prefix6", "64"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prefix6"})
+			return
+		}
+		param := SubnetParam{
+			ContactID: c.Query("contact_id"),
+			SiteID:    c.Query("site_id"),
+			PrefixV4:  prefix,
+			PrefixV6:  prefix6,
+		}
+
+		uc := UsecaseHandler{
+			Ctx: ctx,
+		}
+
+		data, err := uc.Subnets(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusOK),
+			Message:    "Successfully get subnets " + ModuleName,
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// one row per cctv
+func writeLifecycleCSV(c *gin.Context, data *LifecycleReport) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="lifecycle_`+data.GeneratedAt.Format("20060102")+`.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	writeCSVRow(w, []string{
+		"contact_id", "contact_name", "cctv_id", "name", "site_id", "status", "brand", "model",
+		"purchase_date", "installer", "warranty_expiry", "replacement_date", "warranty", "replacement_due",
+	})
+	for _, g := range data.Contacts {
+		for _, v := range g.Cctvs {
+			writeCSVRow(w, []string{
+				g.ContactID, g.Name, v.CctvID, v.Name, csvString(v.SiteID), v.Status, csvString(v.Brand), csvString(v.Model),
+				csvString(v.PurchaseDate), csvString(v.Installer), csvString(v.WarrantyExpiry), csvString(v.ReplacementDate),
+				v.Warranty, strconv.FormatBool(v.ReplacementDue),
+			})
+		}
+	}
+	w.Flush()
+}
+
+// writeCSVRow write the row with formula characters escaped, the values come from users
+func writeCSVRow(w *csv.Writer, row []string) {
+	for i, v := range row {
+		row[i] = utils.EscapeFormula(v)
+	}
+	w.Write(row)
+}
+
+// empty for nil
+func csvString(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+// one row per cctv, last row is the total
+func writeAvailabilityCSV(c *gin.Context, data *Availability) {
+	name := "availability"
+	if data.ContactID != "" {
+		name += "_" + data.ContactID
+	}
+	if data.SiteID != "" {
+		name += "_" + data.SiteID
+	}
+	name += "_" + data.From.Format("20060102") + "_" + data.To.Format("20060102") + ".csv"
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	writeCSVRow(w, []string{
+		"cctv_id", "name", "site_id", "status",
+		"monitored_seconds", "uptime_seconds", "downtime_seconds", "maintenance_seconds",
+		"uptime_percent", "outage_count", "mttr_seconds", "longest_outage_seconds",
+	})
+	for _, v := range data.Cctvs {
+		siteID := ""
+		if v.SiteID != nil {
+			siteID = *v.SiteID
+		}
+		writeCSVRow(w, append([]string{v.CctvID, v.Name, siteID, v.Status}, statsRow(v.AvailabilityStats)...))
+	}
+	writeCSVRow(w, append([]string{"TOTAL", strconv.Itoa(data.Summary.CctvCount) + " cctv", "", ""}, statsRow(data.Summary.AvailabilityStats)...))
+	w.Flush()
+}
+
+func statsRow(s AvailabilityStats) []string {
+	percent := ""
+	if s.UptimePercent != nil {
+		percent = strconv.FormatFloat(*s.UptimePercent, 'f', 3, 64)
+	}
+	return []string{
+		strconv.FormatInt(s.MonitoredSeconds, 10),
+		strconv.FormatInt(s.UptimeSeconds, 10),
+		strconv.FormatInt(s.DowntimeSeconds, 10),
+		strconv.FormatInt(s.MaintenanceSeconds, 10),
+		percent,
+		strconv.Itoa(s.OutageCount),
+		strconv.FormatInt(s.MTTRSeconds, 10),
+		strconv.FormatInt(s.LongestOutageSeconds, 10),
+	}
+}
+
+// parseTime accept RFC3339 or a date in server timezone
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", v, time.Local)
+}
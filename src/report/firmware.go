@@ -0,0 +1,182 @@
+package report
+
+import (
+	"strings"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/src/catalog"
+	"github.com/maulanar/gin-kecilin/src/cctv"
+	"github.com/maulanar/gin-kecilin/src/contact"
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Firmware list cctvs whose firmware is older than the minimum or recommended version of their catalog model,
+// grouped by owner contact. Decommissioned cctv is skipped
+func (uc *UsecaseHandler) Firmware(param FirmwareParam) (*FirmwareReport, error) {
+	// catalog models having a firmware requirement
+	modelFilter := bson.M{"$or": bson.A{
+		bson.M{"min_firmware_version": bson.M{"$nin": bson.A{nil, ""}}},
+		bson.M{"recommended_firmware_version": bson.M{"$nin": bson.A{nil, ""}}},
+	}}
+	if param.BrandID != "" {
+		modelFilter["brand_id"] = param.BrandID
+	}
+	if param.ModelID != "" {
+		modelFilter["model_id"] = param.ModelID
+	}
+	cur, err := catalog.ModelCollection().Find(uc.Ctx, modelFilter)
+	if err != nil {
+		return nil, err
+	}
+	var models []catalog.Model
+	if err := cur.All(uc.Ctx, &models); err != nil {
+		return nil, err
+	}
+	modelByID := map[string]*catalog.Model{}
+	modelIDs := bson.A{}
+	for k, v := range models {
+		modelByID[v.ModelID] = &models[k]
+		modelIDs = append(modelIDs, v.ModelID)
+	}
+
+	filter := bson.M{"status": bson.M{"$ne": cctv.StatusDecommissioned}}
+	if param.ContactID != "" {
+		filter["contact_id"] = param.ContactID
+	}
+	if param.SiteID != "" {
+		filter["site_id"] = param.SiteID
+	}
+	if param.BrandID != "" {
+		filter["brand_id"] = param.BrandID
+	}
+
+	res := FirmwareReport{
+		GeneratedAt: time.Now(),
+		Contacts:    []ContactFirmware{},
+	}
+
+	// cctv without catalog model or whose model has no requirement
+	unchecked := bson.M{"model_id": bson.M{"$nin": modelIDs}}
+	if param.ModelID != "" {
+		unchecked["model_id"] = bson.M{"$eq": param.ModelID, "$nin": modelIDs}
+	}
+	for k, v := range filter {
+		unchecked[k] = v
+	}
+	res.Summary.UncheckedCount, err = cctv.Collection().CountDocuments(uc.Ctx, unchecked)
+	if err != nil {
+		return nil, err
+	}
+
+	filter["model_id"] = bson.M{"$in": modelIDs}
+	opts := options.Find().
+		SetProjection(bson.M{"credentials": 0, "contacts": 0, "custom_fields": 0}).
+		SetSort(bson.D{{Key: "contact_id", Value: 1}, {Key: "name", Value: 1}})
+	cctvCur, err := cctv.Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var cctvs []cctv.Cctv
+	if err := cctvCur.All(uc.Ctx, &cctvs); err != nil {
+		return nil, err
+	}
+	res.Summary.CheckedCount = len(cctvs)
+
+	// cctvs are sorted by contact, so a contact is one run of rows
+	for _, v := range cctvs {
+		m := modelByID[*v.ModelID]
+		compliance := firmwareCompliance(v.FirmwareVersion, m)
+		switch compliance {
+		case "":
+			continue
+		case FirmwareBelowMinimum:
+			res.Summary.BelowMinimumCount++
+		case FirmwareBelowRecommended:
+			res.Summary.BelowRecommendedCount++
+		case FirmwareUnknown:
+			res.Summary.UnknownCount++
+			if !param.IncludeUnknown {
+				continue
+			}
+		}
+		res.Summary.NonCompliantCount++
+
+		if n := len(res.Contacts); n == 0 || res.Contacts[n-1].ContactID != v.ContactID {
+			res.Contacts = append(res.Contacts, ContactFirmware{ContactID: v.ContactID, Cctvs: []CctvFirmware{}})
+		}
+		group := &res.Contacts[len(res.Contacts)-1]
+		group.Cctvs = append(group.Cctvs, CctvFirmware{
+			CctvID:                     v.CctvID,
+			Name:                       v.Name,
+			SiteID:                     v.SiteID,
+			Status:                     v.Status,
+			BrandID:                    v.BrandID,
+			Brand:                      v.Brand,
+			ModelID:                    v.ModelID,
+			Model:                      v.Model,
+			FirmwareVersion:            v.FirmwareVersion,
+			FirmwareUpdatedAt:          v.FirmwareUpdatedAt,
+			MinFirmwareVersion:         m.MinFirmwareVersion,
+			RecommendedFirmwareVersion: m.RecommendedFirmwareVersion,
+			Compliance:                 compliance,
+		})
+	}
+
+	ids := []string{}
+	for _, v := range res.Contacts {
+		ids = append(ids, v.ContactID)
+	}
+	names, err := uc.contactNames(ids)
+	if err != nil {
+		return nil, err
+	}
+	for k := range res.Contacts {
+		res.Contacts[k].Name = names[res.Contacts[k].ContactID]
+	}
+	return &res, nil
+}
+
+// firmwareCompliance of the version against the model, empty when compliant
+func firmwareCompliance(version *string, m *catalog.Model) string {
+	if version == nil || strings.TrimSpace(*version) == "" {
+		return FirmwareUnknown
+	}
+	if m.MinFirmwareVersion != nil && *m.MinFirmwareVersion != "" &&
+		utils.CompareVersions(*version, *m.MinFirmwareVersion) < 0 {
+		return FirmwareBelowMinimum
+	}
+	if m.RecommendedFirmwareVersion != nil && *m.RecommendedFirmwareVersion != "" &&
+		utils.CompareVersions(*version, *m.RecommendedFirmwareVersion) < 0 {
+		return FirmwareBelowRecommended
+	}
+	return ""
+}
+
+// contactNames full name of every contact by id
+func (uc *UsecaseHandler) contactNames(ids []string) (map[string]string, error) {
+	cur, err := contact.Collection().Find(uc.Ctx, bson.M{"contact_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"contact_id": 1, "first_name": 1, "last_name": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var contacts []contact.Contact
+	if err := cur.All(uc.Ctx, &contacts); err != nil {
+		return nil, err
+	}
+
+	names := map[string]string{}
+	for _, c := range contacts {
+		parts := []string{}
+		for _, p := range []*string{c.FirstName, c.LastName} {
+			if p != nil && *p != "" {
+				parts = append(parts, *p)
+			}
+		}
+		names[c.ContactID] = strings.Join(parts, " ")
+	}
+	return names, nil
+}
@@ -0,0 +1,125 @@
+package report
+
+import (
+	"errors"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/src/cctv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Lifecycle list cctvs whose warranty expire or planned replacement is due within the days, grouped by owner contact.
+// Expired warranty is included unless IncludeExpired is false. Decommissioned cctv is skipped
+func (uc *UsecaseHandler) Lifecycle(param LifecycleParam) (*LifecycleReport, error) {
+	if param.Days < 0 {
+		return nil, errors.New("Days must not be negative")
+	}
+	now := time.Now()
+	today := now.Format("2006-01-02")
+	until := now.AddDate(0, 0, param.Days).Format("2006-01-02")
+
+	base := bson.M{"status": bson.M{"$ne": cctv.StatusDecommissioned}}
+	if param.ContactID != "" {
+		base["contact_id"] = param.ContactID
+	}
+	if param.SiteID != "" {
+		base["site_id"] = param.SiteID
+	}
+
+	res := LifecycleReport{
+		GeneratedAt: now,
+		Until:       until,
+		Contacts:    []ContactLifecycle{},
+	}
+
+	noWarranty := bson.M{"warranty_expiry": bson.M{"$in": bson.A{nil, ""}}}
+	for k, v := range base {
+		noWarranty[k] = v
+	}
+	var err error
+	res.Summary.WithoutWarrantyDate, err = cctv.Collection().CountDocuments(uc.Ctx, noWarranty)
+	if err != nil {
+		return nil, err
+	}
+
+	warranty := bson.M{"$gte": today, "$lte": until}
+	if param.IncludeExpired {
+		warranty = bson.M{"$gt": "", "$lte": until}
+	}
+	filter := bson.M{"$or": bson.A{
+		bson.M{"warranty_expiry": warranty},
+		bson.M{"replacement_date": bson.M{"$gt": "", "$lte": until}},
+	}}
+	for k, v := range base {
+		filter[k] = v
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"credentials": 0, "contacts": 0, "custom_fields": 0}).
+		SetSort(bson.D{{Key: "contact_id", Value: 1}, {Key: "warranty_expiry", Value: 1}, {Key: "name", Value: 1}})
+	cur, err := cctv.Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var cctvs []cctv.Cctv
+	if err := cur.All(uc.Ctx, &cctvs); err != nil {
+		return nil, err
+	}
+	res.Summary.CctvCount = len(cctvs)
+
+	// cctvs are sorted by contact, so a contact is one run of rows
+	for _, v := range cctvs {
+		row := CctvLifecycle{
+			CctvID:          v.CctvID,
+			Name:            v.Name,
+			SiteID:          v.SiteID,
+			Status:          v.Status,
+			Brand:           v.Brand,
+			Model:           v.Model,
+			PurchaseDate:    v.PurchaseDate,
+			Installer:       v.Installer,
+			WarrantyExpiry:  v.WarrantyExpiry,
+			ReplacementDate: v.ReplacementDate,
+		}
+		if w := v.WarrantyExpiry; w != nil && *w != "" && *w <= until {
+			row.Warranty = WarrantyExpiring
+			if *w < today {
+				row.Warranty = WarrantyExpired
+			}
+		}
+		switch row.Warranty {
+		case WarrantyExpired:
+			if param.IncludeExpired {
+				res.Summary.WarrantyExpired++
+			} else {
+				row.Warranty = ""
+			}
+		case WarrantyExpiring:
+			res.Summary.WarrantyExpiring++
+		}
+		if r := v.ReplacementDate; r != nil && *r != "" && *r <= until {
+			row.ReplacementDue = true
+			res.Summary.ReplacementDue++
+		}
+
+		if n := len(res.Contacts); n == 0 || res.Contacts[n-1].ContactID != v.ContactID {
+			res.Contacts = append(res.Contacts, ContactLifecycle{ContactID: v.ContactID, Cctvs: []CctvLifecycle{}})
+		}
+		group := &res.Contacts[len(res.Contacts)-1]
+		group.Cctvs = append(group.Cctvs, row)
+	}
+
+	ids := []string{}
+	for _, v := range res.Contacts {
+		ids = append(ids, v.ContactID)
+	}
+	names, err := uc.contactNames(ids)
+	if err != nil {
+		return nil, err
+	}
+	for k := range res.Contacts {
+		res.Contacts[k].Name = names[res.Contacts[k].ContactID]
+	}
+	return &res, nil
+}
@@ -0,0 +1,226 @@
+package report
+
+import (
+	"time"
+)
+
+// param of availability report
+type AvailabilityParam struct {
+	ContactID string
+	SiteID    string
+	From      time.Time
+	To        time.Time
+}
+
+// availability of a contact or site over a period, durations in seconds
+type Availability struct {
+	ContactID string              `json:"contact_id,omitempty"`
+	SiteID    string              `json:"site_id,omitempty"`
+	From      time.Time           `json:"from"`
+	To        time.Time           `json:"to"`
+	Summary   AvailabilitySummary `json:"summary"`
+	Cctvs     []CctvAvailability  `json:"cctvs"`
+}
+
+type AvailabilitySummary struct {
+	CctvCount int `json:"cctv_count"`
+	AvailabilityStats
+}
+
+type CctvAvailability struct {
+	CctvID string  `json:"cctv_id"`
+	Name   string  `json:"name"`
+	SiteID *string `json:"site_id"`
+	Status string  `json:"status"`
+	AvailabilityStats
+}
+
+type AvailabilityStats struct {
+	MonitoredSeconds     int64    `json:"monitored_seconds"`
+	UptimeSeconds        int64    `json:"uptime_seconds"`
+	DowntimeSeconds      int64    `json:"downtime_seconds"`
+	MaintenanceSeconds   int64    `json:"maintenance_seconds"`
+	UptimePercent        *float64 `json:"uptime_percent"` // nil when never monitored
+	OutageCount          int      `json:"outage_count"`
+	MTTRSeconds          int64    `json:"mttr_seconds"`
+	LongestOutageSeconds int64    `json:"longest_outage_seconds"`
+}
+
+// cctv fields needed by report
+type reportCctv struct {
+	CctvID string  `bson:"cctv_id"`
+	Name   string  `bson:"name"`
+	SiteID *string `bson:"site_id"`
+	Status string  `bson:"status"`
+}
+
+// time range, end exclusive
+type interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// compliance of a cctv firmware against its catalog model
+const (
+	FirmwareBelowMinimum     = "below_minimum"
+	FirmwareBelowRecommended = "below_recommended"
+	FirmwareUnknown          = "unknown" // model has a requirement but the cctv firmware is not known
+)
+
+// param of firmware report
+type FirmwareParam struct {
+	ContactID      string
+	SiteID         string
+	BrandID        string
+	ModelID        string
+	IncludeUnknown bool
+}
+
+// cctvs running firmware older than their catalog model require, grouped by owner contact
+type FirmwareReport struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Summary     FirmwareSummary   `json:"summary"`
+	Contacts    []ContactFirmware `json:"contacts"`
+}
+
+type FirmwareSummary struct {
+	CheckedCount          int   `json:"checked_count"`   // cctv of a model with firmware requirement
+	UncheckedCount        int64 `json:"unchecked_count"` // cctv without catalog model or requirement
+	NonCompliantCount     int   `json:"non_compliant_count"`
+	BelowMinimumCount     int   `json:"below_minimum_count"`
+	BelowRecommendedCount int   `json:"below_recommended_count"`
+	UnknownCount          int   `json:"unknown_count"`
+}
+
+type ContactFirmware struct {
+	ContactID string         `json:"contact_id"`
+	Name      string         `json:"name"`
+	Cctvs     []CctvFirmware `json:"cctvs"`
+}
+
+type CctvFirmware struct {
+	CctvID                     string     `json:"cctv_id"`
+	Name                       string     `json:"name"`
+	SiteID                     *string    `json:"site_id"`
+	Status                     string     `json:"status"`
+	BrandID                    *string    `json:"brand_id"`
+	Brand                      *string    `json:"brand"`
+	ModelID                    *string    `json:"model_id"`
+	Model                      *string    `json:"model"`
+	FirmwareVersion            *string    `json:"firmware_version"`
+	FirmwareUpdatedAt          *time.Time `json:"firmware_updated_at"`
+	MinFirmwareVersion         *string    `json:"min_firmware_version"`
+	RecommendedFirmwareVersion *string    `json:"recommended_firmware_version"`
+	Compliance                 string     `json:"compliance"`
+}
+
+// warranty state of a cctv in the lifecycle report
+const (
+	WarrantyExpired  = "expired"
+	WarrantyExpiring = "expiring"
+)
+
+// param of lifecycle report, dates are YYYY-MM-DD
+type LifecycleParam struct {
+	ContactID      string
+	SiteID         string
+	Days           int
+	IncludeExpired bool
+}
+
+// cctvs whose warranty expire or replacement is due within the days, grouped by owner contact
+type LifecycleReport struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Until       string             `json:"until"`
+	Summary     LifecycleSummary   `json:"summary"`
+	Contacts    []ContactLifecycle `json:"contacts"`
+}
+
+type LifecycleSummary struct {
+	CctvCount           int   `json:"cctv_count"`
+	WarrantyExpired     int   `json:"warranty_expired"`
+	WarrantyExpiring    int   `json:"warranty_expiring"`
+	ReplacementDue      int   `json:"replacement_due"`
+	WithoutWarrantyDate int64 `json:"without_warranty_date"` // active cctv without warranty expiry
+}
+
+type ContactLifecycle struct {
+	ContactID string          `json:"contact_id"`
+	Name      string          `json:"name"`
+	Cctvs     []CctvLifecycle `json:"cctvs"`
+}
+
+type CctvLifecycle struct {
+	CctvID          string  `json:"cctv_id"`
+	Name            string  `json:"name"`
+	SiteID          *string `json:"site_id"`
+	Status          string  `json:"status"`
+	Brand           *string `json:"brand"`
+	Model           *string `json:"model"`
+	PurchaseDate    *string `json:"purchase_date"`
+	Installer       *string `json:"installer"`
+	WarrantyExpiry  *string `json:"warranty_expiry"`
+	ReplacementDate *string `json:"replacement_date"`
+	Warranty        string  `json:"warranty,omitempty"` // expired or expiring
+	ReplacementDue  bool    `json:"replacement_due"`
+}
+
+// kind of address conflict in the subnet report
+const (
+	ConflictDuplicateIP  = "duplicate_ip"  // one ip address on several devices of a site
+	ConflictDuplicateMAC = "duplicate_mac" // one mac address on several devices
+	ConflictSubnetVLANs  = "subnet_vlans"  // one subnet of a site on several vlans
+)
+
+// param of subnet report, prefix length used to group addresses into subnets
+type SubnetParam struct {
+	ContactID string
+	SiteID    string
+	PrefixV4  int
+	PrefixV6  int
+}
+
+// cctv addresses grouped by site, vlan & subnet, with the conflicting addresses
+type SubnetReport struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	Summary     SubnetSummary `json:"summary"`
+	Subnets     []Subnet      `json:"subnets"`
+	Conflicts   []IPConflict  `json:"conflicts"`
+}
+
+type SubnetSummary struct {
+	CctvCount     int   `json:"cctv_count"`
+	SubnetCount   int   `json:"subnet_count"`
+	ConflictCount int   `json:"conflict_count"`
+	WithoutIP     int64 `json:"without_ip"` // active cctv without ip address
+	InvalidIP     int   `json:"invalid_ip"` // stored before validation, fixed by normalize-ips
+}
+
+type Subnet struct {
+	SiteID             *string  `json:"site_id"`
+	VLAN               *int     `json:"vlan"`
+	Subnet             string   `json:"subnet"` // e.g. 10.0.0.0/24
+	CctvCount          int      `json:"cctv_count"`
+	AddressCount       int      `json:"address_count"`       // distinct ip address, channels of a recorder share one
+	Capacity           *int64   `json:"capacity"`            // usable host address, nil when too big to count
+	UtilizationPercent *float64 `json:"utilization_percent"` // address count of the capacity
+}
+
+type IPConflict struct {
+	Type   string       `json:"type"`
+	SiteID *string      `json:"site_id"`
+	Value  string       `json:"value"` // the ip address, mac address or subnet
+	Cctvs  []CctvSubnet `json:"cctvs"`
+}
+
+type CctvSubnet struct {
+	CctvID     string  `json:"cctv_id"`
+	Name       string  `json:"name"`
+	ContactID  string  `json:"contact_id"`
+	IPAddress  *string `json:"ip_address"`
+	Port       *int    `json:"port"`
+	MACAddress *string `json:"mac_address"`
+	VLAN       *int    `json:"vlan"`
+	RecorderID *string `json:"recorder_id"`
+	Channel    *int    `json:"channel"`
+}
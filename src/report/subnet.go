@@ -0,0 +1,203 @@
+package report
+
+import (
+	"errors"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/src/cctv"
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Subnets group the cctv ip addresses by site, vlan & subnet of the prefix length, and list address conflicts.
+// Private addresses repeat across sites, so ip & subnet are compared per site while mac address is global.
+// Channels of one recorder share its address and count as one device on the ip. Decommissioned cctv is skipped
+func (uc *UsecaseHandler) Subnets(param SubnetParam) (*SubnetReport, error) {
+	if param.PrefixV4 < 1 || param.PrefixV4 > 32 {
+		return nil, errors.New("Prefix must be between 1 and 32")
+	}
+	if param.PrefixV6 < 1 || param.PrefixV6 > 128 {
+		return nil, errors.New("Prefix6 must be between 1 and 128")
+	}
+
+	base := bson.M{"status": bson.M{"$ne": cctv.StatusDecommissioned}}
+	if param.ContactID != "" {
+		base["contact_id"] = param.ContactID
+	}
+	if param.SiteID != "" {
+		base["site_id"] = param.SiteID
+	}
+
+	res := SubnetReport{
+		GeneratedAt: time.Now(),
+		Subnets:     []Subnet{},
+		Conflicts:   []IPConflict{},
+	}
+
+	noIP := bson.M{"ip_address": bson.M{"$in": bson.A{nil, ""}}}
+	for k, v := range base {
+		noIP[k] = v
+	}
+	var err error
+	res.Summary.WithoutIP, err = cctv.Collection().CountDocuments(uc.Ctx, noIP)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"ip_address": bson.M{"$nin": bson.A{nil, ""}}}
+	for k, v := range base {
+		filter[k] = v
+	}
+	opts := options.Find().
+		SetProjection(bson.M{
+			"cctv_id": 1, "name": 1, "contact_id": 1, "site_id": 1, "ip_address": 1, "port": 1,
+			"mac_address": 1, "vlan": 1, "recorder_id": 1, "channel": 1,
+		}).
+		SetSort(bson.D{{Key: "site_id", Value: 1}, {Key: "ip_key", Value: 1}, {Key: "name", Value: 1}})
+	cur, err := cctv.Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var cctvs []cctv.Cctv
+	if err := cur.All(uc.Ctx, &cctvs); err != nil {
+		return nil, err
+	}
+
+	type subnetGroup struct {
+		row       Subnet
+		prefix    netip.Prefix
+		addresses map[string]bool
+	}
+	type conflictGroup struct {
+		conflict IPConflict
+		devices  map[string]bool
+		vlans    map[string]bool
+	}
+	subnets := map[string]*subnetGroup{}
+	subnetOrder := []string{}
+	conflicts := map[string]*conflictGroup{}
+	conflictOrder := []string{}
+	addConflict := func(key, kind string, siteID *string, value string, v *CctvSubnet, device string, vlan string) {
+		g, ok := conflicts[key]
+		if !ok {
+			g = &conflictGroup{
+				conflict: IPConflict{Type: kind, SiteID: siteID, Value: value, Cctvs: []CctvSubnet{}},
+				devices:  map[string]bool{},
+				vlans:    map[string]bool{},
+			}
+			conflicts[key] = g
+			conflictOrder = append(conflictOrder, key)
+		}
+		g.conflict.Cctvs = append(g.conflict.Cctvs, *v)
+		g.devices[device] = true
+		g.vlans[vlan] = true
+	}
+
+	for _, v := range cctvs {
+		host, err := utils.ParseCIDR(*v.IPAddress)
+		if err != nil {
+			res.Summary.InvalidIP++
+			continue
+		}
+		res.Summary.CctvCount++
+
+		addr := host.Addr()
+		bits := param.PrefixV6
+		if addr.Is4() {
+			bits = param.PrefixV4
+		}
+		prefix, _ := addr.Prefix(bits)
+
+		site, vlan := "", ""
+		if v.SiteID != nil {
+			site = *v.SiteID
+		}
+		if v.VLAN != nil {
+			vlan = strconv.Itoa(*v.VLAN)
+		}
+		// channels of one recorder are one device
+		device := "cctv:" + v.CctvID
+		if v.RecorderID != nil && *v.RecorderID != "" {
+			device = "recorder:" + *v.RecorderID
+		}
+
+		key := site + "|" + vlan + "|" + prefix.String()
+		g, ok := subnets[key]
+		if !ok {
+			g = &subnetGroup{
+				row:       Subnet{SiteID: v.SiteID, VLAN: v.VLAN, Subnet: prefix.String()},
+				prefix:    prefix,
+				addresses: map[string]bool{},
+			}
+			subnets[key] = g
+			subnetOrder = append(subnetOrder, key)
+		}
+		g.row.CctvCount++
+		g.addresses[addr.String()] = true
+
+		row := &CctvSubnet{
+			CctvID:     v.CctvID,
+			Name:       v.Name,
+			ContactID:  v.ContactID,
+			IPAddress:  v.IPAddress,
+			Port:       v.Port,
+			MACAddress: v.MACAddress,
+			VLAN:       v.VLAN,
+			RecorderID: v.RecorderID,
+			Channel:    v.Channel,
+		}
+		addConflict(ConflictDuplicateIP+"|"+site+"|"+addr.String(), ConflictDuplicateIP, v.SiteID, addr.String(), row, device, vlan)
+		addConflict(ConflictSubnetVLANs+"|"+site+"|"+prefix.String(), ConflictSubnetVLANs, v.SiteID, prefix.String(), row, device, vlan)
+		if v.MACAddress != nil && *v.MACAddress != "" {
+			// mac address is of the camera itself, even behind a recorder
+			addConflict(ConflictDuplicateMAC+"|"+*v.MACAddress, ConflictDuplicateMAC, nil, *v.MACAddress, row, "cctv:"+v.CctvID, vlan)
+		}
+	}
+
+	for _, key := range subnetOrder {
+		g := subnets[key]
+		g.row.AddressCount = len(g.addresses)
+		if capacity, ok := subnetCapacity(g.prefix); ok {
+			percent := float64(g.row.AddressCount) / float64(capacity) * 100
+			g.row.Capacity = &capacity
+			g.row.UtilizationPercent = &percent
+		}
+		res.Subnets = append(res.Subnets, g.row)
+	}
+	res.Summary.SubnetCount = len(res.Subnets)
+
+	for _, key := range conflictOrder {
+		g := conflicts[key]
+		switch g.conflict.Type {
+		case ConflictSubnetVLANs:
+			if len(g.vlans) < 2 {
+				continue
+			}
+		default:
+			if len(g.devices) < 2 {
+				continue
+			}
+		}
+		res.Conflicts = append(res.Conflicts, g.conflict)
+	}
+	res.Summary.ConflictCount = len(res.Conflicts)
+	return &res, nil
+}
+
+// subnetCapacity usable host address of the subnet, IPv4 network & broadcast address are not usable except on /31 & /32.
+// False when the subnet is too big to count
+func subnetCapacity(prefix netip.Prefix) (int64, bool) {
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > 62 {
+		return 0, false
+	}
+	capacity := int64(1) << hostBits
+	if prefix.Addr().Is4() && hostBits >= 2 {
+		capacity -= 2
+	}
+	return capacity, true
+}
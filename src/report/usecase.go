@@ -0,0 +1,286 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/src/cctv"
+	"github.com/maulanar/gin-kecilin/src/contact"
+	"github.com/maulanar/gin-kecilin/src/maintenance"
+	"github.com/maulanar/gin-kecilin/src/site"
+	"github.com/maulanar/gin-kecilin/src/statushistory"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// adjustable depending on usecase
+type UsecaseHandler struct {
+	Ctx context.Context
+}
+
+// Availability compute uptime of every cctv of a contact or site from status history,
+// time in maintenance status or maintenance window is excluded
+func (uc *UsecaseHandler) Availability(param AvailabilityParam) (*Availability, error) {
+	if param.ContactID == "" && param.SiteID == "" {
+		return nil, errors.New("Contact id or site id is required")
+	}
+	if !param.To.After(param.From) {
+		return nil, errors.New("To must be after from")
+	}
+
+	filter := bson.M{}
+	if param.ContactID != "" {
+		count, err := contact.Collection().CountDocuments(uc.Ctx, bson.M{"contact_id": param.ContactID})
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, errors.New("Data Contact with id " + param.ContactID + " is not found")
+		}
+		filter["contact_id"] = param.ContactID
+	}
+	if param.SiteID != "" {
+		siteUc := site.UsecaseHandler{Ctx: uc.Ctx}
+		if _, err := siteUc.GetByID(param.SiteID); err != nil {
+			return nil, err
+		}
+		filter["site_id"] = param.SiteID
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"cctv_id": 1, "name": 1, "site_id": 1, "status": 1}).
+		SetSort(bson.D{{Key: "name", Value: 1}})
+	cur, err := cctv.Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var cctvs []reportCctv
+	if err := cur.All(uc.Ctx, &cctvs); err != nil {
+		return nil, err
+	}
+
+	res := Availability{
+		ContactID: param.ContactID,
+		SiteID:    param.SiteID,
+		From:      param.From,
+		To:        param.To,
+		Cctvs:     []CctvAvailability{},
+	}
+	res.Summary.CctvCount = len(cctvs)
+
+	for _, v := range cctvs {
+		stats, err := uc.cctvAvailability(v, param.From, param.To)
+		if err != nil {
+			return nil, err
+		}
+		res.Cctvs = append(res.Cctvs, CctvAvailability{
+			CctvID:            v.CctvID,
+			Name:              v.Name,
+			SiteID:            v.SiteID,
+			Status:            v.Status,
+			AvailabilityStats: *stats,
+		})
+
+		sum := &res.Summary.AvailabilityStats
+		sum.MonitoredSeconds += stats.MonitoredSeconds
+		sum.UptimeSeconds += stats.UptimeSeconds
+		sum.DowntimeSeconds += stats.DowntimeSeconds
+		sum.MaintenanceSeconds += stats.MaintenanceSeconds
+		sum.OutageCount += stats.OutageCount
+		if stats.LongestOutageSeconds > sum.LongestOutageSeconds {
+			sum.LongestOutageSeconds = stats.LongestOutageSeconds
+		}
+	}
+	res.Summary.AvailabilityStats.finish()
+
+	return &res, nil
+}
+
+// cctvAvailability walk the status history of a cctv within from and to
+func (uc *UsecaseHandler) cctvAvailability(v reportCctv, from, to time.Time) (*AvailabilityStats, error) {
+	segments, err := uc.statusSegments(v, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	windows, err := maintenance.GetWindowsFor(uc.Ctx, v.CctvID, v.SiteID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	excluded := []interval{}
+	for _, w := range windows {
+		excluded = append(excluded, interval{Start: w.StartAt, End: w.EndAt})
+	}
+
+	stats := segmentStats(segments, mergeIntervals(excluded, from, to))
+	return &stats, nil
+}
+
+// segmentStats sum the status segments, time inside the merged maintenance windows is not monitored
+func segmentStats(segments []statusSegment, excluded []interval) AvailabilityStats {
+	stats := AvailabilityStats{}
+	for _, s := range segments {
+		total := seconds(s.End.Sub(s.Start))
+		if s.Status == cctv.StatusMaintenance {
+			stats.MaintenanceSeconds += total
+			continue
+		}
+		if s.Status != cctv.StatusOnline && s.Status != cctv.StatusOffline {
+			// not installed or decommissioned is not monitored
+			continue
+		}
+
+		inWindow := overlap(s.interval, excluded)
+		stats.MaintenanceSeconds += inWindow
+		counted := total - inWindow
+		if counted <= 0 {
+			continue
+		}
+
+		stats.MonitoredSeconds += counted
+		if s.Status == cctv.StatusOnline {
+			stats.UptimeSeconds += counted
+			continue
+		}
+
+		stats.DowntimeSeconds += counted
+		stats.OutageCount++
+		if counted > stats.LongestOutageSeconds {
+			stats.LongestOutageSeconds = counted
+		}
+	}
+	stats.finish()
+	return stats
+}
+
+type statusSegment struct {
+	interval
+	Status string
+}
+
+// statusSegments split from and to into periods of a single status
+func (uc *UsecaseHandler) statusSegments(v reportCctv, from, to time.Time) ([]statusSegment, error) {
+	// status at the start of the period
+	var last statushistory.StatusHistory
+	status := ""
+	err := statushistory.Collection().FindOne(uc.Ctx,
+		bson.M{"cctv_id": v.CctvID, "changed_at": bson.M{"$lte": from}},
+		options.FindOne().SetSort(bson.D{{Key: "changed_at", Value: -1}}),
+	).Decode(&last)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	if err == nil {
+		status = last.To
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "changed_at", Value: 1}})
+	cur, err := statushistory.Collection().Find(uc.Ctx,
+		bson.M{"cctv_id": v.CctvID, "changed_at": bson.M{"$gt": from, "$lt": to}},
+		opts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var histories []statushistory.StatusHistory
+	if err := cur.All(uc.Ctx, &histories); err != nil {
+		return nil, err
+	}
+
+	// cctv without any history keep its current status
+	if status == "" && len(histories) == 0 {
+		status = v.Status
+	}
+	return buildSegments(status, histories, from, to), nil
+}
+
+// buildSegments split from and to by the status changes, status is the one at from,
+// empty status before the first change is taken from that change
+func buildSegments(status string, histories []statushistory.StatusHistory, from, to time.Time) []statusSegment {
+	if status == "" && len(histories) > 0 {
+		// status before the first recorded change, empty when cctv created in the period
+		status = histories[0].From
+	}
+
+	start := from
+	segments := []statusSegment{}
+	for _, h := range histories {
+		if h.ChangedAt.After(start) && status != "" {
+			segments = append(segments, statusSegment{interval{start, h.ChangedAt}, status})
+		}
+		start = h.ChangedAt
+		status = h.To
+	}
+	if to.After(start) && status != "" {
+		segments = append(segments, statusSegment{interval{start, to}, status})
+	}
+	return segments
+}
+
+// finish compute the derived stats
+func (s *AvailabilityStats) finish() {
+	if s.MonitoredSeconds > 0 {
+		percent := math.Round(float64(s.UptimeSeconds)/float64(s.MonitoredSeconds)*100000) / 1000
+		s.UptimePercent = &percent
+	}
+	if s.OutageCount > 0 {
+		s.MTTRSeconds = s.DowntimeSeconds / int64(s.OutageCount)
+	}
+}
+
+// mergeIntervals clip intervals to from and to, then merge the overlapping ones
+func mergeIntervals(list []interval, from, to time.Time) []interval {
+	clipped := []interval{}
+	for _, v := range list {
+		if v.Start.Before(from) {
+			v.Start = from
+		}
+		if v.End.After(to) {
+			v.End = to
+		}
+		if v.End.After(v.Start) {
+			clipped = append(clipped, v)
+		}
+	}
+	sort.Slice(clipped, func(i, j int) bool { return clipped[i].Start.Before(clipped[j].Start) })
+
+	merged := []interval{}
+	for _, v := range clipped {
+		n := len(merged)
+		if n > 0 && !v.Start.After(merged[n-1].End) {
+			if v.End.After(merged[n-1].End) {
+				merged[n-1].End = v.End
+			}
+			continue
+		}
+		merged = append(merged, v)
+	}
+	return merged
+}
+
+// overlap total seconds of v covered by the merged intervals
+func overlap(v interval, list []interval) int64 {
+	var total time.Duration
+	for _, w := range list {
+		start, end := w.Start, w.End
+		if start.Before(v.Start) {
+			start = v.Start
+		}
+		if end.After(v.End) {
+			end = v.End
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+		}
+	}
+	return seconds(total)
+}
+
+func seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
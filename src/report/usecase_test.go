@@ -0,0 +1,176 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/src/statushistory"
+)
+
+// hour h of the report day
+func at(h float64) time.Time {
+	return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(h * float64(time.Hour)))
+}
+
+func span(start, end float64) interval {
+	return interval{at(start), at(end)}
+}
+
+func TestMergeIntervals(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []interval
+		want []interval
+	}{
+		{"empty", nil, []interval{}},
+		{"clipped to the period", []interval{span(-2, 1), span(23, 26)}, []interval{span(0, 1), span(23, 24)}},
+		{"outside the period", []interval{span(-3, -1), span(24, 25)}, []interval{}},
+		{"overlapping", []interval{span(5, 8), span(2, 6)}, []interval{span(2, 8)}},
+		{"touching", []interval{span(2, 4), span(4, 6)}, []interval{span(2, 6)}},
+		{"contained", []interval{span(2, 10), span(3, 4)}, []interval{span(2, 10)}},
+		{"apart", []interval{span(6, 7), span(2, 3)}, []interval{span(2, 3), span(6, 7)}},
+		{"empty interval", []interval{span(3, 3), span(5, 4)}, []interval{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeIntervals(tt.in, at(0), at(24))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeIntervals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	windows := []interval{span(2, 4), span(6, 7)}
+	tests := []struct {
+		v    interval
+		want int64
+	}{
+		{span(0, 1), 0},
+		{span(0, 24), 3 * 3600},
+		{span(3, 6.5), 1.5 * 3600},
+		{span(2.5, 3), 1800},
+		{span(4, 6), 0},
+	}
+	for _, tt := range tests {
+		if got := overlap(tt.v, windows); got != tt.want {
+			t.Errorf("overlap(%v) = %d, want %d", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestBuildSegments(t *testing.T) {
+	change := func(h float64, from, to string) statushistory.StatusHistory {
+		return statushistory.StatusHistory{From: from, To: to, ChangedAt: at(h)}
+	}
+
+	tests := []struct {
+		name      string
+		status    string
+		histories []statushistory.StatusHistory
+		want      []statusSegment
+	}{
+		{
+			name:   "no change",
+			status: "online",
+			want:   []statusSegment{{span(0, 24), "online"}},
+		},
+		{
+			name:      "changes",
+			status:    "online",
+			histories: []statushistory.StatusHistory{change(6, "online", "offline"), change(8, "offline", "online")},
+			want:      []statusSegment{{span(0, 6), "online"}, {span(6, 8), "offline"}, {span(8, 24), "online"}},
+		},
+		{
+			name:      "status at the start taken from the first change",
+			histories: []statushistory.StatusHistory{change(6, "offline", "online")},
+			want:      []statusSegment{{span(0, 6), "offline"}, {span(6, 24), "online"}},
+		},
+		{
+			name:      "created in the period",
+			histories: []statushistory.StatusHistory{change(10, "", "pending_install"), change(12, "pending_install", "online")},
+			want:      []statusSegment{{span(10, 12), "pending_install"}, {span(12, 24), "online"}},
+		},
+		{
+			name:      "changes at the same time",
+			status:    "online",
+			histories: []statushistory.StatusHistory{change(5, "online", "offline"), change(5, "offline", "maintenance")},
+			want:      []statusSegment{{span(0, 5), "online"}, {span(5, 24), "maintenance"}},
+		},
+		{
+			name:   "no status",
+			status: "",
+			want:   []statusSegment{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildSegments(tt.status, tt.histories, at(0), at(24))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildSegments() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentStats(t *testing.T) {
+	percent := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name     string
+		segments []statusSegment
+		excluded []interval
+		want     AvailabilityStats
+	}{
+		{
+			name:     "always online",
+			segments: []statusSegment{{span(0, 24), "online"}},
+			want:     AvailabilityStats{MonitoredSeconds: 86400, UptimeSeconds: 86400, UptimePercent: percent(100)},
+		},
+		{
+			name: "outages",
+			segments: []statusSegment{
+				{span(0, 6), "online"}, {span(6, 8), "offline"}, {span(8, 20), "online"}, {span(20, 24), "offline"},
+			},
+			want: AvailabilityStats{
+				MonitoredSeconds: 86400, UptimeSeconds: 18 * 3600, DowntimeSeconds: 6 * 3600, UptimePercent: percent(75),
+				OutageCount: 2, MTTRSeconds: 3 * 3600, LongestOutageSeconds: 4 * 3600,
+			},
+		},
+		{
+			name:     "maintenance status is not monitored",
+			segments: []statusSegment{{span(0, 12), "online"}, {span(12, 24), "maintenance"}},
+			want:     AvailabilityStats{MonitoredSeconds: 12 * 3600, UptimeSeconds: 12 * 3600, MaintenanceSeconds: 12 * 3600, UptimePercent: percent(100)},
+		},
+		{
+			name:     "inactive status is not monitored",
+			segments: []statusSegment{{span(0, 12), "pending_install"}, {span(12, 24), "decommissioned"}},
+			want:     AvailabilityStats{},
+		},
+		{
+			name:     "offline inside a maintenance window",
+			segments: []statusSegment{{span(0, 10), "online"}, {span(10, 14), "offline"}, {span(14, 24), "online"}},
+			excluded: []interval{span(9, 12)},
+			want: AvailabilityStats{
+				MonitoredSeconds: 21 * 3600, UptimeSeconds: 19 * 3600, DowntimeSeconds: 2 * 3600, MaintenanceSeconds: 3 * 3600,
+				UptimePercent: percent(90.476), OutageCount: 1, MTTRSeconds: 2 * 3600, LongestOutageSeconds: 2 * 3600,
+			},
+		},
+		{
+			name:     "outage fully inside a maintenance window",
+			segments: []statusSegment{{span(0, 10), "online"}, {span(10, 11), "offline"}, {span(11, 24), "online"}},
+			excluded: []interval{span(9, 12)},
+			want:     AvailabilityStats{MonitoredSeconds: 21 * 3600, UptimeSeconds: 21 * 3600, MaintenanceSeconds: 3 * 3600, UptimePercent: percent(100)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := segmentStats(tt.segments, tt.excluded)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("segmentStats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
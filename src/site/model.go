@@ -0,0 +1,81 @@
+package site
+
+import (
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Site struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	SiteID    string             `json:"site_id"             bson:"site_id,omitempty"`
+	ContactID *string            `json:"contact_id"          bson:"contact_id,omitempty"`
+	Name      string             `json:"name"                validate:"required,min=2,max=100" bson:"name,omitempty"`
+	Address   *string            `json:"address"             validate:"required,min=2" bson:"address,omitempty"`
+	Timezone  string             `json:"timezone"            validate:"required" bson:"timezone,omitempty"`
+	Zones     []Zone             `json:"zones"               bson:"zones"`
+	CreatedAt time.Time          `json:"created_at"          bson:"created_at,omitempty"`
+	UpdatedAt time.Time          `json:"updated_at"          bson:"updated_at,omitempty"`
+}
+
+// zone or floor inside a site
+type Zone struct {
+	ZoneID    string    `json:"zone_id"             bson:"zone_id"`
+	Name      string    `json:"name"                validate:"required,min=1,max=100" bson:"name"`
+	Type      string    `json:"type"                validate:"required,oneof=zone floor" bson:"type"`
+	CreatedAt time.Time `json:"created_at"          bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"          bson:"updated_at"`
+}
+
+// site tree node with camera rollups
+type SiteNode struct {
+	SiteID      string           `json:"site_id"`
+	Name        string           `json:"name"`
+	Address     *string          `json:"address"`
+	Timezone    string           `json:"timezone"`
+	CameraCount int64            `json:"camera_count"`
+	Status      map[string]int64 `json:"status"`
+	Zones       []ZoneNode       `json:"zones"`
+
+	// cameras in this site without zone
+	Unzoned ZoneNode `json:"unzoned"`
+}
+
+type ZoneNode struct {
+	ZoneID      string           `json:"zone_id,omitempty"`
+	Name        string           `json:"name,omitempty"`
+	Type        string           `json:"type,omitempty"`
+	CameraCount int64            `json:"camera_count"`
+	Status      map[string]int64 `json:"status"`
+}
+
+// whitelist field can be sorted
+var AllowedSortFields = map[string]bool{
+	"site_id":    true,
+	"name":       true,
+	"timezone":   true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+func Collection() *mongo.Collection {
+	return database.OpenCollection("sites")
+}
+
+func CctvCollection() *mongo.Collection {
+	return database.OpenCollection("cctvs")
+}
+
+func RecorderCollection() *mongo.Collection {
+	return database.OpenCollection("recorders")
+}
+
+func MaintenanceCollection() *mongo.Collection {
+	return database.OpenCollection("maintenance_windows")
+}
+
+func EscalationCollection() *mongo.Collection {
+	return database.OpenCollection("escalation_policies")
+}
@@ -0,0 +1,425 @@
+package site
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"github.com/maulanar/gin-kecilin/src/contact"
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// adjustable depending on usecase
+type UsecaseHandler struct {
+	Ctx           context.Context
+	Page          int64
+	Limit         int64
+	TotalData     int64
+	FilterAndSort utils.HelperUsecaseHandler
+}
+
+var valildator = validator.New()
+
+func (uc *UsecaseHandler) Get() ([]Site, error) {
+	if uc.Page < 1 {
+		uc.Page = 1
+	}
+	if uc.Limit < 1 {
+		uc.Limit = 10
+	}
+
+	filter := uc.FilterAndSort.SetFilter() // dynamic filter by query param
+	sort := uc.FilterAndSort.SetSort()     // dynamic sort by query param
+	skip := (uc.Page - 1) * uc.Limit       // offset
+	opts := options.Find().
+		SetSort(sort).
+		SetSkip(skip).
+		SetLimit(uc.Limit)
+
+	// total docs
+	total, err := Collection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var datas []Site
+	if err := cur.All(uc.Ctx, &datas); err != nil {
+		return nil, err
+	}
+
+	totalPages := int64(math.Ceil(float64(total) / float64(uc.Limit)))
+	if totalPages > 0 && uc.Page > totalPages {
+		datas = []Site{}
+	}
+
+	uc.TotalData = total
+	return datas, nil
+}
+
+func (uc *UsecaseHandler) Create(param *Site) error {
+	// validate input
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(param.Timezone); err != nil {
+		return errors.New("Invalid timezone " + param.Timezone)
+	}
+
+	// validate contact id is valid
+	if param.ContactID != nil && *param.ContactID != "" {
+		contactUC := contact.UsecaseHandler{
+			Ctx: uc.Ctx,
+		}
+		if _, err := contactUC.GetByID(*param.ContactID); err != nil {
+			return err
+		}
+	}
+
+	param.ID = primitive.NewObjectID()
+	param.SiteID = param.ID.Hex()
+	param.CreatedAt = time.Now()
+	param.UpdatedAt = time.Now()
+
+	if param.Zones == nil {
+		param.Zones = []Zone{}
+	}
+	for k := range param.Zones {
+		if err := prepareZone(&param.Zones[k]); err != nil {
+			return err
+		}
+	}
+
+	_, err := Collection().InsertOne(uc.Ctx, param)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (uc *UsecaseHandler) GetByID(id string) (*Site, error) {
+	var data Site
+	err := Collection().FindOne(uc.Ctx, bson.M{"site_id": id}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + ModuleName + " with id " + id + " is not found")
+		}
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (uc *UsecaseHandler) UpdateByID(id string, param *Site) error {
+	// validate id exists
+	oldData, err := uc.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	// validate input
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(param.Timezone); err != nil {
+		return errors.New("Invalid timezone " + param.Timezone)
+	}
+
+	// validate contact id is valid
+	if param.ContactID != nil && *param.ContactID != "" {
+		contactUC := contact.UsecaseHandler{
+			Ctx: uc.Ctx,
+		}
+		if _, err := contactUC.GetByID(*param.ContactID); err != nil {
+			return err
+		}
+	}
+
+	param.ID = oldData.ID
+	param.SiteID = oldData.SiteID
+	param.CreatedAt = oldData.CreatedAt
+	param.UpdatedAt = time.Now()
+
+	// zones managed by zone endpoint
+	param.Zones = oldData.Zones
+
+	filter := bson.M{"site_id": id}
+	update := bson.M{"$set": param}
+	_, err = Collection().UpdateOne(uc.Ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (uc *UsecaseHandler) DeleteByID(id string) error {
+	// validate id exists
+	_, err := uc.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	// checked inside the transaction so a cctv, recorder or window added meanwhile is not left pointing to the deleted site,
+	// finished maintenance windows are kept as history
+	return database.WithTransaction(uc.Ctx, func(sc mongo.SessionContext) error {
+		for _, v := range []struct {
+			collection *mongo.Collection
+			filter     bson.M
+			message    string
+		}{
+			{CctvCollection(), bson.M{"site_id": id}, "Site still has CCTV assigned, move them first"},
+			{RecorderCollection(), bson.M{"site_id": id}, "Site still has recorder assigned, move them first"},
+			{
+				MaintenanceCollection(),
+				bson.M{"site_id": id, "state": bson.M{"$in": []string{"scheduled", "active"}}},
+				"Site still has scheduled or active maintenance window, cancel them first",
+			},
+		} {
+			count, err := v.collection.CountDocuments(sc, v.filter)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return errors.New(v.message)
+			}
+		}
+
+		// escalation policy of the site has no use without it
+		if _, err := EscalationCollection().DeleteOne(sc, bson.M{"site_id": id}); err != nil {
+			return err
+		}
+
+		_, err := Collection().DeleteOne(sc, bson.M{"site_id": id})
+		return err
+	})
+}
+
+func (uc *UsecaseHandler) CreateZone(siteID string, param *Zone) error {
+	// validate site exists
+	if _, err := uc.GetByID(siteID); err != nil {
+		return err
+	}
+
+	if err := prepareZone(param); err != nil {
+		return err
+	}
+
+	filter := bson.M{"site_id": siteID}
+	update := bson.M{
+		"$push": bson.M{"zones": param},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+	_, err := Collection().UpdateOne(uc.Ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (uc *UsecaseHandler) UpdateZone(siteID, zoneID string, param *Zone) error {
+	// validate zone exists
+	oldData, err := uc.GetZone(siteID, zoneID)
+	if err != nil {
+		return err
+	}
+
+	// validate input
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+
+	param.ZoneID = oldData.ZoneID
+	param.CreatedAt = oldData.CreatedAt
+	param.UpdatedAt = time.Now()
+
+	filter := bson.M{"site_id": siteID, "zones.zone_id": zoneID}
+	update := bson.M{"$set": bson.M{
+		"zones.$":    param,
+		"updated_at": time.Now(),
+	}}
+	_, err = Collection().UpdateOne(uc.Ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (uc *UsecaseHandler) DeleteZone(siteID, zoneID string) error {
+	// validate zone exists
+	if _, err := uc.GetZone(siteID, zoneID); err != nil {
+		return err
+	}
+
+	// validate zone has no cctv
+	count, err := CctvCollection().CountDocuments(uc.Ctx, bson.M{"site_id": siteID, "zone_id": zoneID})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("Zone still has CCTV assigned, move them first")
+	}
+
+	filter := bson.M{"site_id": siteID}
+	update := bson.M{
+		"$pull": bson.M{"zones": bson.M{"zone_id": zoneID}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+	_, err = Collection().UpdateOne(uc.Ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetZone return zone of the site, also used to validate cctv site & zone
+func (uc *UsecaseHandler) GetZone(siteID, zoneID string) (*Zone, error) {
+	data, err := uc.GetByID(siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range data.Zones {
+		if v.ZoneID == zoneID {
+			return &v, nil
+		}
+	}
+	return nil, errors.New("Data Zone with id " + zoneID + " is not found in " + ModuleName + " " + siteID)
+}
+
+// GetTree return sites with their zones, each node has camera count and status rollup
+func (uc *UsecaseHandler) GetTree() ([]SiteNode, error) {
+	filter := uc.FilterAndSort.SetFilter()
+	opts := options.Find().SetSort(uc.FilterAndSort.SetSort())
+
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var sites []Site
+	if err := cur.All(uc.Ctx, &sites); err != nil {
+		return nil, err
+	}
+
+	siteIDs := make([]string, 0, len(sites))
+	for _, v := range sites {
+		siteIDs = append(siteIDs, v.SiteID)
+	}
+
+	// count cctv per site, zone and status
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"site_id": bson.M{"$in": siteIDs}}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"site_id": "$site_id",
+				"zone_id": "$zone_id",
+				"status":  "$status",
+			},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+	aggCur, err := CctvCollection().Aggregate(uc.Ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer aggCur.Close(uc.Ctx)
+
+	var counts []struct {
+		ID struct {
+			SiteID string `bson:"site_id"`
+			ZoneID string `bson:"zone_id"`
+			Status string `bson:"status"`
+		} `bson:"_id"`
+		Count int64 `bson:"count"`
+	}
+	if err := aggCur.All(uc.Ctx, &counts); err != nil {
+		return nil, err
+	}
+
+	// index the counts, zone "" mean cctv without zone
+	type key struct{ site, zone string }
+	rollup := map[key]map[string]int64{}
+	for _, v := range counts {
+		k := key{v.ID.SiteID, v.ID.ZoneID}
+		if rollup[k] == nil {
+			rollup[k] = map[string]int64{}
+		}
+		rollup[k][v.ID.Status] += v.Count
+	}
+
+	nodes := make([]SiteNode, 0, len(sites))
+	for _, s := range sites {
+		node := SiteNode{
+			SiteID:   s.SiteID,
+			Name:     s.Name,
+			Address:  s.Address,
+			Timezone: s.Timezone,
+			Status:   map[string]int64{},
+			Zones:    []ZoneNode{},
+		}
+
+		knownZones := map[string]bool{"": true}
+		for _, z := range s.Zones {
+			knownZones[z.ZoneID] = true
+			zn := ZoneNode{
+				ZoneID: z.ZoneID,
+				Name:   z.Name,
+				Type:   z.Type,
+				Status: map[string]int64{},
+			}
+			addRollup(&zn, &node, rollup[key{s.SiteID, z.ZoneID}])
+			node.Zones = append(node.Zones, zn)
+		}
+
+		// cctv without zone or with a zone that no longer exists
+		node.Unzoned = ZoneNode{Status: map[string]int64{}}
+		for k, v := range rollup {
+			if k.site == s.SiteID && (k.zone == "" || !knownZones[k.zone]) {
+				addRollup(&node.Unzoned, &node, v)
+			}
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+func addRollup(zone *ZoneNode, site *SiteNode, status map[string]int64) {
+	for st, count := range status {
+		zone.Status[st] += count
+		zone.CameraCount += count
+		site.Status[st] += count
+		site.CameraCount += count
+	}
+}
+
+func prepareZone(param *Zone) error {
+	if err := valildator.Struct(param); err != nil {
+		return err
+	}
+
+	param.ZoneID = primitive.NewObjectID().Hex()
+	param.CreatedAt = time.Now()
+	param.UpdatedAt = time.Now()
+	return nil
+}
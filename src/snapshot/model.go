@@ -0,0 +1,45 @@
+package snapshot
+
+import (
+	"context"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Snapshot struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	SnapshotID  string             `json:"snapshot_id"         bson:"snapshot_id,omitempty"`
+	CctvID      string             `json:"cctv_id"             bson:"cctv_id,omitempty"`
+	StorageKey  string             `json:"-"                   bson:"storage_key,omitempty"`
+	ThumbKey    string             `json:"-"                   bson:"thumb_key,omitempty"`
+	ContentType string             `json:"content_type"        bson:"content_type,omitempty"`
+	Size        int64              `json:"size"                bson:"size,omitempty"`
+	Source      string             `json:"source"              bson:"source,omitempty"` // manual or schedule
+	CapturedAt  time.Time          `json:"captured_at"         bson:"captured_at,omitempty"`
+}
+
+const (
+	SourceManual   = "manual"
+	SourceSchedule = "schedule"
+)
+
+// whitelist field can be sorted
+var AllowedSortFields = map[string]bool{
+	"captured_at": true,
+	"size":        true,
+}
+
+func Collection() *mongo.Collection {
+	return database.OpenCollection("snapshots")
+}
+
+func EnsureIndexes(ctx context.Context) error {
+	_, err := Collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "cctv_id", Value: 1}, {Key: "captured_at", Value: -1}},
+	})
+	return err
+}
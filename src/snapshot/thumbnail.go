@@ -0,0 +1,96 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+)
+
+// thumbnail width in pixel
+const thumbnailWidth = 320
+
+// max width x height of a snapshot, a small file may declare a huge image which is only allocated on decode
+const maxSnapshotPixels = 50 * 1000 * 1000
+
+// makeThumbnail downscale jpeg with box sampling, image smaller than thumbnail is kept as is
+func makeThumbnail(src []byte) ([]byte, error) {
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxSnapshotPixels {
+		return nil, errors.New("image is larger than 50 megapixel")
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	if b.Dx() <= thumbnailWidth {
+		return src, nil
+	}
+
+	w := thumbnailWidth
+	h := b.Dy() * w / b.Dx()
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := b.Min.Y + (y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := b.Min.X + (x+1)*b.Dx()/w
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2] = boxAverage(img, image.Rect(x0, y0, x1, y1))
+			dst.Pix[i+3] = 0xff
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// boxAverage mean color of the box, camera jpeg decode to YCbCr or Gray whose planes are read directly
+func boxAverage(img image.Image, box image.Rectangle) (uint8, uint8, uint8) {
+	var r, g, b, n uint64
+	switch m := img.(type) {
+	case *image.YCbCr:
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			for x := box.Min.X; x < box.Max.X; x++ {
+				yi, ci := m.YOffset(x, y), m.COffset(x, y)
+				cr, cg, cb := color.YCbCrToRGB(m.Y[yi], m.Cb[ci], m.Cr[ci])
+				r, g, b, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), n+1
+			}
+		}
+	case *image.Gray:
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			row := m.Pix[m.PixOffset(box.Min.X, y):m.PixOffset(box.Max.X, y)]
+			for _, v := range row {
+				r, n = r+uint64(v), n+1
+			}
+		}
+		g, b = r, r
+	default:
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			for x := box.Min.X; x < box.Max.X; x++ {
+				cr, cg, cb, _ := img.At(x, y).RGBA()
+				r, g, b, n = r+uint64(cr>>8), g+uint64(cg>>8), b+uint64(cb>>8), n+1
+			}
+		}
+	}
+	if n == 0 {
+		n = 1
+	}
+	return uint8(r / n), uint8(g / n), uint8(b / n)
+}
@@ -0,0 +1,289 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/config"
+	"github.com/maulanar/gin-kecilin/src/cctv"
+	"github.com/maulanar/gin-kecilin/storage"
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// max snapshot size, 10 MB
+const maxSnapshotSize = 10 << 20
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// adjustable depending on usecase
+type UsecaseHandler struct {
+	Ctx           context.Context
+	Page          int64
+	Limit         int64
+	TotalData     int64
+	FilterAndSort utils.HelperUsecaseHandler
+}
+
+// Get snapshot history of a cctv
+func (uc *UsecaseHandler) Get(cctvID string) ([]Snapshot, error) {
+	if uc.Page < 1 {
+		uc.Page = 1
+	}
+	if uc.Limit < 1 {
+		uc.Limit = 10
+	}
+
+	filter := uc.FilterAndSort.SetFilter() // dynamic filter by query param
+	sort := uc.FilterAndSort.SetSort()     // dynamic sort by query param
+	skip := (uc.Page - 1) * uc.Limit       // offset
+	filter["cctv_id"] = cctvID
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "captured_at", Value: -1}}
+	}
+	opts := options.Find().
+		SetSort(sort).
+		SetSkip(skip).
+		SetLimit(uc.Limit)
+
+	// total docs
+	total, err := Collection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var datas []Snapshot
+	if err := cur.All(uc.Ctx, &datas); err != nil {
+		return nil, err
+	}
+
+	totalPages := int64(math.Ceil(float64(total) / float64(uc.Limit)))
+	if totalPages > 0 && uc.Page > totalPages {
+		datas = []Snapshot{}
+	}
+
+	uc.TotalData = total
+	return datas, nil
+}
+
+// GetByID return snapshot of the cctv, empty id mean the latest one
+func (uc *UsecaseHandler) GetByID(cctvID, id string) (*Snapshot, error) {
+	filter := bson.M{"cctv_id": cctvID}
+	if id != "" {
+		filter["snapshot_id"] = id
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "captured_at", Value: -1}})
+
+	var data Snapshot
+	err := Collection().FindOne(uc.Ctx, filter, opts).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + ModuleName + " of CCTV " + cctvID + " is not found")
+		}
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// Open return the image content of the snapshot, or its thumbnail
+func (uc *UsecaseHandler) Open(data *Snapshot, thumb bool) (io.ReadCloser, error) {
+	if thumb && data.ThumbKey != "" {
+		return storage.Blob.Get(uc.Ctx, data.ThumbKey)
+	}
+	return storage.Blob.Get(uc.Ctx, data.StorageKey)
+}
+
+// Capture fetch jpeg from cctv snapshot url and store it
+func (uc *UsecaseHandler) Capture(cctvID, source string) (*Snapshot, error) {
+	cctvUC := cctv.UsecaseHandler{
+		Ctx: uc.Ctx,
+	}
+	cred, err := cctvUC.RevealCredentials(cctvID)
+	if err != nil {
+		return nil, err
+	}
+	if cred.SnapshotURL == nil || *cred.SnapshotURL == "" {
+		return nil, errors.New("CCTV " + cctvID + " has no snapshot url")
+	}
+
+	req, err := http.NewRequestWithContext(uc.Ctx, http.MethodGet, *cred.SnapshotURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cred.Username != nil {
+		password := ""
+		if cred.Password != nil {
+			password = *cred.Password
+		}
+		req.SetBasicAuth(*cred.Username, password)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("Snapshot url respond with status " + strconv.Itoa(res.StatusCode))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxSnapshotSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxSnapshotSize {
+		return nil, errors.New("Snapshot is larger than 10 MB")
+	}
+	if http.DetectContentType(body) != "image/jpeg" {
+		return nil, errors.New("Snapshot url did not return a JPEG image")
+	}
+
+	data := Snapshot{
+		ID:          primitive.NewObjectID(),
+		CctvID:      cctvID,
+		ContentType: "image/jpeg",
+		Size:        int64(len(body)),
+		Source:      source,
+		CapturedAt:  time.Now(),
+	}
+	data.SnapshotID = data.ID.Hex()
+	data.StorageKey = "snapshots/" + cctvID + "/" + data.SnapshotID + ".jpg"
+	data.ThumbKey = "snapshots/" + cctvID + "/" + data.SnapshotID + "_thumb.jpg"
+
+	thumb, err := makeThumbnail(body)
+	if err != nil {
+		return nil, errors.New("Invalid JPEG snapshot: " + err.Error())
+	}
+
+	if err := storage.Blob.Put(uc.Ctx, data.StorageKey, bytes.NewReader(body)); err != nil {
+		return nil, err
+	}
+	if err := storage.Blob.Put(uc.Ctx, data.ThumbKey, bytes.NewReader(thumb)); err != nil {
+		_ = storage.Blob.Delete(uc.Ctx, data.StorageKey)
+		return nil, err
+	}
+
+	_, err = Collection().InsertOne(uc.Ctx, data)
+	if err != nil {
+		_ = storage.Blob.Delete(uc.Ctx, data.StorageKey)
+		_ = storage.Blob.Delete(uc.Ctx, data.ThumbKey)
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// Purge delete snapshot older than retention days
+func (uc *UsecaseHandler) Purge(retentionDays int) (int64, error) {
+	if retentionDays <= 0 {
+		return 0, nil
+	}
+	filter := bson.M{"captured_at": bson.M{"$lt": time.Now().AddDate(0, 0, -retentionDays)}}
+
+	cur, err := Collection().Find(uc.Ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var deleted int64
+	for cur.Next(uc.Ctx) {
+		var data Snapshot
+		if err := cur.Decode(&data); err != nil {
+			return deleted, err
+		}
+		if err := storage.Blob.Delete(uc.Ctx, data.StorageKey); err != nil {
+			return deleted, err
+		}
+		if data.ThumbKey != "" {
+			if err := storage.Blob.Delete(uc.Ctx, data.ThumbKey); err != nil {
+				return deleted, err
+			}
+		}
+		if _, err := Collection().DeleteOne(uc.Ctx, bson.M{"snapshot_id": data.SnapshotID}); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, cur.Err()
+}
+
+// RunScheduler capture snapshot of every active cctv with credentials on SNAPSHOT_INTERVAL,
+// and purge old snapshot. Block until ctx is done
+func RunScheduler(ctx context.Context) {
+	if config.SNAPSHOT_INTERVAL <= 0 {
+		log.Println("Snapshot scheduler is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(config.SNAPSHOT_INTERVAL) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runSchedule(ctx)
+		}
+	}
+}
+
+func runSchedule(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.SNAPSHOT_INTERVAL)*time.Minute)
+	defer cancel()
+
+	filter := bson.M{
+		"credentials": bson.M{"$exists": true},
+		"status":      bson.M{"$nin": cctv.InactiveStatuses},
+	}
+	opts := options.Find().SetProjection(bson.M{"cctv_id": 1})
+	cur, err := cctv.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Snapshot scheduler: %v", err)
+		return
+	}
+	defer cur.Close(ctx)
+
+	uc := UsecaseHandler{
+		Ctx: ctx,
+	}
+	for cur.Next(ctx) {
+		var v struct {
+			CctvID string `bson:"cctv_id"`
+		}
+		if err := cur.Decode(&v); err != nil {
+			log.Printf("Snapshot scheduler: %v", err)
+			return
+		}
+		if _, err := uc.Capture(v.CctvID, SourceSchedule); err != nil {
+			log.Printf("Snapshot scheduler: CCTV %s: %v", v.CctvID, err)
+		}
+	}
+
+	if deleted, err := uc.Purge(config.SNAPSHOT_RETENTION); err != nil {
+		log.Printf("Snapshot scheduler: purge: %v", err)
+	} else if deleted > 0 {
+		log.Printf("Snapshot scheduler: purged %d snapshot", deleted)
+	}
+}
@@ -0,0 +1,51 @@
+package statushistory
+
+import (
+	"context"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// one cctv status transition
+type StatusHistory struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	HistoryID string             `json:"history_id"          bson:"history_id,omitempty"`
+	CctvID    string             `json:"cctv_id"             bson:"cctv_id,omitempty"`
+	From      string             `json:"from"                bson:"from"`
+	To        string             `json:"to"                  bson:"to,omitempty"`
+	Reason    *string            `json:"reason"              bson:"reason,omitempty"`
+	Source    string             `json:"source"              bson:"source,omitempty"`
+	By        string             `json:"by,omitempty"        bson:"by,omitempty"`
+	ChangedAt time.Time          `json:"changed_at"          bson:"changed_at,omitempty"`
+}
+
+// who changed the status
+const (
+	SourceManual      = "manual"
+	SourceCreate      = "create"
+	SourceUpdate      = "update"
+	SourceMaintenance = "maintenance"
+	SourceRecorder    = "recorder"
+)
+
+// whitelist field can be sorted
+var AllowedSortFields = map[string]bool{
+	"changed_at": true,
+	"to":         true,
+	"from":       true,
+}
+
+func Collection() *mongo.Collection {
+	return database.OpenCollection("cctv_status_histories")
+}
+
+func EnsureIndexes(ctx context.Context) error {
+	_, err := Collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "cctv_id", Value: 1}, {Key: "changed_at", Value: 1}},
+	})
+	return err
+}
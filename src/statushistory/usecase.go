@@ -0,0 +1,99 @@
+package statushistory
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// adjustable depending on usecase
+type UsecaseHandler struct {
+	Ctx           context.Context
+	Page          int64
+	Limit         int64
+	TotalData     int64
+	FilterAndSort utils.HelperUsecaseHandler
+}
+
+// Get status history of a cctv, newest first by default
+func (uc *UsecaseHandler) Get(cctvID string) ([]StatusHistory, error) {
+	if uc.Page < 1 {
+		uc.Page = 1
+	}
+	if uc.Limit < 1 {
+		uc.Limit = 10
+	}
+
+	filter := uc.FilterAndSort.SetFilter() // dynamic filter by query param
+	sort := uc.FilterAndSort.SetSort()     // dynamic sort by query param
+	skip := (uc.Page - 1) * uc.Limit       // offset
+	filter["cctv_id"] = cctvID
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "changed_at", Value: -1}}
+	}
+	opts := options.Find().
+		SetSort(sort).
+		SetSkip(skip).
+		SetLimit(uc.Limit)
+
+	// total docs
+	total, err := Collection().CountDocuments(uc.Ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := Collection().Find(uc.Ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(uc.Ctx)
+
+	var datas []StatusHistory
+	if err := cur.All(uc.Ctx, &datas); err != nil {
+		return nil, err
+	}
+
+	totalPages := int64(math.Ceil(float64(total) / float64(uc.Limit)))
+	if totalPages > 0 && uc.Page > totalPages {
+		datas = []StatusHistory{}
+	}
+
+	uc.TotalData = total
+	return datas, nil
+}
+
+func (uc *UsecaseHandler) Create(param *StatusHistory) error {
+	param.ID = primitive.NewObjectID()
+	param.HistoryID = param.ID.Hex()
+	if param.ChangedAt.IsZero() {
+		param.ChangedAt = time.Now()
+	}
+
+	_, err := Collection().InsertOne(uc.Ctx, param)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Record write one transition
+func Record(ctx context.Context, cctvID, from, to string, reason *string, source, by string) error {
+	uc := UsecaseHandler{
+		Ctx: ctx,
+	}
+	return uc.Create(&StatusHistory{
+		CctvID: cctvID,
+		From:   from,
+		To:     to,
+		Reason: reason,
+		Source: source,
+		By:     by,
+	})
+}
@@ -0,0 +1,136 @@
+package stream
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// messages kept for client reconnecting with Last-Event-ID
+const replaySize = 500
+
+// buffered messages per subscriber, slow subscriber is dropped when full
+const subscriberBuffer = 64
+
+// published message with its encoded form
+type envelope struct {
+	Message
+	payload []byte
+}
+
+// Subscription receive every message published after it is created
+type Subscription struct {
+	C chan envelope
+}
+
+// in-process bus, fed by the usecases
+var bus = struct {
+	sync.Mutex
+	lastID uint64
+	subs   map[*Subscription]struct{}
+	recent []envelope
+}{
+	subs: map[*Subscription]struct{}{},
+}
+
+// Publish send a message to every subscriber without blocking the caller
+func Publish(msg Message) {
+	bus.Lock()
+	defer bus.Unlock()
+
+	bus.lastID++
+	msg.ID = bus.lastID
+	if msg.At.IsZero() {
+		msg.At = time.Now()
+	}
+
+	// encode now, data may be changed by the caller afterward
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Stream: failed to encode %s: %v", msg.Type, err)
+		return
+	}
+	env := envelope{Message: msg, payload: payload}
+
+	bus.recent = append(bus.recent, env)
+	if len(bus.recent) > replaySize {
+		bus.recent = bus.recent[len(bus.recent)-replaySize:]
+	}
+
+	for sub := range bus.subs {
+		select {
+		case sub.C <- env:
+		default:
+			// client will reconnect and replay from its Last-Event-ID
+			delete(bus.subs, sub)
+			close(sub.C)
+		}
+	}
+}
+
+// Subscribe return a new subscription, and the kept messages after lastID
+func Subscribe(lastID uint64) (*Subscription, []envelope) {
+	bus.Lock()
+	defer bus.Unlock()
+
+	sub := &Subscription{C: make(chan envelope, subscriberBuffer)}
+	bus.subs[sub] = struct{}{}
+
+	backlog := []envelope{}
+	if lastID > 0 {
+		for _, v := range bus.recent {
+			if v.ID > lastID {
+				backlog = append(backlog, v)
+			}
+		}
+	}
+	return sub, backlog
+}
+
+// Close stop the subscription
+func (s *Subscription) Close() {
+	bus.Lock()
+	defer bus.Unlock()
+
+	if _, ok := bus.subs[s]; ok {
+		delete(bus.subs, s)
+		close(s.C)
+	}
+}
+
+// Match check the message against the filter
+func (f *Filter) Match(msg *Message) bool {
+	if len(f.Types) > 0 && !matchType(f.Types, msg.Type) {
+		return false
+	}
+	if len(f.CctvIDs) > 0 && !contains(f.CctvIDs, msg.CctvID) {
+		return false
+	}
+	if len(f.ContactIDs) > 0 && !contains(f.ContactIDs, msg.ContactID) {
+		return false
+	}
+	if len(f.SiteIDs) > 0 && !contains(f.SiteIDs, msg.SiteID) {
+		return false
+	}
+	return true
+}
+
+func matchType(types []string, t string) bool {
+	for _, v := range types {
+		if v == t || strings.HasPrefix(t, v+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package stream
+
+import "testing"
+
+func TestFilterMatch(t *testing.T) {
+	msg := &Message{Type: CctvStatusChanged, CctvID: "cctv-1", ContactID: "c-1", SiteID: "s-1"}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty filter", Filter{}, true},
+		{"exact type", Filter{Types: []string{CctvStatusChanged}}, true},
+		{"resource prefix", Filter{Types: []string{"cctv"}}, true},
+		{"partial resource name", Filter{Types: []string{"cc"}}, false},
+		{"other type", Filter{Types: []string{"contact", CctvCreated}}, false},
+		{"cctv", Filter{CctvIDs: []string{"cctv-2", "cctv-1"}}, true},
+		{"other cctv", Filter{CctvIDs: []string{"cctv-2"}}, false},
+		{"contact and site", Filter{ContactIDs: []string{"c-1"}, SiteIDs: []string{"s-1"}}, true},
+		{"other site", Filter{ContactIDs: []string{"c-1"}, SiteIDs: []string{"s-2"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(msg); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	first, _ := Subscribe(0)
+	defer first.Close()
+
+	Publish(Message{Type: CctvCreated, CctvID: "cctv-1"})
+	Publish(Message{Type: CctvUpdated, CctvID: "cctv-1"})
+	lastID := (<-first.C).ID
+	<-first.C
+
+	// reconnect replay only the messages after the last seen id
+	second, backlog := Subscribe(lastID)
+	defer second.Close()
+	if len(backlog) != 1 || backlog[0].ID != lastID+1 || backlog[0].Type != CctvUpdated {
+		t.Errorf("Subscribe(%d) backlog = %+v, want only message %d", lastID, backlog, lastID+1)
+	}
+
+	// slow subscriber is dropped instead of blocking the publisher
+	for i := 0; i <= subscriberBuffer; i++ {
+		Publish(Message{Type: CctvUpdated, CctvID: "cctv-1"})
+	}
+	count := 0
+	for range second.C {
+		count++
+	}
+	if count != subscriberBuffer {
+		t.Errorf("slow subscriber received %d messages, want %d before being dropped", count, subscriberBuffer)
+	}
+}
@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keep proxies from closing idle stream
+const heartbeatInterval = 25 * time.Second
+
+// StreamHandler push cctv & contact changes as Server-Sent Events
+func StreamHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := utils.GetClaims(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			return
+		}
+
+		filter := Filter{
+			Types:      queryList(c, "type"),
+			CctvIDs:    queryList(c, "cctv_id"),
+			ContactIDs: queryList(c, "contact_id"),
+			SiteIDs:    queryList(c, "site_id"),
+		}
+
+		// resume after the last received message
+		lastID, _ := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64)
+		if v := c.Query("last_event_id"); v != "" {
+			lastID, _ = strconv.ParseUint(v, 10, 64)
+		}
+
+		sub, backlog := Subscribe(lastID)
+		defer sub.Close()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.WriteString("retry: 3000\n\n")
+
+		send := func(env envelope) {
+			if !canReceive(claims, &env.Message) || !filter.Match(&env.Message) {
+				return
+			}
+			c.Writer.WriteString("id: " + strconv.FormatUint(env.ID, 10) + "\n")
+			c.Writer.WriteString("event: " + env.Type + "\n")
+			c.Writer.WriteString("data: " + string(env.payload) + "\n\n")
+		}
+
+		for _, env := range backlog {
+			send(env)
+		}
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case env, ok := <-sub.C:
+				if !ok {
+					// dropped for being too slow
+					return
+				}
+				send(env)
+				c.Writer.Flush()
+			case <-heartbeat.C:
+				c.Writer.WriteString(": ping\n\n")
+				c.Writer.Flush()
+			}
+		}
+	}
+}
+
+// canReceive check the caller is allowed to see the message
+func canReceive(claims *utils.Claims, msg *Message) bool {
+	switch claims.Role {
+	case utils.RoleAdmin, utils.RoleOperator, utils.RoleViewer, "":
+		return true
+	case utils.RoleCustomer:
+		// only change of their own contact and cctvs
+		return claims.ContactID != "" && msg.ContactID == claims.ContactID
+	}
+	return false
+}
+
+func queryList(c *gin.Context, key string) []string {
+	res := []string{}
+	for _, v := range c.QueryArray(key) {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				res = append(res, p)
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,37 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/maulanar/gin-kecilin/utils"
+)
+
+func TestCanReceive(t *testing.T) {
+	own := &Message{Type: CctvStatusChanged, CctvID: "cctv-1", ContactID: "c-1"}
+	other := &Message{Type: CctvStatusChanged, CctvID: "cctv-2", ContactID: "c-2"}
+	noContact := &Message{Type: CctvDeleted, CctvID: "cctv-3"}
+
+	tests := []struct {
+		name   string
+		claims utils.Claims
+		msg    *Message
+		want   bool
+	}{
+		{"admin", utils.Claims{Role: utils.RoleAdmin}, other, true},
+		{"operator", utils.Claims{Role: utils.RoleOperator}, other, true},
+		{"viewer", utils.Claims{Role: utils.RoleViewer}, noContact, true},
+		{"user without role", utils.Claims{}, other, true},
+		{"customer own contact", utils.Claims{Role: utils.RoleCustomer, ContactID: "c-1"}, own, true},
+		{"customer other contact", utils.Claims{Role: utils.RoleCustomer, ContactID: "c-1"}, other, false},
+		{"customer message without contact", utils.Claims{Role: utils.RoleCustomer, ContactID: "c-1"}, noContact, false},
+		{"customer without contact", utils.Claims{Role: utils.RoleCustomer}, noContact, false},
+		{"unknown role", utils.Claims{Role: "guest", ContactID: "c-1"}, own, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canReceive(&tt.claims, tt.msg); got != tt.want {
+				t.Errorf("canReceive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
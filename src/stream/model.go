@@ -0,0 +1,45 @@
+package stream
+
+import (
+	"time"
+)
+
+// type of message
+const (
+	CctvCreated       = "cctv.created"
+	CctvUpdated       = "cctv.updated"
+	CctvDeleted       = "cctv.deleted"
+	CctvStatusChanged = "cctv.status_changed"
+	ContactCreated    = "contact.created"
+	ContactUpdated    = "contact.updated"
+	ContactDeleted    = "contact.deleted"
+	ContactMerged     = "contact.merged"
+)
+
+// one change pushed to the subscribers
+type Message struct {
+	ID        uint64    `json:"id"`
+	Type      string    `json:"type"`
+	CctvID    string    `json:"cctv_id,omitempty"`
+	ContactID string    `json:"contact_id,omitempty"`
+	SiteID    string    `json:"site_id,omitempty"`
+	Data      any       `json:"data"`
+	At        time.Time `json:"at"`
+}
+
+// data of cctv.status_changed
+type StatusData struct {
+	CctvID string  `json:"cctv_id"`
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Reason *string `json:"reason,omitempty"`
+	Source string  `json:"source"`
+}
+
+// subscriber filter, empty field match everything
+type Filter struct {
+	Types      []string // exact type or resource prefix, e.g. "cctv"
+	CctvIDs    []string
+	ContactIDs []string
+	SiteIDs    []string
+}
@@ -48,6 +48,13 @@ func SignUp() gin.HandlerFunc {
 			return
 		}
 
+		// normalize phone
+		user.PhoneE164, err = utils.NormalizePhonePtr(user.Phone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		// encrypt password
 		user.Password, err = utils.HashPassword(user.Password)
 		if err != nil {
@@ -55,6 +62,19 @@ func SignUp() gin.HandlerFunc {
 			return
 		}
 
+		// only admin can choose the role and contact, public sign up is always viewer
+		claims, _ := c.Get("claims")
+		if tokenClaim, ok := claims.(*utils.Claims); !ok || tokenClaim.Role != utils.RoleAdmin || user.Role == "" {
+			user.Role = utils.RoleViewer
+			user.ContactID = nil
+		}
+		if user.ContactID != nil {
+			if err := validateContact(ctx, *user.ContactID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		// set param
 		user.CreatedAt = time.Now()
 		user.UpdatedAt = time.Now()
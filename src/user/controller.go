@@ -39,6 +39,8 @@ func GetHandler() gin.HandlerFunc {
 			}
 			filters[key] = values
 		}
+		// phone in any format
+		utils.PhoneFilters(filters)
 
 		uc := UsecaseHandler{
 			Ctx:   ctx,
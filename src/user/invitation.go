@@ -0,0 +1,228 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/config"
+	"github.com/maulanar/gin-kecilin/database"
+	"github.com/maulanar/gin-kecilin/src/contact"
+	"github.com/maulanar/gin-kecilin/src/notification"
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var InvitationModuleName = "Invitation"
+
+// text of the invitation email per language
+var invitationTemplates = map[string]struct{ subject, text string }{
+	"en": {
+		subject: "Your CCTV monitoring account",
+		text:    "Hello %s,\n\nYou are invited to see the status of your cameras. Open the link below to set your password, it is valid until %s.\n\n%s",
+	},
+	"id": {
+		subject: "Akun pemantauan CCTV Anda",
+		text:    "Halo %s,\n\nAnda diundang untuk melihat status kamera Anda. Buka link berikut untuk membuat password, berlaku sampai %s.\n\n%s",
+	},
+}
+
+// Invite create an invitation for the contact to log in as customer and email the link to the contact.
+// Older pending invitation of the contact is revoked
+func (uc *UsecaseHandler) Invite(contactID, by string) (*Invitation, error) {
+	var c contact.Contact
+	err := contact.Collection().FindOne(uc.Ctx, bson.M{"contact_id": contactID}).Decode(&c)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data Contact with id " + contactID + " is not found")
+		}
+		return nil, err
+	}
+	if c.Email == nil || *c.Email == "" {
+		return nil, errors.New("Contact has no email")
+	}
+
+	// validate email is not used yet
+	var existing User
+	err = Collection().FindOne(uc.Ctx, bson.M{"email": *c.Email}).Decode(&existing)
+	if err == nil {
+		if existing.ContactID != nil && *existing.ContactID == contactID {
+			return nil, errors.New("Contact already has an account")
+		}
+		return nil, errors.New("Email already exists")
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	data := Invitation{
+		ID:        primitive.NewObjectID(),
+		ContactID: contactID,
+		Email:     *c.Email,
+		FirstName: c.FirstName,
+		TokenHash: hashToken(hex.EncodeToString(token)),
+		Status:    InvitationPending,
+		InvitedBy: by,
+		ExpiresAt: now.Add(time.Duration(config.INVITATION_TTL_HOURS) * time.Hour),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	data.InvitationID = data.ID.Hex()
+
+	_, err = InvitationCollection().UpdateMany(uc.Ctx,
+		bson.M{"contact_id": contactID, "status": InvitationPending},
+		bson.M{"$set": bson.M{"status": InvitationRevoked, "updated_at": now}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := InvitationCollection().InsertOne(uc.Ctx, data); err != nil {
+		return nil, err
+	}
+
+	data.URL = strings.TrimRight(config.PUBLIC_URL, "/") + "/api/invitations/" + hex.EncodeToString(token)
+
+	// link is also returned, so it can be sent by hand when email fails
+	tpl, ok := invitationTemplates[c.NotificationLanguage()]
+	if !ok {
+		tpl = invitationTemplates["en"]
+	}
+	name := ""
+	if c.FirstName != nil {
+		name = *c.FirstName
+	}
+	expires := data.ExpiresAt.In(c.Location()).Format("2006-01-02 15:04 MST")
+	err = notification.SendEmail(data.Email, tpl.subject, fmt.Sprintf(tpl.text, name, expires, data.URL))
+	if err != nil {
+		log.Printf("Failed to email invitation %s: %v", data.InvitationID, err)
+	}
+	data.EmailSent = err == nil
+
+	return &data, nil
+}
+
+// GetInvitation pending invitation of the token
+func (uc *UsecaseHandler) GetInvitation(token string) (*Invitation, error) {
+	var data Invitation
+	err := InvitationCollection().FindOne(uc.Ctx, bson.M{"token_hash": hashToken(token)}).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data " + InvitationModuleName + " is not found")
+		}
+		return nil, err
+	}
+	if data.Status != InvitationPending {
+		return nil, errors.New(InvitationModuleName + " is already " + data.Status)
+	}
+	if time.Now().After(data.ExpiresAt) {
+		return nil, errors.New(InvitationModuleName + " has expired")
+	}
+	return &data, nil
+}
+
+// AcceptInvitation create the customer account of the invited contact, already logged in
+func (uc *UsecaseHandler) AcceptInvitation(token string, param *AcceptParam) (*User, error) {
+	if err := valildator.Struct(param); err != nil {
+		return nil, err
+	}
+	inv, err := uc.GetInvitation(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// contact may be merged after it was invited
+	contactID := inv.ContactID
+	contactUC := contact.UsecaseHandler{Ctx: uc.Ctx}
+	if target, err := contactUC.ResolveRedirect(contactID); err == nil {
+		contactID = target
+	}
+	var c contact.Contact
+	err = contact.Collection().FindOne(uc.Ctx, bson.M{"contact_id": contactID}).Decode(&c)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Data Contact with id " + contactID + " is not found")
+		}
+		return nil, err
+	}
+
+	count, err := Collection().CountDocuments(uc.Ctx, bson.M{"email": inv.Email})
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("Email already exists")
+	}
+
+	password, err := utils.HashPassword(param.Password)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	email := inv.Email
+	data := User{
+		ID:        primitive.NewObjectID(),
+		FirstName: c.FirstName,
+		LastName:  c.LastName,
+		Email:     &email,
+		Password:  password,
+		Phone:     c.Phone,
+		PhoneE164: c.PhoneE164,
+		Role:      utils.RoleCustomer,
+		ContactID: &contactID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	data.UserID = data.ID.Hex()
+
+	accessToken, refreshToken, err := utils.GenerateToken(email, data.UserID)
+	if err != nil {
+		return nil, err
+	}
+	data.Token = &accessToken
+	data.RefreshToken = &refreshToken
+
+	err = database.WithTransaction(uc.Ctx, func(sc mongo.SessionContext) error {
+		// accepted only once
+		res, err := InvitationCollection().UpdateOne(sc,
+			bson.M{"invitation_id": inv.InvitationID, "status": InvitationPending},
+			bson.M{"$set": bson.M{
+				"status":      InvitationAccepted,
+				"accepted_at": now,
+				"user_id":     data.UserID,
+				"updated_at":  now,
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount == 0 {
+			return errors.New(InvitationModuleName + " is already accepted")
+		}
+		_, err = Collection().InsertOne(sc, data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data.Password = nil
+	return &data, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,107 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/maulanar/gin-kecilin/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InviteHandler invite the contact of the path to log in as customer
+func InviteHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			GinCtx: c,
+			Ctx:    ctx,
+		}
+
+		by := ""
+		if claims, ok := utils.GetClaims(c); ok {
+			by = claims.Email
+		}
+		data, err := uc.Invite(id, by)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:     http.StatusText(http.StatusCreated),
+			Message:    InvitationModuleName + " created successfully",
+			Data:       data,
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusCreated, resp.BuildSingleResponse())
+	}
+}
+
+// GetInvitationHandler show who is invited, no login needed
+func GetInvitationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			GinCtx: c,
+			Ctx:    ctx,
+		}
+
+		data, err := uc.GetInvitation(c.Param("token"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := utils.Response{
+			Status:  http.StatusText(http.StatusOK),
+			Message: "Successfully get " + InvitationModuleName,
+			Data: gin.H{
+				"email":      data.Email,
+				"first_name": data.FirstName,
+				"expires_at": data.ExpiresAt,
+			},
+			Pagination: utils.Pagination{},
+		}
+		c.JSON(http.StatusOK, resp.BuildSingleResponse())
+	}
+}
+
+// AcceptInvitationHandler set the password of the invited contact, the token is the credential
+func AcceptInvitationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		uc := UsecaseHandler{
+			GinCtx: c,
+			Ctx:    ctx,
+		}
+
+		param := AcceptParam{}
+		if err := c.BindJSON(&param); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		data, err := uc.AcceptInvitation(c.Param("token"), &param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message":       "Invitation accepted successfully",
+			"user":          data,
+			"token":         data.Token,
+			"refresh_token": data.RefreshToken,
+		})
+	}
+}
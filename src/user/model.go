@@ -1,11 +1,14 @@
 package user
 
 import (
+	"context"
 	"time"
 
 	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type User struct {
@@ -15,6 +18,9 @@ type User struct {
 	Email        *string            `json:"email"                   validate:"required,email,min=2"   bson:"email,omitempty"`
 	Password     *string            `json:"password"                validate:"required,min=2,max=100" bson:"password,omitempty"`
 	Phone        *string            `json:"phone,omitempty"         validate:""                       bson:"phone,omitempty"`
+	PhoneE164    *string            `json:"phone_e164,omitempty"    bson:"phone_e164,omitempty"` // normalized phone, phone keep the number as written
+	Role         string             `json:"role,omitempty"          validate:"omitempty,oneof=admin operator viewer customer" bson:"role,omitempty"`
+	ContactID    *string            `json:"contact_id,omitempty"    validate:"required_if=Role customer" bson:"contact_id,omitempty"` // contact of a customer
 	Token        *string            `json:"token,omitempty"         validate:""                       bson:"token,omitempty"`
 	RefreshToken *string            `json:"refresh_token,omitempty" validate:""                       bson:"refresh_token,omitempty"`
 	CreatedAt    time.Time          `json:"created_at"              bson:"created_at,omitempty"`
@@ -34,3 +40,48 @@ var AllowedSortFields = map[string]bool{
 func Collection() *mongo.Collection {
 	return database.OpenCollection("users")
 }
+
+// status of an invitation
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked" // replaced by a newer invitation of the contact
+)
+
+// Invitation let a contact create a customer account, only the hash of the token is stored
+type Invitation struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	InvitationID string             `json:"invitation_id"       bson:"invitation_id"`
+	ContactID    string             `json:"contact_id"          bson:"contact_id"`
+	Email        string             `json:"email"               bson:"email"`
+	FirstName    *string            `json:"first_name"          bson:"first_name,omitempty"`
+	TokenHash    string             `json:"-"                   bson:"token_hash"`
+	Status       string             `json:"status"              bson:"status"`
+	InvitedBy    string             `json:"invited_by"          bson:"invited_by"`
+	UserID       *string            `json:"user_id,omitempty"   bson:"user_id,omitempty"`
+	ExpiresAt    time.Time          `json:"expires_at"          bson:"expires_at"`
+	AcceptedAt   *time.Time         `json:"accepted_at,omitempty" bson:"accepted_at,omitempty"`
+	CreatedAt    time.Time          `json:"created_at"          bson:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at"          bson:"updated_at"`
+
+	// link sent to the contact, only shown when the invitation is created
+	URL       string `json:"url,omitempty"       bson:"-"`
+	EmailSent bool   `json:"email_sent"          bson:"-"`
+}
+
+// AcceptParam password of the new customer account
+type AcceptParam struct {
+	Password *string `json:"password"            validate:"required,min=8,max=100"`
+}
+
+func InvitationCollection() *mongo.Collection {
+	return database.OpenCollection("invitations")
+}
+
+func EnsureIndexes(ctx context.Context) error {
+	_, err := InvitationCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "contact_id", Value: 1}, {Key: "status", Value: 1}}},
+	})
+	return err
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 	"time"
 
+	"github.com/maulanar/gin-kecilin/database"
 	"github.com/maulanar/gin-kecilin/utils"
 
 	"github.com/gin-gonic/gin"
@@ -110,6 +111,36 @@ func (uc *UsecaseHandler) UpdateByID(id string, param *User) error {
 		}
 	}
 
+	// only admin can change role
+	if param.Role != "" && param.Role != oldData.Role {
+		claims, _ := uc.GinCtx.Get("claims")
+		tokenClaim, ok := claims.(*utils.Claims)
+		if !ok || tokenClaim.Role != utils.RoleAdmin {
+			return errors.New("Only admin can change user role")
+		}
+	}
+
+	// only admin can link the user to a contact
+	if param.ContactID != nil && (oldData.ContactID == nil || *oldData.ContactID != *param.ContactID) {
+		claims, _ := uc.GinCtx.Get("claims")
+		tokenClaim, ok := claims.(*utils.Claims)
+		if !ok || tokenClaim.Role != utils.RoleAdmin {
+			return errors.New("Only admin can change user contact")
+		}
+		if err := validateContact(uc.Ctx, *param.ContactID); err != nil {
+			return err
+		}
+	}
+	if param.Role == utils.RoleCustomer && param.ContactID == nil && oldData.ContactID == nil {
+		return errors.New("Customer must be linked to a contact")
+	}
+
+	// normalize phone
+	param.PhoneE164, err = utils.NormalizePhonePtr(param.Phone)
+	if err != nil {
+		return err
+	}
+
 	// if password changed
 	if param.Password != nil {
 		// encrypt password
@@ -130,6 +161,18 @@ func (uc *UsecaseHandler) UpdateByID(id string, param *User) error {
 	return nil
 }
 
+// validateContact validate the contact of a customer exists
+func validateContact(ctx context.Context, contactID string) error {
+	count, err := database.OpenCollection("contacts").CountDocuments(ctx, bson.M{"contact_id": contactID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("Data Contact with id " + contactID + " is not found")
+	}
+	return nil
+}
+
 func (uc *UsecaseHandler) DeleteByID(id string) error {
 	// validate id exists
 	_, err := uc.GetByID(id)
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/maulanar/gin-kecilin/config"
+)
+
+var ErrNotFound = errors.New("Blob is not found")
+
+// pluggable blob storage, key is a slash separated path
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var Blob Storage
+
+func Init() {
+	var err error
+	Blob, err = New(config.STORAGE_DRIVER)
+	if err != nil {
+		log.Fatalf("Failed to init storage: %v", err)
+	}
+	log.Println("Storage driver:", config.STORAGE_DRIVER)
+}
+
+func New(driver string) (Storage, error) {
+	switch driver {
+	case "", "local":
+		return NewLocal(config.STORAGE_PATH)
+	default:
+		return nil, errors.New("Unsupported storage driver " + driver)
+	}
+}
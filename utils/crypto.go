@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// envelope encryption, every value is encrypted with its own data key,
+// the data key is wrapped by a master key identified by KeyID
+type EncryptedValue struct {
+	KeyID      string `bson:"key_id"`
+	WrappedKey []byte `bson:"wrapped_key"`
+	Ciphertext []byte `bson:"ciphertext"`
+}
+
+var (
+	masterKeys  = map[string][]byte{}
+	activeKeyID string
+)
+
+// SetCredentialKeys parse master keys with format "id1:base64key,id2:base64key",
+// activeID is the key used to wrap new data key, the others are kept for decrypt & rotation
+func SetCredentialKeys(keys, activeID string) error {
+	parsed := map[string][]byte{}
+	for _, v := range strings.Split(keys, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(v, ":")
+		if !ok || id == "" {
+			return errors.New("Invalid credential key format, must be id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return errors.New("Invalid credential key " + id + ", must be base64 encoded")
+		}
+		if len(key) != 32 {
+			return errors.New("Invalid credential key " + id + ", must be 32 bytes")
+		}
+		parsed[id] = key
+	}
+
+	if len(parsed) > 0 {
+		if activeID == "" {
+			return errors.New("Active credential key id is not set")
+		}
+		if _, ok := parsed[activeID]; !ok {
+			return errors.New("Active credential key " + activeID + " is not found")
+		}
+	}
+
+	masterKeys = parsed
+	activeKeyID = activeID
+	return nil
+}
+
+func ActiveCredentialKeyID() string {
+	return activeKeyID
+}
+
+func Encrypt(plain []byte) (*EncryptedValue, error) {
+	master, ok := masterKeys[activeKeyID]
+	if !ok {
+		return nil, errors.New("Credential encryption key is not configured")
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := sealAESGCM(dataKey, plain)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := sealAESGCM(master, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedValue{
+		KeyID:      activeKeyID,
+		WrappedKey: wrappedKey,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+func Decrypt(v *EncryptedValue) ([]byte, error) {
+	dataKey, err := unwrapKey(v)
+	if err != nil {
+		return nil, err
+	}
+	return openAESGCM(dataKey, v.Ciphertext)
+}
+
+// Rewrap wrap the data key again with the active master key,
+// ciphertext is untouched. Return false when already using active key
+func Rewrap(v *EncryptedValue) (bool, error) {
+	if v.KeyID == activeKeyID {
+		return false, nil
+	}
+	master, ok := masterKeys[activeKeyID]
+	if !ok {
+		return false, errors.New("Credential encryption key is not configured")
+	}
+
+	dataKey, err := unwrapKey(v)
+	if err != nil {
+		return false, err
+	}
+	wrappedKey, err := sealAESGCM(master, dataKey)
+	if err != nil {
+		return false, err
+	}
+
+	v.KeyID = activeKeyID
+	v.WrappedKey = wrappedKey
+	return true, nil
+}
+
+func unwrapKey(v *EncryptedValue) ([]byte, error) {
+	master, ok := masterKeys[v.KeyID]
+	if !ok {
+		return nil, errors.New("Credential key " + v.KeyID + " is not configured")
+	}
+	return openAESGCM(master, v.WrappedKey)
+}
+
+// sealAESGCM return nonce + ciphertext
+func sealAESGCM(key, plain []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func openAESGCM(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("Invalid encrypted value")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
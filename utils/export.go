@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// supported export format
+const (
+	ExportCSV    = "csv"
+	ExportXLSX   = "xlsx"
+	ExportNDJSON = "ndjson"
+)
+
+var ExportContentTypes = map[string]string{
+	ExportCSV:    "text/csv; charset=utf-8",
+	ExportXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	ExportNDJSON: "application/x-ndjson",
+}
+
+// ExportWriter write exported rows, values follow the columns order
+type ExportWriter interface {
+	Write(values []interface{}) error
+	Close() error
+}
+
+// NewExportWriter create a writer of the format, csv and xlsx start with a header row
+func NewExportWriter(format string, w io.Writer, columns []string) (ExportWriter, error) {
+	header := make([]interface{}, len(columns))
+	for i, v := range columns {
+		header[i] = v
+	}
+
+	switch format {
+	case ExportCSV:
+		ew := &csvExportWriter{w: csv.NewWriter(w)}
+		return ew, ew.Write(header)
+	case ExportXLSX:
+		xw, err := NewXLSXWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return xw, xw.WriteRow(header)
+	case ExportNDJSON:
+		return &ndjsonExportWriter{enc: json.NewEncoder(w), columns: columns}, nil
+	}
+	return nil, errors.New("Format must be csv, xlsx or ndjson")
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *csvExportWriter) Write(values []interface{}) error {
+	row := make([]string, len(values))
+	for i, v := range values {
+		row[i] = FormatCell(v)
+		if !isNumber(v) {
+			row[i] = EscapeFormula(row[i])
+		}
+	}
+	return e.w.Write(row)
+}
+
+func (e *csvExportWriter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonExportWriter struct {
+	enc     *json.Encoder
+	columns []string
+}
+
+// Write one object per line, keyed by column
+func (e *ndjsonExportWriter) Write(values []interface{}) error {
+	obj := orderedObject{}
+	for i, v := range values {
+		obj = append(obj, bson.E{Key: e.columns[i], Value: jsonValue(v)})
+	}
+	return e.enc.Encode(obj)
+}
+
+func (e *ndjsonExportWriter) Close() error {
+	return nil
+}
+
+// Write satisfy ExportWriter
+func (x *XLSXWriter) Write(values []interface{}) error {
+	return x.WriteRow(values)
+}
+
+// orderedObject marshal as JSON object keeping the key order
+type orderedObject bson.D
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, v := range o {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key, _ := json.Marshal(v.Key)
+		val, err := json.Marshal(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(val)
+	}
+	b.WriteString("}")
+	return []byte(b.String()), nil
+}
+
+// DocValue get value of a dotted path from a decoded document, array index is allowed, e.g. "coordinates.coordinates.1"
+func DocValue(doc interface{}, path string) interface{} {
+	cur := doc
+	for _, key := range strings.Split(path, ".") {
+		switch v := cur.(type) {
+		case bson.M:
+			cur = v[key]
+		case bson.D:
+			cur = v.Map()[key]
+		case bson.A:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil
+			}
+			cur = v[idx]
+		default:
+			return nil
+		}
+	}
+	return cur
+}
+
+// FormatCell convert value to text of a csv or xlsx cell
+func FormatCell(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return n
+	case int:
+		return strconv.Itoa(n)
+	case int32:
+		return strconv.FormatInt(int64(n), 10)
+	case int64:
+		return strconv.FormatInt(n, 10)
+	case float32:
+		return strconv.FormatFloat(float64(n), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(n)
+	case time.Time:
+		return n.Format(time.RFC3339)
+	case primitive.DateTime:
+		return n.Time().UTC().Format(time.RFC3339)
+	case primitive.ObjectID:
+		return n.Hex()
+	}
+
+	b, err := json.Marshal(jsonValue(v))
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// EscapeFormula prefix text starting with a formula character with a quote,
+// so a spreadsheet opening the file show it as text instead of running it
+func EscapeFormula(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, int32, int64, float32, float64:
+		return true
+	}
+	return false
+}
+
+// jsonValue convert bson types to their plain JSON form
+func jsonValue(v interface{}) interface{} {
+	switch n := v.(type) {
+	case primitive.DateTime:
+		return n.Time().UTC()
+	case primitive.ObjectID:
+		return n.Hex()
+	case bson.D:
+		m := orderedObject{}
+		for _, e := range n {
+			m = append(m, bson.E{Key: e.Key, Value: jsonValue(e.Value)})
+		}
+		return m
+	case bson.M:
+		m := map[string]interface{}{}
+		for k, e := range n {
+			m[k] = jsonValue(e)
+		}
+		return m
+	case bson.A:
+		a := make([]interface{}, len(n))
+		for i, e := range n {
+			a[i] = jsonValue(e)
+		}
+		return a
+	}
+	return v
+}
+
+// ParseExportColumns split the comma separated columns, default columns when empty
+func ParseExportColumns(param string, allowed map[string]string, defaults []string) ([]string, error) {
+	if strings.TrimSpace(param) == "" {
+		return defaults, nil
+	}
+
+	columns := []string{}
+	for _, v := range strings.Split(param, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if _, ok := allowed[v]; !ok {
+			return nil, errors.New("Unknown export column " + v)
+		}
+		columns = append(columns, v)
+	}
+	if len(columns) == 0 {
+		return defaults, nil
+	}
+	return columns, nil
+}
+
+// ExportProjection project only the top level fields of the column paths
+func ExportProjection(columns []string, paths map[string]string) bson.M {
+	projection := bson.M{"_id": 0}
+	for _, c := range columns {
+		projection[strings.Split(paths[c], ".")[0]] = 1
+	}
+	return projection
+}
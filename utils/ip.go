@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidIP = errors.New("Ip address is not a valid IPv4 or IPv6 address")
+
+var ErrInvalidMAC = errors.New("Mac address is not a valid 48 bit address")
+
+// NormalizeIP canonical text of an IPv4 or IPv6 address, so one address has one spelling.
+// IPv4 may have leading zero written by hand, e.g. 10.0.0.01 is 10.0.0.1, and IPv6 is lower case compressed.
+// IPv4-mapped IPv6 become IPv4, zone is not accepted
+func NormalizeIP(v string) (string, error) {
+	addr, err := parseIP(v)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// IPKey fixed length hex of the address, IPv4 as IPv4-mapped IPv6.
+// Keys compare as text in address order, used for range query
+func IPKey(v string) (string, error) {
+	addr, err := parseIP(v)
+	if err != nil {
+		return "", err
+	}
+	b := addr.As16()
+	return hex.EncodeToString(b[:]), nil
+}
+
+// ParseCIDR network of a cidr, e.g. 10.0.0.0/24 or fd00::/64, host bits are cleared.
+// Address without prefix length is a single host
+func ParseCIDR(v string) (netip.Prefix, error) {
+	ip, bits, hasBits := strings.Cut(strings.TrimSpace(v), "/")
+	addr, err := parseIP(ip)
+	if err != nil {
+		return netip.Prefix{}, errors.New("Invalid cidr " + v)
+	}
+	n := addr.BitLen()
+	if hasBits {
+		n, err = strconv.Atoi(bits)
+		if err != nil {
+			return netip.Prefix{}, errors.New("Invalid cidr " + v)
+		}
+	}
+	prefix, err := addr.Prefix(n)
+	if err != nil {
+		return netip.Prefix{}, errors.New("Invalid cidr " + v)
+	}
+	return prefix, nil
+}
+
+// CIDRKeyRange first & last IPKey of the network, inclusive
+func CIDRKeyRange(prefix netip.Prefix) (string, string) {
+	first := prefix.Masked().Addr().As16()
+	last := first
+
+	// IPv4 is the last 4 bytes of the key
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		bits += 96
+	}
+	for i := bits; i < 128; i++ {
+		last[i/8] |= 1 << (7 - i%8)
+	}
+	return hex.EncodeToString(first[:]), hex.EncodeToString(last[:])
+}
+
+// NormalizeMAC lower case colon separated mac address, e.g. AA-BB-CC-DD-EE-FF is aa:bb:cc:dd:ee:ff
+func NormalizeMAC(v string) (string, error) {
+	mac, err := net.ParseMAC(strings.TrimSpace(v))
+	if err != nil || len(mac) != 6 {
+		return "", ErrInvalidMAC
+	}
+	return mac.String(), nil
+}
+
+func parseIP(v string) (netip.Addr, error) {
+	v = strings.TrimSpace(v)
+	if strings.Contains(v, ":") {
+		addr, err := netip.ParseAddr(v)
+		if err != nil || addr.Zone() != "" {
+			return netip.Addr{}, ErrInvalidIP
+		}
+		return addr.Unmap(), nil
+	}
+
+	// dotted decimal, leading zero is decimal not octal
+	parts := strings.Split(v, ".")
+	if len(parts) != 4 {
+		return netip.Addr{}, ErrInvalidIP
+	}
+	var b [4]byte
+	for k, p := range parts {
+		if p == "" || len(p) > 3 {
+			return netip.Addr{}, ErrInvalidIP
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || n > 255 || p[0] == '+' || p[0] == '-' {
+			return netip.Addr{}, ErrInvalidIP
+		}
+		b[k] = byte(n)
+	}
+	return netip.AddrFrom4(b), nil
+}
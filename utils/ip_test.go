@@ -0,0 +1,160 @@
+package utils
+
+import "testing"
+
+func TestNormalizeIP(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "10.0.0.1", want: "10.0.0.1"},
+		{in: " 192.168.1.10 ", want: "192.168.1.10"},
+
+		// leading zero is decimal, not octal
+		{in: "10.0.0.01", want: "10.0.0.1"},
+		{in: "010.000.000.010", want: "10.0.0.10"},
+		{in: "192.168.001.008", want: "192.168.1.8"},
+		{in: "0.0.0.0", want: "0.0.0.0"},
+		{in: "255.255.255.255", want: "255.255.255.255"},
+
+		// IPv6 is lower case compressed
+		{in: "FD00:0000:0000:0000:0000:0000:0000:0001", want: "fd00::1"},
+		{in: "2001:DB8::A", want: "2001:db8::a"},
+		{in: "::1", want: "::1"},
+
+		// IPv4-mapped IPv6 is IPv4
+		{in: "::ffff:10.0.0.1", want: "10.0.0.1"},
+		{in: "::FFFF:0a00:0001", want: "10.0.0.1"},
+
+		{in: "", wantErr: true},
+		{in: "10.0.0", wantErr: true},
+		{in: "10.0.0.1.2", wantErr: true},
+		{in: "10.0.0.256", wantErr: true},
+		{in: "10.0.0.0001", wantErr: true},
+		{in: "10.0..1", wantErr: true},
+		{in: "10.0.0.+1", wantErr: true},
+		{in: "10.0.0.-1", wantErr: true},
+		{in: "10.0.0.a", wantErr: true},
+		{in: "fe80::1%eth0", wantErr: true},
+		{in: "fd00::1::2", wantErr: true},
+		{in: "camera-01.local", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeIP(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NormalizeIP(%q) = %q, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeIP(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestIPKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"10.0.0.1", "00000000000000000000ffff0a000001"},
+		{"10.0.0.01", "00000000000000000000ffff0a000001"},
+		{"::ffff:10.0.0.1", "00000000000000000000ffff0a000001"},
+		{"fd00::1", "fd000000000000000000000000000001"},
+	}
+	for _, tt := range tests {
+		got, err := IPKey(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("IPKey(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+
+	// keys compare as text in address order
+	a, _ := IPKey("10.0.0.9")
+	b, _ := IPKey("10.0.0.10")
+	if a >= b {
+		t.Errorf("IPKey of 10.0.0.9 %q is not before 10.0.0.10 %q", a, b)
+	}
+}
+
+func TestParseCIDR(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "10.0.0.0/24", want: "10.0.0.0/24"},
+		{in: "10.0.0.77/24", want: "10.0.0.0/24"},
+		{in: "10.0.0.07/32", want: "10.0.0.7/32"},
+		{in: "10.0.0.7", want: "10.0.0.7/32"},
+		{in: "FD00::1/64", want: "fd00::/64"},
+		{in: "::ffff:10.0.0.1/24", want: "10.0.0.0/24"},
+		{in: "10.0.0.0/33", wantErr: true},
+		{in: "10.0.0.0/x", wantErr: true},
+		{in: "fd00::/129", wantErr: true},
+		{in: "10.0.0/24", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCIDR(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseCIDR(%q) = %s, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("ParseCIDR(%q) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestCIDRKeyRange(t *testing.T) {
+	tests := []struct {
+		cidr        string
+		first, last string
+	}{
+		{"10.0.0.0/24", "00000000000000000000ffff0a000000", "00000000000000000000ffff0a0000ff"},
+		{"10.0.0.7/32", "00000000000000000000ffff0a000007", "00000000000000000000ffff0a000007"},
+		{"fd00::/64", "fd000000000000000000000000000000", "fd00000000000000ffffffffffffffff"},
+	}
+	for _, tt := range tests {
+		prefix, err := ParseCIDR(tt.cidr)
+		if err != nil {
+			t.Fatalf("ParseCIDR(%q): %v", tt.cidr, err)
+		}
+		first, last := CIDRKeyRange(prefix)
+		if first != tt.first || last != tt.last {
+			t.Errorf("CIDRKeyRange(%s) = %s, %s, want %s, %s", tt.cidr, first, last, tt.first, tt.last)
+		}
+	}
+}
+
+func TestNormalizeMAC(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "AA-BB-CC-DD-EE-FF", want: "aa:bb:cc:dd:ee:ff"},
+		{in: "aa:bb:cc:dd:ee:ff", want: "aa:bb:cc:dd:ee:ff"},
+		{in: "aabb.ccdd.eeff", want: "aa:bb:cc:dd:ee:ff"},
+		{in: " 00:11:22:33:44:55 ", want: "00:11:22:33:44:55"},
+		{in: "00:11:22:33:44", wantErr: true},
+		{in: "00:00:5e:10:00:00:00:01", wantErr: true},
+		{in: "zz:11:22:33:44:55", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeMAC(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NormalizeMAC(%q) = %q, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeMAC(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
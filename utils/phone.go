@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+// calling code, trunk prefix and national number length of a region
+type phoneRegion struct {
+	code     string
+	trunk    string
+	min, max int
+}
+
+// known regions, number of other country is only checked against the E.164 length
+var phoneRegions = map[string]phoneRegion{
+	"ID": {"62", "0", 8, 12},
+	"MY": {"60", "0", 8, 10},
+	"SG": {"65", "", 8, 8},
+	"PH": {"63", "0", 8, 10},
+	"TH": {"66", "0", 8, 9},
+	"VN": {"84", "0", 9, 10},
+	"AU": {"61", "0", 9, 9},
+	"JP": {"81", "0", 9, 10},
+	"IN": {"91", "0", 10, 10},
+	"GB": {"44", "0", 9, 10},
+	"NL": {"31", "0", 9, 9},
+	"DE": {"49", "0", 6, 13},
+	"US": {"1", "", 10, 10},
+}
+
+var defaultPhoneRegion = phoneRegions["ID"]
+
+var ErrInvalidPhone = errors.New("Phone is not a valid number")
+
+// SetPhoneRegion set region of phone number written without country code
+func SetPhoneRegion(region string) error {
+	r, ok := phoneRegions[strings.ToUpper(region)]
+	if !ok {
+		return errors.New("Unsupported phone region " + region)
+	}
+	defaultPhoneRegion = r
+	return nil
+}
+
+// NormalizePhone parse phone in any common format, e.g. "0812-345", "62 812 345" or "+62812345", into E.164
+func NormalizePhone(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	international := strings.HasPrefix(raw, "+")
+
+	var b strings.Builder
+	for i, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0, r == ' ', r == '-', r == '.', r == '(', r == ')', r == '/':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+	digits := b.String()
+	if !international && strings.HasPrefix(digits, "00") {
+		international = true
+		digits = digits[2:]
+	}
+
+	if international {
+		for size := 1; size <= 3 && size < len(digits); size++ {
+			for _, r := range phoneRegions {
+				if r.code != digits[:size] {
+					continue
+				}
+				// trunk prefix written after the country code, e.g. +62 (0)812
+				national := digits[size:]
+				if r.trunk != "" && strings.HasPrefix(national, r.trunk) {
+					national = national[len(r.trunk):]
+				}
+				return r.format(national)
+			}
+		}
+		if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+			return "", ErrInvalidPhone
+		}
+		return "+" + digits, nil
+	}
+
+	r := defaultPhoneRegion
+	switch {
+	case r.trunk != "" && strings.HasPrefix(digits, r.trunk):
+		digits = digits[len(r.trunk):]
+	case strings.HasPrefix(digits, r.code) && len(digits)-len(r.code) >= r.min:
+		// country code written without +
+		digits = digits[len(r.code):]
+	}
+	return r.format(digits)
+}
+
+func (r phoneRegion) format(national string) (string, error) {
+	if len(national) < r.min || len(national) > r.max || len(r.code)+len(national) > 15 {
+		return "", ErrInvalidPhone
+	}
+	return "+" + r.code + national, nil
+}
+
+// NormalizePhonePtr normalize optional phone, nil when empty
+func NormalizePhonePtr(raw *string) (*string, error) {
+	if raw == nil || strings.TrimSpace(*raw) == "" {
+		return nil, nil
+	}
+	v, err := NormalizePhone(*raw)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// PhoneFilters make phone filter match any format, by filtering the normalized phone_e164 instead
+func PhoneFilters(filters map[string][]string) {
+	for key, values := range filters {
+		field, op, _ := strings.Cut(key, "[")
+		if field != "phone" {
+			continue
+		}
+		delete(filters, key)
+
+		newValues := make([]string, 0, len(values))
+		for _, v := range values {
+			if op == "$like]" {
+				// partial number, match its digits without trunk prefix
+				newValues = append(newValues, strings.TrimLeft(phoneDigits(v), "0"))
+				continue
+			}
+			if n, err := NormalizePhone(v); err == nil {
+				v = n
+			}
+			newValues = append(newValues, v)
+		}
+
+		newKey := "phone_e164"
+		if op != "" {
+			newKey += "[" + op
+		}
+		filters[newKey] = newValues
+	}
+}
+
+func phoneDigits(v string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, v)
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		// default region is ID
+		{in: "081234567890", want: "+6281234567890"},
+		{in: "0812-3456-7890", want: "+6281234567890"},
+		{in: "(021) 555.1234", want: "+62215551234"},
+		{in: "6281234567890", want: "+6281234567890"},
+		{in: "62 812 3456 7890", want: "+6281234567890"},
+		{in: "+6281234567890", want: "+6281234567890"},
+		{in: "+62 (0)812 3456 7890", want: "+6281234567890"},
+		{in: "006281234567890", want: "+6281234567890"},
+		{in: " 0812/3456/7890 ", want: "+6281234567890"},
+
+		// other known region
+		{in: "+65 6123 4567", want: "+6561234567"},
+		{in: "+1 (415) 555-0100", want: "+14155550100"},
+		{in: "+44 (0)20 7946 0000", want: "+442079460000"},
+
+		// unknown region is only checked against E.164 length
+		{in: "+358 40 1234567", want: "+358401234567"},
+		{in: "+358 1234", wantErr: true},
+
+		{in: "", wantErr: true},
+		{in: "0812", wantErr: true},
+		{in: "0812345678901234", wantErr: true},
+		{in: "+65 6123 456", wantErr: true},
+		{in: "0812-3456-789a", wantErr: true},
+		{in: "0812+34567890", wantErr: true},
+		{in: "++6281234567890", wantErr: true},
+		{in: "+0812345678", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePhone(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NormalizePhone(%q) = %q, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizePhone(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizePhoneRegion(t *testing.T) {
+	defer func(r phoneRegion) { defaultPhoneRegion = r }(defaultPhoneRegion)
+
+	if err := SetPhoneRegion("xx"); err == nil {
+		t.Fatal("SetPhoneRegion(xx) want error")
+	}
+	if err := SetPhoneRegion("sg"); err != nil {
+		t.Fatalf("SetPhoneRegion(sg): %v", err)
+	}
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "6123 4567", want: "+6561234567"},
+		{in: "65 6123 4567", want: "+6561234567"},
+		{in: "+62 812 3456 7890", want: "+6281234567890"},
+		{in: "0812 3456 7890", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePhone(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NormalizePhone(%q) = %q, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizePhone(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizePhonePtr(t *testing.T) {
+	empty := "  "
+	valid := "0812-3456-7890"
+	invalid := "12"
+
+	if got, err := NormalizePhonePtr(nil); got != nil || err != nil {
+		t.Errorf("NormalizePhonePtr(nil) = %v, %v, want nil", got, err)
+	}
+	if got, err := NormalizePhonePtr(&empty); got != nil || err != nil {
+		t.Errorf("NormalizePhonePtr(%q) = %v, %v, want nil", empty, got, err)
+	}
+	if got, err := NormalizePhonePtr(&valid); err != nil || got == nil || *got != "+6281234567890" {
+		t.Errorf("NormalizePhonePtr(%q) = %v, %v, want +6281234567890", valid, got, err)
+	}
+	if _, err := NormalizePhonePtr(&invalid); err == nil {
+		t.Errorf("NormalizePhonePtr(%q) want error", invalid)
+	}
+}
+
+func TestPhoneFilters(t *testing.T) {
+	tests := []struct {
+		in   map[string][]string
+		want map[string][]string
+	}{
+		{
+			in:   map[string][]string{"phone": {"0812-3456-7890"}},
+			want: map[string][]string{"phone_e164": {"+6281234567890"}},
+		},
+		{
+			in:   map[string][]string{"phone[$ne]": {"+62 812 3456 7890"}},
+			want: map[string][]string{"phone_e164[$ne]": {"+6281234567890"}},
+		},
+		{
+			in:   map[string][]string{"phone[$like]": {"0812-3456"}},
+			want: map[string][]string{"phone_e164[$like]": {"8123456"}},
+		},
+		{
+			// unknown spelling is kept
+			in:   map[string][]string{"phone": {"12"}, "name": {"Budi"}},
+			want: map[string][]string{"phone_e164": {"12"}, "name": {"Budi"}},
+		},
+	}
+	for _, tt := range tests {
+		PhoneFilters(tt.in)
+		if !reflect.DeepEqual(tt.in, tt.want) {
+			t.Errorf("PhoneFilters() = %v, want %v", tt.in, tt.want)
+		}
+	}
+}
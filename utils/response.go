@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,6 +13,41 @@ type HelperUsecaseHandler struct {
 	Filters           map[string][]string
 	Sort              string
 	AllowedSortFields map[string]bool
+
+	// field under the prefix can be sorted too, e.g. "custom_fields."
+	AllowedSortPrefixes []string
+	// filter value of the field is converted to the type, "number" or "boolean", other is kept as text
+	FieldTypes map[string]string
+}
+
+// name under an allowed sort prefix
+var sortFieldName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func (uc *HelperUsecaseHandler) allowedSort(field string) bool {
+	if uc.AllowedSortFields[field] {
+		return true
+	}
+	for _, prefix := range uc.AllowedSortPrefixes {
+		if strings.HasPrefix(field, prefix) && sortFieldName.MatchString(strings.TrimPrefix(field, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterValue convert the filter value to the type of the field
+func (uc *HelperUsecaseHandler) filterValue(field, val string) interface{} {
+	switch uc.FieldTypes[field] {
+	case "number":
+		if n, err := strconv.ParseFloat(val, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return val
 }
 
 func (uc *HelperUsecaseHandler) SetSort() bson.D {
@@ -28,7 +65,7 @@ func (uc *HelperUsecaseHandler) SetSort() bson.D {
 				dir = -1
 				field = strings.TrimPrefix(p, "-")
 			}
-			if uc.AllowedSortFields[field] {
+			if uc.allowedSort(field) {
 				sortDoc = append(sortDoc, bson.E{Key: field, Value: dir})
 			}
 		}
@@ -55,12 +92,16 @@ func (uc *HelperUsecaseHandler) SetFilter() bson.M {
 			filter[field] = bson.M{"$regex": val, "$options": "i"}
 		} else if strings.Contains(key, "[$eq]") {
 			field := strings.Replace(key, "[$eq]", "", 1)
-			filter[field] = val
+			filter[field] = uc.filterValue(field, val)
 		} else if strings.Contains(key, "[$in]") {
 			field := strings.Replace(key, "[$in]", "", 1)
-			filter[field] = bson.M{"$in": values}
+			in := bson.A{}
+			for _, v := range values {
+				in = append(in, uc.filterValue(field, v))
+			}
+			filter[field] = bson.M{"$in": in}
 		} else {
-			filter[key] = val
+			filter[key] = uc.filterValue(key, val)
 		}
 	}
 
@@ -74,6 +115,9 @@ type Pagination struct {
 	TotalPages int  `json:"total_pages"`
 	HasNext    bool `json:"has_next"`
 	HasPrev    bool `json:"has_prev"`
+
+	// cursor based pagination
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 type Response struct {
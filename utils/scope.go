@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maulanar/gin-kecilin/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// CustomerContactID contact id of the caller when the caller is a customer
+func CustomerContactID(c *gin.Context) (string, bool) {
+	claims, ok := GetClaims(c)
+	if !ok || claims.Role != RoleCustomer {
+		return "", false
+	}
+	return claims.ContactID, true
+}
+
+// ScopeFilters limit the filters of a customer to their own contact on the field,
+// any filter of the caller on the field or the dropped keys is removed
+func ScopeFilters(c *gin.Context, filters map[string][]string, field string, drop ...string) {
+	contactID, ok := CustomerContactID(c)
+	if !ok {
+		return
+	}
+	for key := range filters {
+		name, _, _ := strings.Cut(key, "[")
+		if name == field {
+			delete(filters, key)
+		}
+		for _, v := range drop {
+			if name == v {
+				delete(filters, key)
+			}
+		}
+	}
+	filters[field] = []string{contactID}
+}
+
+// CanAccessCctv tell whether the caller may see the cctv, customer only see the cctv they own
+func CanAccessCctv(c *gin.Context, cctvID string) (bool, error) {
+	contactID, ok := CustomerContactID(c)
+	if !ok {
+		return true, nil
+	}
+	count, err := database.OpenCollection("cctvs").CountDocuments(c.Request.Context(),
+		bson.M{"cctv_id": cctvID, "contact_id": contactID})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
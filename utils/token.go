@@ -5,6 +5,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 	"github.com/maulanar/gin-kecilin/database"
 	"go.mongodb.org/mongo-driver/bson"
@@ -12,9 +13,18 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+	RoleCustomer = "customer" // contact logged in, only see their own cctvs
+)
+
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role,omitempty"`       // filled from users on validate, not signed in token
+	ContactID string `json:"contact_id,omitempty"` // contact of a customer, filled from users on validate
 	jwt.StandardClaims
 }
 
@@ -42,15 +52,15 @@ func ValidateToken(token string) (*Claims, error) {
 	}
 
 	// validate token to users
-	// filter to table users, to check token is valid or not
+	// filter to table users, to check token is valid or not, refresh token is not an access token
 	filter := bson.M{
 		"user_id": claims.UserID,
-		"$or": []bson.M{
-			{"token": token},
-			{"refresh_token": token},
-		},
+		"token":   token,
+	}
+	var dtUser struct {
+		Role      string `bson:"role"`
+		ContactID string `bson:"contact_id"`
 	}
-	var dtUser any
 	err = database.OpenCollection("users").FindOne(context.Background(), filter).Decode(&dtUser)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
@@ -58,9 +68,20 @@ func ValidateToken(token string) (*Claims, error) {
 		}
 		return nil, err
 	}
+
+	// user created before roles has no role, it keeps the access it had and only role restricted routes are refused
+	claims.Role = dtUser.Role
+	claims.ContactID = dtUser.ContactID
 	return claims, nil
 }
 
+// GetClaims return claims set by Authenticate middleware
+func GetClaims(c *gin.Context) (*Claims, bool) {
+	claims, _ := c.Get("claims")
+	tokenClaim, ok := claims.(*Claims)
+	return tokenClaim, ok
+}
+
 func HashPassword(password *string) (*string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
 	if err != nil {
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// pre-release tag of a version, e.g. the "-rc1" of "V5.8.0-rc1"
+var preReleaseTag = regexp.MustCompile(`(?i)(?:^|[^a-z])(alpha|beta|pre|rc)`)
+
+// order of pre-release tags, all before the release itself
+var preReleaseRank = map[string]int{"alpha": 0, "beta": 1, "pre": 2, "rc": 2}
+
+// CompareVersions compare firmware versions by their numbers in order, text between them is ignored,
+// e.g. V5.7.3 < V5.7.10 < V5.7.10 build 230209. Pre-release is before its release, alpha < beta < rc,
+// e.g. V5.8.0-beta2 < V5.8.0-rc1 < V5.8.0. Return -1, 0 or 1, missing number count as 0
+func CompareVersions(a, b string) int {
+	relA, nameA, tagA, preA := splitPreRelease(a)
+	relB, nameB, tagB, preB := splitPreRelease(b)
+	if c := compareNumbers(versionNumbers(relA), versionNumbers(relB)); c != 0 {
+		return c
+	}
+
+	switch {
+	case !preA && !preB:
+		return 0
+	case !preA:
+		return 1
+	case !preB:
+		return -1
+	}
+	x, y := preReleaseRank[nameA], preReleaseRank[nameB]
+	if x != y {
+		if x < y {
+			return -1
+		}
+		return 1
+	}
+	return compareNumbers(versionNumbers(tagA), versionNumbers(tagB))
+}
+
+// splitPreRelease split the release part, the lower case tag name and the tag with its number, false when there is no tag
+func splitPreRelease(v string) (string, string, string, bool) {
+	loc := preReleaseTag.FindStringSubmatchIndex(v)
+	if loc == nil {
+		return v, "", "", false
+	}
+	return v[:loc[2]], strings.ToLower(v[loc[2]:loc[3]]), v[loc[2]:], true
+}
+
+func compareNumbers(x, y []string) int {
+	for i := 0; i < max(len(x), len(y)); i++ {
+		n, m := "0", "0"
+		if i < len(x) {
+			n = x[i]
+		}
+		if i < len(y) {
+			m = y[i]
+		}
+
+		// compare as text without leading zero, longer is bigger, so long build numbers never overflow
+		if len(n) != len(m) {
+			if len(n) < len(m) {
+				return -1
+			}
+			return 1
+		}
+		if c := strings.Compare(n, m); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func versionNumbers(v string) []string {
+	parts := strings.FieldsFunc(v, func(r rune) bool { return !unicode.IsDigit(r) })
+	for k, p := range parts {
+		p = strings.TrimLeft(p, "0")
+		if p == "" {
+			p = "0"
+		}
+		parts[k] = p
+	}
+	return parts
+}
@@ -0,0 +1,41 @@
+package utils
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"V5.7.3", "V5.7.10", -1},
+		{"V5.7.10", "V5.7.3", 1},
+		{"V5.7.10", "V5.7.10", 0},
+		{"V5.7.10", "V5.7.10 build 230209", -1},
+		{"V5.7.10 build 230209", "V5.7.10 build 230301", -1},
+		{"1.0", "1", 0},
+		{"1.0.0", "1.0.1", -1},
+		{"v2.0.0", "1.99", 1},
+		{"2.800.0000000.16", "2.800.0.16", 0},
+		{"2.800.0000000.16", "2.800.0000000.17", -1},
+		{"99999999999999999999", "100000000000000000000", -1},
+		{"", "0", 0},
+		{"", "1", -1},
+
+		// pre-release
+		{"V5.8.0-rc1", "V5.8.0", -1},
+		{"V5.8.0", "V5.8.0-rc1", 1},
+		{"V5.8.0-beta2", "V5.8.0-rc1", -1},
+		{"V5.8.0-alpha", "V5.8.0-beta", -1},
+		{"V5.8.0-rc1", "V5.8.0-rc2", -1},
+		{"V5.8.0-RC2", "V5.8.0-rc2", 0},
+		{"V5.8.0rc1", "V5.8.0", -1},
+		{"V5.8.0-rc1", "V5.7.10", 1},
+		{"1.0.0-pre", "1.0.0-rc", 0},
+		{"2.0 beta", "1.9", 1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
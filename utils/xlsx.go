@@ -0,0 +1,316 @@
+package utils
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// max uncompressed size of a single xlsx part, guard against zip bomb
+const maxXLSXPart = 64 << 20
+
+// max column of a worksheet, same as excel (XFD)
+const maxXLSXColumns = 16384
+
+// ReadXLSX return the cell values of the first worksheet, row by row, up to maxRows rows.
+// Only values are read, styles and formulas are ignored
+func ReadXLSX(r io.ReaderAt, size int64, maxRows int) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.New("Invalid xlsx file")
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := readSharedStrings(files)
+	if err != nil {
+		return nil, err
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, errors.New("Invalid xlsx file, worksheet not found")
+	}
+	var sheet struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R  string `xml:"r,attr"`
+				T  string `xml:"t,attr"`
+				V  string `xml:"v"`
+				Is struct {
+					T string `xml:"t"`
+					R []struct {
+						T string `xml:"t"`
+					} `xml:"r"`
+				} `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decodeXLSXPart(f, &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := [][]string{}
+	for _, row := range sheet.Rows {
+		// row & cell reference come from the file, check before allocating
+		if row.R > maxRows || len(rows) >= maxRows {
+			return nil, errors.New("Xlsx file has more than " + strconv.Itoa(maxRows) + " rows")
+		}
+		// keep empty rows so row number match the spreadsheet
+		for row.R > len(rows)+1 {
+			rows = append(rows, []string{})
+		}
+
+		values := []string{}
+		for i, c := range row.Cells {
+			col := i
+			if c.R != "" {
+				col = columnIndex(c.R)
+			}
+			if col < 0 || col >= maxXLSXColumns {
+				return nil, errors.New("Invalid xlsx file, cell " + c.R + " is out of range")
+			}
+			for len(values) < col {
+				values = append(values, "")
+			}
+
+			v := c.V
+			switch c.T {
+			case "s":
+				idx, err := strconv.Atoi(c.V)
+				if err != nil || idx < 0 || idx >= len(shared) {
+					return nil, errors.New("Invalid xlsx file, shared string not found")
+				}
+				v = shared[idx]
+			case "inlineStr":
+				v = c.Is.T
+				for _, run := range c.Is.R {
+					v += run.T
+				}
+			case "b":
+				v = strconv.FormatBool(c.V == "1")
+			}
+			if col < len(values) {
+				values[col] = v
+			} else {
+				values = append(values, v)
+			}
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+// firstSheetPath resolve the first sheet of the workbook to its part name
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	f, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", errors.New("Invalid xlsx file, workbook not found")
+	}
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeXLSXPart(f, &workbook); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("Invalid xlsx file, workbook has no sheet")
+	}
+
+	rels, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return "xl/worksheets/sheet1.xml", nil
+	}
+	var relationships struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeXLSXPart(rels, &relationships); err != nil {
+		return "", err
+	}
+	for _, v := range relationships.Items {
+		if v.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(v.Target, "/") {
+			return strings.TrimPrefix(v.Target, "/"), nil
+		}
+		return path.Join("xl", v.Target), nil
+	}
+	return "", errors.New("Invalid xlsx file, worksheet not found")
+}
+
+func readSharedStrings(files map[string]*zip.File) ([]string, error) {
+	f, ok := files["xl/sharedStrings.xml"]
+	if !ok {
+		return nil, nil
+	}
+	var sst struct {
+		Items []struct {
+			T string `xml:"t"`
+			R []struct {
+				T string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := decodeXLSXPart(f, &sst); err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(sst.Items))
+	for _, v := range sst.Items {
+		s := v.T
+		for _, run := range v.R {
+			s += run.T
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+func decodeXLSXPart(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return errors.New("Invalid xlsx file")
+	}
+	defer rc.Close()
+
+	if err := xml.NewDecoder(io.LimitReader(rc, maxXLSXPart)).Decode(v); err != nil {
+		return errors.New("Invalid xlsx file, cannot read " + f.Name)
+	}
+	return nil
+}
+
+// columnIndex zero based column of a cell reference, e.g. "C12" is 2, -1 when the reference has no column.
+// Column past maxXLSXColumns is returned as maxXLSXColumns
+func columnIndex(ref string) int {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+		if col > maxXLSXColumns {
+			return maxXLSXColumns
+		}
+	}
+	return col - 1
+}
+
+// excel day 0, dates after 1900-02-28 are counted from it because excel has a 1900-02-29
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// ParseXLSXDate time of an excel date serial number, e.g. 45658 is 2025-01-01 and 45658.5 is noon of it.
+// Date cell is stored as the number, its format is only a style. Loc is the timezone of the sheet
+func ParseXLSXDate(v string, loc *time.Location) (time.Time, bool) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	// 1900-01-01 to 9999-12-31
+	if err != nil || n < 1 || n >= 2958466 {
+		return time.Time{}, false
+	}
+	days := math.Floor(n)
+	switch {
+	case days == 60:
+		// 1900-02-29 does not exist
+		return time.Time{}, false
+	case days < 60:
+		days++
+	}
+	seconds := math.Round((n - math.Floor(n)) * 86400)
+	t := xlsxEpoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), true
+}
+
+// XLSXWriter write a single sheet workbook row by row, without keeping rows in memory
+type XLSXWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	row   int
+}
+
+// static parts of the workbook
+var xlsxParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+func NewXLSXWriter(w io.Writer) (*XLSXWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, p := range xlsxParts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return nil, err
+	}
+	return &XLSXWriter{zw: zw, sheet: sheet}, nil
+}
+
+// WriteRow add a row, number is written as number cell and everything else as text
+func (x *XLSXWriter) WriteRow(values []interface{}) error {
+	x.row++
+	var b strings.Builder
+	b.WriteString(`<row r="` + strconv.Itoa(x.row) + `">`)
+	for _, v := range values {
+		if v == nil {
+			b.WriteString(`<c/>`)
+			continue
+		}
+		switch {
+		case isNumber(v):
+			b.WriteString(`<c><v>` + FormatCell(v) + `</v></c>`)
+		default:
+			b.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(&b, []byte(EscapeFormula(FormatCell(v))))
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	b.WriteString(`</row>`)
+
+	_, err := io.WriteString(x.sheet, b.String())
+	return err
+}
+
+// Close finish the sheet and the zip
+func (x *XLSXWriter) Close() error {
+	if _, err := io.WriteString(x.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testXLSX minimal workbook with the sheet data, and shared strings when not empty
+func testXLSX(t *testing.T, sheetData, sharedStrings string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	parts := map[string]string{
+		"xl/workbook.xml":            `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Data" sheetId="1" r:id="rId3"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/data.xml"/></Relationships>`,
+		"xl/worksheets/data.xml":     `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + sheetData + `</sheetData></worksheet>`,
+	}
+	if sharedStrings != "" {
+		parts["xl/sharedStrings.xml"] = `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` + sharedStrings + `</sst>`
+	}
+	for name, body := range parts {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestReadXLSX(t *testing.T) {
+	tests := []struct {
+		name      string
+		sheetData string
+		shared    string
+		maxRows   int
+		want      [][]string
+		wantErr   string
+	}{
+		{
+			name:      "cell types",
+			sheetData: `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><t>Lobby</t></is></c><c r="C1"><v>45658</v></c><c r="D1" t="b"><v>1</v></c></row>`,
+			shared:    `<si><t>CAM-01</t></si>`,
+			maxRows:   10,
+			want:      [][]string{{"CAM-01", "Lobby", "45658", "true"}},
+		},
+		{
+			name:      "rich text",
+			sheetData: `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><r><t>Gate </t></r><r><t>North</t></r></is></c></row>`,
+			shared:    `<si><r><t>Main </t></r><r><t>Hall</t></r></si>`,
+			maxRows:   10,
+			want:      [][]string{{"Main Hall", "Gate North"}},
+		},
+		{
+			name:      "empty cells and rows are kept",
+			sheetData: `<row r="1"><c r="A1" t="inlineStr"><is><t>a</t></is></c></row><row r="3"><c r="C3" t="inlineStr"><is><t>c</t></is></c></row>`,
+			maxRows:   10,
+			want:      [][]string{{"a"}, {}, {"", "", "c"}},
+		},
+		{
+			name:      "cell without reference",
+			sheetData: `<row r="1"><c><v>1</v></c><c><v>2</v></c></row>`,
+			maxRows:   10,
+			want:      [][]string{{"1", "2"}},
+		},
+		{
+			name:      "last column",
+			sheetData: `<row r="1"><c r="XFD1"><v>1</v></c></row>`,
+			maxRows:   10,
+			want:      [][]string{append(make([]string, maxXLSXColumns-1), "1")},
+		},
+		{
+			name:      "column out of range",
+			sheetData: `<row r="1"><c r="XFE1"><v>1</v></c></row>`,
+			maxRows:   10,
+			wantErr:   "out of range",
+		},
+		{
+			name:      "huge column",
+			sheetData: `<row r="1"><c r="ZZZZZZZZZZZZ1"><v>1</v></c></row>`,
+			maxRows:   10,
+			wantErr:   "out of range",
+		},
+		{
+			name:      "row number over max rows",
+			sheetData: `<row r="1048576"><c r="A1048576"><v>1</v></c></row>`,
+			maxRows:   10,
+			wantErr:   "more than 10 rows",
+		},
+		{
+			name:      "too many rows",
+			sheetData: `<row r="1"><c><v>1</v></c></row><row r="2"><c><v>2</v></c></row><row r="3"><c><v>3</v></c></row>`,
+			maxRows:   2,
+			wantErr:   "more than 2 rows",
+		},
+		{
+			name:      "shared string not found",
+			sheetData: `<row r="1"><c r="A1" t="s"><v>3</v></c></row>`,
+			shared:    `<si><t>only</t></si>`,
+			maxRows:   10,
+			wantErr:   "shared string not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testXLSX(t, tt.sheetData, tt.shared)
+			got, err := ReadXLSX(r, r.Size(), tt.maxRows)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadXLSX() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadXLSX() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadXLSX() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadXLSXInvalid(t *testing.T) {
+	data := []byte("name,ip\nCAM-01,10.0.0.1\n")
+	if _, err := ReadXLSX(bytes.NewReader(data), int64(len(data)), 10); err == nil {
+		t.Error("ReadXLSX() of a csv file want error")
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewXLSXWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]interface{}{
+		{"name", "port", "ratio", "active", "note"},
+		{"CAM <01> & 02", 554, 0.5, true, nil},
+		{"=HYPERLINK(\"http://x\")", -1, "-1", "@SUM(A1)", "+62 812"},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"name", "port", "ratio", "active", "note"},
+		{"CAM <01> & 02", "554", "0.5", "true", ""},
+		// text starting a formula is escaped, number is not
+		{"'=HYPERLINK(\"http://x\")", "-1", "'-1", "'@SUM(A1)", "'+62 812"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %q, want %q", got, want)
+	}
+}
+
+func TestParseXLSXDate(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	tests := []struct {
+		in   string
+		loc  *time.Location
+		want time.Time
+		ok   bool
+	}{
+		{"45658", time.UTC, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{" 45658 ", time.UTC, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"45658.5", time.UTC, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), true},
+		{"45658.75", jakarta, time.Date(2025, 1, 1, 18, 0, 0, 0, jakarta), true},
+		{"45658.999988426", time.UTC, time.Date(2025, 1, 1, 23, 59, 59, 0, time.UTC), true},
+		{"61", time.UTC, time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC), true},
+		{"2958465", time.UTC, time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC), true},
+		{"59", time.UTC, time.Date(1900, 2, 28, 0, 0, 0, 0, time.UTC), true},
+		{"1", time.UTC, time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"1.25", time.UTC, time.Date(1900, 1, 1, 6, 0, 0, 0, time.UTC), true},
+		{"60", time.UTC, time.Time{}, false},
+		{"0", time.UTC, time.Time{}, false},
+		{"-1", time.UTC, time.Time{}, false},
+		{"2958466", time.UTC, time.Time{}, false},
+		{"2025-01-01", time.UTC, time.Time{}, false},
+		{"", time.UTC, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseXLSXDate(tt.in, tt.loc)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("ParseXLSXDate(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want int
+	}{
+		{"A1", 0},
+		{"C12", 2},
+		{"Z1", 25},
+		{"AA1", 26},
+		{"XFD1", maxXLSXColumns - 1},
+		{"XFE1", maxXLSXColumns},
+		{"ZZZZZZZZZZZZ1", maxXLSXColumns},
+		{"1", -1},
+		{"", -1},
+	}
+	for _, tt := range tests {
+		if got := columnIndex(tt.ref); got != tt.want {
+			t.Errorf("columnIndex(%q) = %d, want %d", tt.ref, got, tt.want)
+		}
+	}
+}